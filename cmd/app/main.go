@@ -2,12 +2,13 @@ package main
 
 import (
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/logger"
 	"fmt"
 )
 import "fiber-web-api/internal/router"
 
 func main() {
 	app := router.InitRouter()
-	//RSA密钥对
+	defer logger.Sync()
 	app.Listen(fmt.Sprintf(":%d", config.HTTPPort))
 }
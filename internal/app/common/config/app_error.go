@@ -0,0 +1,127 @@
+package config
+
+import (
+	"errors"
+	"fiber-web-api/internal/app/common/i18n"
+	"net/http"
+)
+
+// 应用错误：返回码固定不变，Status 为返回的HTTP状态码，Key 为国际化消息的key，
+// Message 为消息目录中没有该key时使用的默认消息（可以带 %s 等参数，参数可以是 i18n.Msg）。
+// 目录中的错误作为模板使用，通过 With、Wrap 等方法复制后再返回，不要修改目录中的错误
+type AppError struct {
+	Code    int    // 返回码
+	Status  int    // HTTP状态码
+	Key     string // 国际化消息key
+	Message string // 默认消息
+	Args    []any  // 消息参数
+	Err     error  // 原始错误，只输出到日志，不返回给前端
+}
+
+// 错误目录，key 不能重复
+var appErrors = map[string]*AppError{}
+
+func newAppError(code, status int, key, message string) *AppError {
+	if _, ok := appErrors[key]; ok {
+		panic("duplicate app error key: " + key)
+	}
+	e := &AppError{Code: code, Status: status, Key: key, Message: message}
+	appErrors[key] = e
+	return e
+}
+
+// ==================================== 错误目录 ====================================
+var (
+	ErrUnknown      = newAppError(-1, http.StatusInternalServerError, "error.unknown", UNKNOWN_EXCEPTION)
+	ErrFailed       = newAppError(-1, http.StatusOK, "error.failed", "操作失败") // 通用的业务失败，一般通过 WithMessage 指定具体的消息
+	ErrPassword     = newAppError(CodePassword, http.StatusUnauthorized, "error.password", "%s错误，剩余次数: %d")
+	ErrNotLogin     = newAppError(CodeNotLogin, http.StatusUnauthorized, "error.notLogin", "用户未登录")
+	ErrLocked       = newAppError(CodeLocked, http.StatusLocked, "error.locked", "%s锁定中，还没到允许登录的时间，请%d分钟后再尝试")
+	ErrLockedNow    = newAppError(CodeLocked, http.StatusLocked, "error.lockedNow", "%s错误次数过多，现已被锁定，请%d分钟后再尝试")
+	ErrSignMissing  = newAppError(CodeSignMissing, http.StatusUnauthorized, "error.signMissing", "缺少请求签名")
+	ErrSignExpired  = newAppError(CodeSignExpired, http.StatusUnauthorized, "error.signExpired", "请求已过期，请检查设备时间")
+	ErrSignReplayed = newAppError(CodeSignReplayed, http.StatusUnauthorized, "error.signReplayed", "重复的请求")
+	ErrSignInvalid  = newAppError(CodeSignInvalid, http.StatusUnauthorized, "error.signInvalid", "请求签名格式错误")
+	ErrPwdExpired   = newAppError(CodePwdExpired, http.StatusForbidden, "error.pwdExpired", "密码已过期，请修改密码")
+	ErrPwdChange    = newAppError(CodePwdChange, http.StatusForbidden, "error.pwdChange", "首次登录或密码已重置，请修改密码")
+	ErrMfaRequired  = newAppError(CodeMfaRequired, http.StatusOK, "error.mfaRequired", "请输入动态验证码")
+	ErrMfaEnroll    = newAppError(CodeMfaEnroll, http.StatusForbidden, "error.mfaEnroll", "当前角色必须开启双因素认证，请先绑定身份验证器")
+	ErrCaptcha      = newAppError(CodeCaptcha, http.StatusBadRequest, "error.captcha", "验证码错误或已过期")
+	ErrKeyExpired   = newAppError(CodeKeyExpired, http.StatusBadRequest, "error.keyExpired", "公钥已过期，请重新获取")
+	ErrParam        = newAppError(CodeParam, http.StatusBadRequest, "error.param", "参数错误")
+	ErrForbidden    = newAppError(CodeForbidden, http.StatusForbidden, "error.forbidden", "没有操作权限")
+	ErrNotFound     = newAppError(CodeNotFound, http.StatusNotFound, "error.notFound", "%s不存在")
+	ErrExists       = newAppError(CodeExists, http.StatusConflict, "error.exists", "%s已存在")
+	ErrInUse        = newAppError(CodeInUse, http.StatusConflict, "error.inUse", "%s，不允许删除")
+	ErrRoute        = newAppError(CodeRoute, http.StatusNotFound, "error.route", "接口不存在")
+	ErrIllegal      = newAppError(CodeIllegal, http.StatusForbidden, "error.illegal", "非法访问")
+	ErrDecrypt      = newAppError(CodeDecrypt, http.StatusBadRequest, "error.decrypt", "数据解密失败")
+	ErrMfaCode      = newAppError(CodeMfaCode, http.StatusOK, "error.mfaCode", "动态验证码错误")
+	ErrMfaAttempt   = newAppError(CodeMfaCode, http.StatusOK, "error.mfaAttempt", "%s错误，剩余次数: %d")
+	ErrPwdPolicy    = newAppError(CodePwdPolicy, http.StatusOK, "error.pwdPolicy", "密码不符合安全策略：%s")
+	ErrTooMany      = newAppError(CodeTooMany, http.StatusTooManyRequests, "error.tooMany", "请求过于频繁，请%d秒后再试")
+)
+
+// 所有的错误，用于生成文档、校验国际化消息是否齐全
+func AppErrors() []*AppError {
+	list := make([]*AppError, 0, len(appErrors))
+	for _, e := range appErrors {
+		list = append(list, e)
+	}
+	return list
+}
+
+// 默认语言的消息
+func (e *AppError) Error() string {
+	return e.Localize(i18n.Default())
+}
+
+// 指定语言的消息
+func (e *AppError) Localize(locale string) string {
+	return i18n.Translate(locale, e.Key, e.Message, e.Args...)
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// 按 key 判断是否是同一个错误，用于 errors.Is(err, config.ErrForbidden)
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Key == e.Key
+}
+
+// 复制并设置消息参数
+func (e *AppError) With(args ...any) *AppError {
+	c := *e
+	c.Args = args
+	return &c
+}
+
+// 复制并设置原始错误
+func (e *AppError) Wrap(err error) *AppError {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// 复制并指定具体的消息，返回码和HTTP状态码不变
+func (e *AppError) WithMessage(key, message string) *AppError {
+	c := *e
+	c.Key, c.Message, c.Args = key, message, nil
+	return &c
+}
+
+// 转换为统一的返回格式（默认语言），返回前通过 Result.Localize 翻译为请求的语言
+func (e *AppError) Result() *Result {
+	return &Result{Code: e.Code, Message: e.Error(), key: e.Key, def: e.Message, args: e.Args}
+}
+
+// 转换为应用错误，不是应用错误的返回 ErrUnknown
+func AsAppError(err error) *AppError {
+	var e *AppError
+	if errors.As(err, &e) {
+		return e
+	}
+	return ErrUnknown.Wrap(err)
+}
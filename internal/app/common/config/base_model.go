@@ -1,14 +1,19 @@
 package config
 
 import (
+	"context"
+	"fiber-web-api/internal/app/common/i18n"
+	"fiber-web-api/internal/app/common/rbac"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 	"time"
 )
 
 // ===================================== 公共常量 =====================================
 const (
 	CachePrefix       = "go-web:login:"                                                  // 缓存前缀
-	ERROR_COUNT       = "go-web:errorCount:"                                             // 密码错误次数缓存key
+	LockoutPrefix     = "go-web:lockout:"                                                // 登录失败次数、锁定状态缓存key
+	RevokedSessions   = "go-web:revokedSessions"                                         // jwt模式下已经注销的会话（有序集合，同时是发布订阅的频道）
 	TokenHeader       = "go-web"                                                         // request请求头属性
 	Sign              = "sign"                                                           // request请求头属性
 	TokenExpire       = time.Second * 1800                                               // token默认有效期（单位秒）
@@ -19,6 +24,73 @@ const (
 	RandomCharset     = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789" // 随机字符串
 	RandomCaptcha     = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"                               // 验证码字符串
 	DATA_SCOPE        = "go-web:dataScope:"                                              // 数据范围缓存
+	TokenModeOpaque   = "opaque"                                                         // 令牌模式：随机字符串令牌，每次请求到会话存储中校验
+	TokenModeJwt      = "jwt"                                                            // 令牌模式：jwt访问令牌+刷新令牌
+	AccessTokenExpire = time.Second * 900                                                // jwt访问令牌默认有效期
+	SignNonce         = "go-web:signNonce:"                                              // 请求签名已使用的nonce缓存key
+	SignSkew          = time.Second * 120                                                // 请求签名默认允许的时间误差
+	SessionSingle     = "single"                                                         // 会话策略：每个用户只保留一个会话，新的登录会踢掉其他设备
+	SessionMax        = "max"                                                            // 会话策略：每个用户最多保留 session.max 个会话，超出时踢掉最早登录的
+	SessionUnlimited  = "unlimited"                                                      // 会话策略：不限制会话数量
+	MfaIssuer         = "go-web"                                                         // 动态验证码（TOTP）的发行方，显示在身份验证器中
+	MfaChallenge      = "go-web:mfaChallenge:"                                           // 登录时密码验证通过后，等待动态验证码的临时令牌
+	MfaChallengeTime  = time.Second * 300                                                // 等待动态验证码的有效期
+	MfaSetup          = "go-web:mfaSetup:"                                               // 绑定身份验证器时，还没有确认的密钥
+	MfaUsed           = "go-web:mfaUsed:"                                                // 已经使用过的动态验证码，防止重复使用
+	MfaRecoveryNum    = 10                                                               // 恢复码数量
+	CaptchaKey        = "go-web:captcha:"                                                // 验证码答案缓存key
+	CaptchaExpire     = time.Second * 120                                                // 验证码有效期
+	RSAKeyPath        = "./manifest/key"                                                 // RSA密钥默认保存目录
+	RSAKeyGrace       = time.Minute * 10                                                 // RSA密钥轮换后，旧密钥默认仍可以解密的时间
+	AuditArchivePath  = "./logs/archive"                                                 // 操作日志归档文件默认保存目录
+	AuditAnchorPath   = "./logs/sys_log_anchor.jsonl"                                    // 操作日志哈希链的链外锚点文件默认路径
+	LogDir            = "./logs"                                                         // 日志文件默认目录
+	LogMaxSize        = 100 << 20                                                        // 单个日志文件默认最大100MB
+	LogMaxFiles       = 30                                                               // 默认保留的日志文件数
+	AuditArchiveLock  = "go-web:auditArchive"                                            // 操作日志归档任务的锁，多实例部署时只有一个实例执行
+	RequestIdLocal    = "requestId"                                                      // c.Locals 中的请求id
+	UserIdLocal       = "userId"                                                         // c.Locals 中的当前用户id
+	LocaleLocal       = "locale"                                                         // c.Locals 中的当前用户的语言偏好
+	ClientIPLocal     = "clientIP"                                                       // c.Locals 中的客户端真实IP
+	RestrictLocal     = "restrict"                                                       // c.Locals 中的会话限制，受限会话才有
+	CorsMaxAge        = 600                                                              // 跨域预检结果默认缓存时间（秒）
+	CspReportPath     = "/sys/csp/report"                                                // CSP违规报告默认的上报地址
+	RateLimitPrefix   = "go-web:rateLimit:"                                              // 接口限流令牌桶缓存key
+)
+
+// ==================================== 接口限流类别 ====================================
+const (
+	RateLimitDefault = "default" // 普通接口
+	RateLimitStrict  = "strict"  // 容易被暴力尝试的接口（登录、验证码、动态验证码等）
+	RateLimitNone    = "none"    // 不限流（健康检查等）
+)
+
+// ==================================== 返回码 ====================================
+const (
+	CodePassword     = 1000 // 用户名、密码或动态验证码错误（返回剩余次数）
+	CodeNotLogin     = 1003 // 用户未登录或登录已过期
+	CodeLocked       = 1004 // 账号或IP已锁定
+	CodeSignMissing  = 1005 // 请求头缺少令牌或签名
+	CodeSignExpired  = 1006 // 签名时间戳超出允许的时间误差
+	CodeSignReplayed = 1007 // 重复的请求（nonce已经使用过）
+	CodeSignInvalid  = 1008 // 令牌解密或校验失败
+	CodePwdExpired   = 1009 // 密码已过期，需要修改密码
+	CodePwdChange    = 1010 // 首次登录或密码已重置，需要修改密码
+	CodeMfaRequired  = 1011 // 密码验证通过，需要输入动态验证码
+	CodeMfaEnroll    = 1012 // 当前角色必须开启双因素认证，需要先绑定身份验证器
+	CodeCaptcha      = 1013 // 需要输入验证码，或者验证码错误、已过期（需要重新获取验证码）
+	CodeKeyExpired   = 1014 // RSA公钥已过期，需要重新获取公钥后再加密
+	CodeParam        = 1015 // 参数错误或参数校验失败
+	CodeForbidden    = 1016 // 没有操作权限（包括数据权限）
+	CodeNotFound     = 1017 // 数据不存在
+	CodeExists       = 1018 // 数据已存在（名称、编码等重复）
+	CodeInUse        = 1019 // 数据正在使用（有下级、已分配等），不允许删除
+	CodeRoute        = 1020 // 接口不存在
+	CodeIllegal      = 1021 // 非法访问（IP不在白名单内）
+	CodeDecrypt      = 1022 // 数据解密失败
+	CodeMfaCode      = 1023 // 动态验证码错误（已登录用户的双因素认证操作）
+	CodePwdPolicy    = 1024 // 密码不符合安全策略
+	CodeTooMany      = 1025 // 请求过于频繁（返回需要等待的秒数）
 )
 
 // ==================================== 公共model ====================================
@@ -31,6 +103,16 @@ type BaseModel struct {
 	UpdateId   *string   `json:"updateId" form:"updateId"`
 	UpdateTime *string   `json:"updateTime" form:"updateTime"`
 	Token      string    `gorm:"-" json:"token" form:"token"` // token
+	// 请求的上下文（c.UserContext()，带有请求id、用户id），查询数据库时传给 gorm，sql日志中会带上这些字段
+	Ctx context.Context `gorm:"-" json:"-" form:"-" query:"-"`
+}
+
+// 带请求上下文的数据库连接
+func (e BaseModel) DB() *gorm.DB {
+	if e.Ctx == nil {
+		return DB
+	}
+	return DB.WithContext(e.Ctx)
 }
 
 // 统一的返回参数格式
@@ -38,6 +120,9 @@ type Result struct {
 	Code    int    `json:"code"`    // 统一的返回码，0 成功 -1 失败
 	Message string `json:"message"` // 统一的返回信息
 	Data    any    `json:"data"`    // 统一的返回数据
+	key     string // 国际化消息key，为空时返回信息不翻译
+	def     string // 消息目录中没有key时的默认消息
+	args    []any  // 消息参数
 }
 
 // 统一的树形结构格式
@@ -66,17 +151,41 @@ type Result struct {
 
 // 请求成功的默认返回
 func Success(obj any) *Result {
-	return &Result{0, "ok", obj}
+	return &Result{Code: 0, Message: "ok", Data: obj}
+}
+
+// 请求失败的默认返回，code默认为-1，message 可以是国际化消息的key
+func Error(message string, args ...any) *Result {
+	return ErrorCode(-1, message, args...)
 }
 
-// 请求失败的默认返回，code默认为-1
-func Error(message string) *Result {
-	return ErrorCode(-1, message)
+// 请求失败的默认返回，message 可以是国际化消息的key（消息目录中没有时原样返回）
+func ErrorCode(code int, message string, args ...any) *Result {
+	return &Result{Code: code, Message: i18n.Translate(i18n.Default(), message, message, args...), key: message, def: message, args: args}
 }
 
-// 请求失败的默认返回
-func ErrorCode(code int, message string) *Result {
-	return &Result{code, message, nil}
+// 按指定语言翻译返回信息
+func (r *Result) Localize(locale string) *Result {
+	if r.key != "" {
+		r.Message = i18n.Translate(locale, r.key, r.def, r.args...)
+	}
+	return r
+}
+
+// 当前请求的语言：登录用户设置的语言偏好优先（CheckToken 中设置），其次按请求头 Accept-Language 选择
+func Locale(c *fiber.Ctx) string {
+	if locale, ok := c.Locals(LocaleLocal).(string); ok && locale != "" {
+		return locale
+	}
+	return i18n.Match(c.Get(fiber.HeaderAcceptLanguage))
+}
+
+// 客户端的真实IP（经过可信反向代理的从代理请求头中取），IP黑白名单、登录锁定、日志等都使用这个IP
+func ClientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(ClientIPLocal).(string); ok && ip != "" {
+		return ip
+	}
+	return c.IP()
 }
 
 // 分页结构体封装
@@ -91,9 +200,23 @@ type CustomApi struct {
 	Method      string        // 请求方法
 	Path        string        // 接口地址
 	Description string        // 接口描述
-	Permission  string        // 权限标识（没有限制时留空，多个用 ; 号分隔，表示满足任意一个即可）
+	Auth        rbac.Level    // 鉴权级别：rbac.Public 公开、rbac.Authenticated 登录即可、rbac.Permissioned 需要权限，留空时按 Permission 判断
+	Permission  string        // 权限表达式（; 号分隔满足任意一个，& 号连接必须全部满足），只有 rbac.Permissioned 的接口需要
+	RateLimit   string        // 限流类别（RateLimitDefault 等，也可以是 rate_limit.classes 中自定义的），留空为 RateLimitDefault
+	NoAudit     bool          // 不记录操作日志（如浏览器上报的CSP违规报告）
 	HandlerFunc fiber.Handler // 请求处理函数
 }
 
+// 接口的限流类别，留空为 RateLimitDefault，对应 rate_limit.classes 中的配置
+func (api CustomApi) RateClass() string {
+	if api.RateLimit == "" {
+		return RateLimitDefault
+	}
+	return api.RateLimit
+}
+
 // 将路由信息存储到map中，path为key
 var RouteApi = map[string]CustomApi{}
+
+// 接口鉴权规则，按请求方法 + 路由路径匹配
+var RouteRules = rbac.New()
@@ -1,19 +1,30 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/go-redis/redis"
-	_ "github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm/schema"
 	"strings"
 
 	//"github.com/gofiber/fiber/v2/middleware/logger"
-	"fiber-web-api/internal/app/common/mylog"
+	"fiber-web-api/internal/app/common/cors"
+	"fiber-web-api/internal/app/common/i18n"
+	"fiber-web-api/internal/app/common/ipfilter"
+	"fiber-web-api/internal/app/common/lockout"
+	"fiber-web-api/internal/app/common/logger"
+	"fiber-web-api/internal/app/common/migrate"
+	"fiber-web-api/internal/app/common/password"
+	"fiber-web-api/internal/app/common/ratelimit"
+	"fiber-web-api/internal/app/common/rsakey"
+	"fiber-web-api/internal/app/common/secure"
+	"fiber-web-api/internal/app/common/store"
+	"fiber-web-api/internal/app/common/token"
 	"github.com/spf13/viper"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 	"time"
 	//"fiber-web-api/internal/app/common/middleware"
 	//api "fiber-web-api/internal/app/controller/sys"
@@ -26,27 +37,65 @@ var (
 	WriteTimeout   time.Duration
 	DB             *gorm.DB
 	RedisConn      *redis.Client
-	AuthHost       []string
-	AllowCorsApi   string
-	AllowedOrigins []string
+	Sessions       store.SessionStore        // 登录会话存储
+	TokenMode      string                    // 令牌模式：opaque（默认，随机字符串令牌）或 jwt
+	Tokens         *token.Signer             // jwt模式下的访问令牌签发和校验
+	Revocations    store.Revocations         // jwt模式下已经注销的会话
+	Cache          store.Cache               // 通用缓存（nonce、验证码等）
+	Lockouts       lockout.Engine            // 登录失败锁定
+	RateLimiter    ratelimit.Limiter         // 接口限流
+	RateLimitOn    bool                      // 是否开启接口限流
+	RateLimits     map[string]RateLimitClass // 每个限流类别的限制
+	RSAKeys        *rsakey.Manager           // 登录等敏感数据传输加密用的RSA密钥
+	AuditQueueSize int                       // 操作日志异步写入的队列大小
+	AuditRetention int                       // 操作日志保留天数，超过的归档后删除，0为永久保留
+	AuditArchive   string                    // 操作日志归档文件的保存目录
+	AuditChain     bool                      // 操作日志是否开启哈希链（防篡改）
+	AuditChainKey  []byte                    // 操作日志哈希链的HMAC密钥，只保存在配置中，不保存在数据库
+	AuditAnchor    string                    // 操作日志哈希链的链外锚点文件
+	SessionPolicy  string                    // 会话策略：single（默认）、max、unlimited
+	SessionLimit   int                       // 会话策略为 max 时，每个用户最多保留的会话数
+	SignEnable     bool                      // 是否开启请求签名，开启后请求头中的令牌需要用AES-GCM加密
+	SignKey        []byte                    // 请求签名的AES密钥
+	SignSkewTime   time.Duration             // 请求签名允许的时间误差
+	MfaKey         []byte                    // 双因素认证密钥（TOTP）加密保存的AES密钥，只保存在配置中，不保存在数据库
+	IPFilter       *ipfilter.Filter          // IP黑白名单
+	TrustedProxies *ipfilter.List            // 可信的反向代理
+	ProxyHeader    string                    // 反向代理传递客户端IP的请求头
+	Cors           *cors.Policy              // 跨域策略
+	Security       *secure.Policy            // 安全响应头
 	FilePath       string
 )
 
+var log = logger.Named("config")
+
 func InitConfig() (*viper.Viper, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")              // 配置文件的类型
 	viper.AddConfigPath("./manifest/config") //配置文件所在的路径
 	err := viper.ReadInConfig()
 	if err != nil {
-		log.Panic("read config file error: %v", err)
+		fatal("read config file error", err)
 	}
 	Config = viper.GetViper()
-	log.Info("config:", Config)
 	//load
+	LoadLog()
+	log.Info("config loaded", "file", viper.ConfigFileUsed())
 	LoadServer()
 	LoadMySql()
 	LoadRedis()
+	LoadStore()
+	LoadSession()
+	LoadToken()
+	LoadSign()
+	LoadMfa()
+	LoadPassword()
+	LoadRSA()
 	LoadIP()
+	LoadAudit()
+	LoadI18n()
+	LoadSecurity()
+	LoadRateLimit()
 	return Config, nil
 }
 
@@ -61,32 +110,31 @@ func LoadMySql() {
 		Config.GetInt("database.port"),
 		Config.Get("database.dbname"),
 		Config.Get("database.timeout"))
-	log.Info("", Config.Get("database.timeout"))
-	log.Info("", dsn)
-	// 设置操作数据库的日志输出到文件
-	mylogger := logger.New(
-		Writer{},
-		logger.Config{
-			SlowThreshold: time.Second, // 慢 SQL 阈值
-			LogLevel:      logger.Info, // Log level
-			Colorful:      true,        // 允许彩色打印
-		},
-	)
-
+	// 数据库的日志输出到 gorm 模块，sql 为 debug 级别，慢 sql 为 warn 级别
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: mylogger,
+		Logger: gormLogger{slowThreshold: time.Second},
 		NamingStrategy: schema.NamingStrategy{
 			SingularTable: true,
 		},
 	})
 	if err != nil {
-		log.Error("connect mysql error: ", err)
+		log.Error("connect mysql error", "host", Config.Get("database.host"), "err", err)
 	}
 	DB = db
-	log.Info("mysql connect success")
+	log.Info("mysql connect success", "host", Config.Get("database.host"), "db", Config.Get("database.dbname"))
+	// 升级数据库结构，执行还没有执行过的迁移脚本
+	if err == nil {
+		if err = migrate.Run(db); err != nil {
+			panic(fmt.Errorf("migrate database error: %v", err))
+		}
+	}
 }
 
 func LoadRedis() {
+	// 使用内存存储时不需要redis
+	if Config.GetString("store.type") == "memory" {
+		return
+	}
 	RedisConn = redis.NewClient(&redis.Options{
 		Addr:     fmt.Sprintf("%s:%d", Config.Get("redis.host"), Config.GetInt("redis.port")),
 		Password: Config.GetString("redis.pass"),
@@ -94,12 +142,217 @@ func LoadRedis() {
 	})
 }
 
+// 日志：log.level 默认级别（默认info），log.levels 按模块设置级别（如 gorm: debug），log.format 输出格式（text或json），
+// log.dir 日志目录（默认 ./logs），log.max_size 单个文件大小（MB，默认100），log.max_files 保留的文件数（默认30），
+// log.console 是否同时输出到控制台（默认是）
+func LoadLog() {
+	opts := logger.Options{
+		Level:    Config.GetString("log.level"),
+		Levels:   Config.GetStringMapString("log.levels"),
+		Format:   Config.GetString("log.format"),
+		Dir:      Config.GetString("log.dir"),
+		MaxSize:  Config.GetInt64("log.max_size") << 20,
+		MaxFiles: Config.GetInt("log.max_files"),
+		Console:  !Config.IsSet("log.console") || Config.GetBool("log.console"),
+	}
+	if opts.Dir == "" {
+		opts.Dir = LogDir
+	}
+	if !Config.IsSet("log.max_size") {
+		opts.MaxSize = LogMaxSize
+	}
+	if !Config.IsSet("log.max_files") {
+		opts.MaxFiles = LogMaxFiles
+	}
+	if err := logger.Init(opts); err != nil {
+		fatal("init log error", err)
+	}
+}
+
+// 会话等数据的存储方式：redis（默认）或 memory（本地开发、单元测试时不依赖redis）
+func LoadStore() {
+	switch Config.GetString("store.type") {
+	case "memory":
+		Sessions = store.NewMemorySessionStore(time.Minute)
+		Cache = store.NewMemoryCache(time.Minute)
+		Lockouts = lockout.NewMemoryEngine()
+		RateLimiter = ratelimit.NewMemoryLimiter(time.Minute)
+	default:
+		Sessions = store.NewRedisSessionStore(RedisConn, CachePrefix)
+		Cache = store.NewRedisCache(RedisConn)
+		Lockouts = lockout.NewRedisEngine(RedisConn, LockoutPrefix)
+		RateLimiter = ratelimit.NewRedisLimiter(RedisConn, RateLimitPrefix)
+	}
+}
+
+// 会话策略，控制同一个用户可以同时在几个设备上登录
+func LoadSession() {
+	SessionPolicy = Config.GetString("session.policy")
+	SessionLimit = Config.GetInt("session.max")
+	switch SessionPolicy {
+	case SessionMax:
+		if SessionLimit <= 0 {
+			SessionLimit = 1
+		}
+	case SessionUnlimited:
+	default:
+		SessionPolicy = SessionSingle
+	}
+}
+
+// 令牌模式，jwt 模式下登录返回短期有效的访问令牌和一次性的刷新令牌
+func LoadToken() {
+	TokenMode = Config.GetString("token.mode")
+	if TokenMode != TokenModeJwt {
+		TokenMode = TokenModeOpaque
+		return
+	}
+	expire := time.Duration(Config.GetInt("token.access_expire")) * time.Second
+	if expire <= 0 {
+		expire = AccessTokenExpire
+	}
+	issuer := Config.GetString("token.issuer")
+	if issuer == "" {
+		issuer = TokenHeader
+	}
+	var err error
+	switch Config.GetString("token.alg") {
+	case "RS256":
+		Tokens, err = token.NewRS256(Config.GetString("token.private_key"), Config.GetString("token.public_key"), issuer, expire)
+	default:
+		Tokens, err = token.NewHS256(Config.GetString("token.secret"), issuer, expire)
+	}
+	if err != nil {
+		fatal("load token config error", err)
+	}
+	// 注销的会话在访问令牌的有效期内都要拒绝，检查只在本地内存中进行，多实例之间通过redis同步
+	if Config.GetString("store.type") == "memory" {
+		Revocations = store.NewMemoryRevocations(time.Minute)
+	} else {
+		Revocations = store.NewRedisRevocations(RedisConn, RevokedSessions, time.Minute)
+	}
+}
+
+// 请求签名：sign.key 为base64编码的16、24或32字节AES密钥，sign.skew 为允许的时间误差（秒）
+func LoadSign() {
+	SignEnable = Config.GetBool("sign.enable")
+	SignSkewTime = time.Duration(Config.GetInt("sign.skew")) * time.Second
+	if SignSkewTime <= 0 {
+		SignSkewTime = SignSkew
+	}
+	if !SignEnable {
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(Config.GetString("sign.key"))
+	if err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+		fatal("load sign config error", errors.New("sign.key 必须是base64编码的16、24或32字节密钥"))
+	}
+	SignKey = key
+}
+
+// 双因素认证：mfa.key 为base64编码的32字节AES密钥，用于加密保存在数据库中的TOTP密钥。
+// 没有配置时不能使用双因素认证（绑定和校验动态验证码时返回错误），其他功能不受影响
+func LoadMfa() {
+	if Config.GetString("mfa.key") == "" {
+		log.Warn("mfa.key not set, two-factor authentication is unavailable")
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(Config.GetString("mfa.key"))
+	if err != nil || len(key) != 32 {
+		fatal("load mfa config error", errors.New("mfa.key 必须是base64编码的32字节密钥"))
+	}
+	MfaKey = key
+}
+
+// 密码策略：password.common_list 常见弱密码列表文件，每行一个（# 开头的是注释，不区分大小写），加到内置列表中。
+// 内置列表只有最常见的一百多个，生产环境建议配置更完整的列表（如 SecLists 的 10k-most-common.txt）
+func LoadPassword() {
+	path := Config.GetString("password.common_list")
+	if path == "" {
+		return
+	}
+	n, err := password.LoadCommonFile(path)
+	if err != nil {
+		fatal("load password config error", err)
+	}
+	log.Info("common password list loaded", "file", path, "count", n)
+}
+
+// RSA密钥：rsa.key_path 密钥保存目录（默认 ./manifest/key），rsa.rotate 轮换周期（小时，0不轮换），
+// rsa.grace 轮换后旧密钥仍可以解密的时间（分钟，默认10分钟）
+func LoadRSA() {
+	dir := Config.GetString("rsa.key_path")
+	if dir == "" {
+		dir = RSAKeyPath
+	}
+	grace := time.Duration(Config.GetInt("rsa.grace")) * time.Minute
+	if grace <= 0 {
+		grace = RSAKeyGrace
+	}
+	keys, err := rsakey.NewManager(dir, time.Duration(Config.GetInt("rsa.rotate"))*time.Hour, grace)
+	if err != nil {
+		fatal("load rsa key error", err)
+	}
+	keys.Start(time.Minute)
+	RSAKeys = keys
+}
+
+// IP黑白名单：ip.auth_host 白名单（为空不限制），ip.deny_host 黑名单，支持单个IP、CIDR、范围（a-b）和末尾的通配符，用 ; 号分隔；
+// ip.groups 按接口路径前缀单独设置的黑白名单（prefix、allow、deny），和全局的都通过才允许访问；
+// ip.trusted_proxies 可信的反向代理，只有直接连接的是可信代理时才从 ip.proxy_header（默认 X-Forwarded-For）中取客户端IP
 func LoadIP() {
-	ips := Config.GetString("ip.auth_host")
-	AuthHost = strings.Split(ips, ";")
-	AllowCorsApi = Config.GetString("ip.allow_cors_api")
-	origins := Config.GetString("ip.allowed_origins")
-	AllowedOrigins = strings.Split(origins, ";")
+	filter := &ipfilter.Filter{}
+	filter.Access = loadAccess("ip", Config.GetString("ip.auth_host"), Config.GetString("ip.deny_host"))
+	var groups []struct {
+		Prefix string
+		Allow  string
+		Deny   string
+	}
+	if err := Config.UnmarshalKey("ip.groups", &groups); err != nil {
+		fatal("load ip.groups error", err)
+	}
+	for _, g := range groups {
+		if !strings.HasPrefix(g.Prefix, "/") {
+			fatal("load ip.groups error", fmt.Errorf("prefix must start with /: %q", g.Prefix))
+		}
+		filter.Groups = append(filter.Groups, ipfilter.Group{Prefix: g.Prefix, Access: loadAccess("ip.groups "+g.Prefix, g.Allow, g.Deny)})
+	}
+	IPFilter = filter
+	proxies, err := ipfilter.ParseString(Config.GetString("ip.trusted_proxies"))
+	if err != nil {
+		fatal("load ip.trusted_proxies error", err)
+	}
+	TrustedProxies = proxies
+	ProxyHeader = Config.GetString("ip.proxy_header")
+	if ProxyHeader == "" {
+		ProxyHeader = fiber.HeaderXForwardedFor
+	}
+	LoadCors()
+}
+
+// 跨域：ip.allowed_origins 允许的来源（; 号分隔，支持 https://*.example.com 和 *），为空时不允许跨域；
+// ip.allow_cors_api 按接口路径单独设置的来源（路径=来源,来源，多个用 ; 号分隔），ip.cors_max_age 预检结果缓存时间（秒，默认600）
+func LoadCors() {
+	origins, err := cors.ParseOrigins(strings.Split(Config.GetString("ip.allowed_origins"), ";"))
+	if err != nil {
+		fatal("load ip.allowed_origins error", err)
+	}
+	overrides, err := cors.ParseOverrides(Config.GetString("ip.allow_cors_api"))
+	if err != nil {
+		fatal("load ip.allow_cors_api error", err)
+	}
+	maxAge := CorsMaxAge
+	if Config.IsSet("ip.cors_max_age") {
+		maxAge = Config.GetInt("ip.cors_max_age")
+	}
+	Cors = &cors.Policy{
+		Origins:   origins,
+		Overrides: overrides,
+		Methods:   []string{fiber.MethodGet, fiber.MethodPost, fiber.MethodPut, fiber.MethodDelete, fiber.MethodOptions},
+		Headers:   []string{fiber.HeaderContentType, fiber.HeaderAcceptLanguage, fiber.HeaderXRequestedWith, fiber.HeaderXRequestID, TokenHeader, Sign},
+		Expose:    []string{TokenHeader, fiber.HeaderXRequestID, fiber.HeaderRetryAfter},
+		MaxAge:    maxAge,
+	}
 }
 
 func LoadServer() {
@@ -109,11 +362,132 @@ func LoadServer() {
 	FilePath = Config.GetString("filePath")
 }
 
-type Writer struct {
+// 操作日志：audit.queue_size 异步写入的队列大小（默认1000），audit.retention_days 保留天数（0永久保留），
+// audit.archive_path 归档目录（默认 ./logs/archive），audit.chain 是否开启哈希链，
+// audit.chain_key 哈希链的HMAC密钥（base64编码，至少32字节，开启哈希链时必填），
+// audit.anchor_path 链外锚点文件（默认 ./logs/sys_log_anchor.jsonl），定时记录链头，不要和数据库放在一起
+func LoadAudit() {
+	AuditQueueSize = Config.GetInt("audit.queue_size")
+	if AuditQueueSize <= 0 {
+		AuditQueueSize = 1000
+	}
+	AuditRetention = Config.GetInt("audit.retention_days")
+	AuditArchive = Config.GetString("audit.archive_path")
+	if AuditArchive == "" {
+		AuditArchive = AuditArchivePath
+	}
+	AuditChain = Config.GetBool("audit.chain")
+	AuditAnchor = Config.GetString("audit.anchor_path")
+	if AuditAnchor == "" {
+		AuditAnchor = AuditAnchorPath
+	}
+	if !AuditChain {
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(Config.GetString("audit.chain_key"))
+	if err != nil || len(key) < 32 {
+		fatal("load audit config error", errors.New("audit.chain_key 必须是base64编码的至少32字节密钥"))
+	}
+	AuditChainKey = key
+}
+
+// 国际化：i18n.default_locale 默认语言（默认 zh-CN），请求没有指定语言或者指定的语言不支持时使用
+func LoadI18n() {
+	if locale := Config.GetString("i18n.default_locale"); locale != "" && !i18n.SetDefault(locale) {
+		log.Warn("unsupported i18n.default_locale, using default", "locale", locale, "default", i18n.Default())
+	}
+	// 错误目录中的消息在所有语言中都要有，缺少时返回默认语言的消息
+	for _, e := range AppErrors() {
+		if missing := i18n.Missing(e.Key); len(missing) > 0 {
+			log.Warn("i18n message missing", "key", e.Key, "locales", missing)
+		}
+	}
+}
+
+func loadAccess(name, allow, deny string) ipfilter.Access {
+	allowList, err := ipfilter.ParseString(allow)
+	if err != nil {
+		fatal("load "+name+" allow list error", err)
+	}
+	denyList, err := ipfilter.ParseString(deny)
+	if err != nil {
+		fatal("load "+name+" deny list error", err)
+	}
+	return ipfilter.Access{Allow: allowList, Deny: denyList}
+}
+
+// 安全响应头：security.headers 响应头（名称: 值，覆盖默认值，值为空时不输出），
+// security.csp.policy CSP策略，security.csp.report_only 只上报不拦截，security.csp.report_uri 违规报告上报地址（默认 /sys/csp/report，设置为空时不上报），
+// security.routes 按接口路径覆盖的响应头（path、headers，path 以 * 结尾时按前缀匹配）
+func LoadSecurity() {
+	csp := secure.CSP{
+		Policy:     Config.GetString("security.csp.policy"),
+		ReportOnly: Config.GetBool("security.csp.report_only"),
+		ReportURI:  CspReportPath,
+	}
+	if Config.IsSet("security.csp.report_uri") {
+		csp.ReportURI = Config.GetString("security.csp.report_uri")
+	}
+	var routes []secure.Route
+	if err := Config.UnmarshalKey("security.routes", &routes); err != nil {
+		fatal("load security.routes error", err)
+	}
+	for _, r := range routes {
+		if !strings.HasPrefix(r.Path, "/") {
+			fatal("load security.routes error", fmt.Errorf("path must start with /: %q", r.Path))
+		}
+	}
+	Security = secure.New(Config.GetStringMapString("security.headers"), csp, routes)
+}
+
+// 一个限流类别按IP和按登录用户的限制，令牌桶按 类型+类别+接口分组+IP或用户id 区分
+type RateLimitClass struct {
+	IP   ratelimit.Limit
+	User ratelimit.Limit
+}
+
+// 默认的限流类别
+var defaultRateLimits = map[string][2]string{
+	RateLimitDefault: {"1200/m", "600/m"},
+	RateLimitStrict:  {"20/m", "20/m"},
+	RateLimitNone:    {"", ""},
+}
+
+// 接口限流：rate_limit.enable 是否开启（默认开启），rate_limit.classes.<类别>.ip、rate_limit.classes.<类别>.user
+// 按IP、按用户的限制（次数/单位[,突发数]，单位 s、m、h，为空或0不限制），可以覆盖默认的类别，也可以自定义类别
+func LoadRateLimit() {
+	RateLimitOn = !Config.IsSet("rate_limit.enable") || Config.GetBool("rate_limit.enable")
+	limits := map[string][2]string{}
+	for name, l := range defaultRateLimits {
+		limits[name] = l
+	}
+	for name := range Config.GetStringMap("rate_limit.classes") {
+		l := limits[name]
+		if key := "rate_limit.classes." + name + ".ip"; Config.IsSet(key) {
+			l[0] = Config.GetString(key)
+		}
+		if key := "rate_limit.classes." + name + ".user"; Config.IsSet(key) {
+			l[1] = Config.GetString(key)
+		}
+		limits[name] = l
+	}
+	RateLimits = map[string]RateLimitClass{}
+	for name, l := range limits {
+		ip, err := ratelimit.ParseLimit(l[0])
+		if err != nil {
+			fatal("load rate_limit.classes."+name+".ip error", err)
+		}
+		user, err := ratelimit.ParseLimit(l[1])
+		if err != nil {
+			fatal("load rate_limit.classes."+name+".user error", err)
+		}
+		RateLimits[name] = RateLimitClass{ip, user}
+	}
 }
 
-func (w Writer) Printf(format string, args ...interface{}) {
-	msg := fmt.Sprintf(format, args...) + "\n"
-	fmt.Println(msg)
-	mylog.LogOut(msg)
+// 配置加载失败，记录日志后退出
+func fatal(msg string, err error) {
+	log.Error(msg, "err", err)
+	logger.Sync()
+	panic(fmt.Errorf("%s: %w", msg, err))
 }
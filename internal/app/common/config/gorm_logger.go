@@ -0,0 +1,55 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fiber-web-api/internal/app/common/logger"
+	"fmt"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"log/slog"
+	"time"
+)
+
+var gormLog = logger.Named("gorm")
+
+// 数据库日志，输出到 gorm 模块（级别通过 log.levels.gorm 设置）。
+// 执行的 sql 为 debug 级别，慢 sql 为 warn 级别，执行出错的为 error 级别（查不到数据的不算）
+type gormLogger struct {
+	slowThreshold time.Duration // 慢 sql 阈值
+}
+
+// 级别由 gorm 模块的日志级别控制，这里忽略
+func (l gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, args ...any) {
+	gormLog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, args ...any) {
+	gormLog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, args ...any) {
+	gormLog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		gormLog.ErrorContext(ctx, "sql error", "sql", sql, "rows", rows, "elapsed", elapsed, "err", err)
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold:
+		sql, rows := fc()
+		gormLog.WarnContext(ctx, "slow sql", "sql", sql, "rows", rows, "elapsed", elapsed)
+	default:
+		if !gormLog.Enabled(ctx, slog.LevelDebug) {
+			return // 不输出 debug 日志时不拼接 sql
+		}
+		sql, rows := fc()
+		gormLog.DebugContext(ctx, "sql", "sql", sql, "rows", rows, "elapsed", elapsed)
+	}
+}
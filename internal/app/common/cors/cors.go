@@ -0,0 +1,142 @@
+// ------------------------------------------------------------------------
+// ------------------------       跨域（CORS）       ------------------------
+// ------------------------------------------------------------------------
+
+package cors
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// 允许跨域的来源，每一项可以是：
+//   - 完整的来源：https://admin.example.com、http://localhost:8080
+//   - 子域名通配：https://*.example.com（不匹配 https://example.com 本身）
+//   - *：所有来源（匹配时原样返回请求的来源，但不允许携带凭证）
+type Origins struct {
+	any      bool
+	exact    map[string]struct{}
+	wildcard [][2]string // scheme://*. 之前和之后的部分
+}
+
+func ParseOrigins(list []string) (Origins, error) {
+	o := Origins{exact: map[string]struct{}{}}
+	for _, origin := range list {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		switch {
+		case origin == "":
+		case origin == "*":
+			o.any = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "://*.")
+			if scheme == "" || host == "" || strings.Contains(host, "*") {
+				return o, fmt.Errorf("invalid cors origin %q", origin)
+			}
+			o.wildcard = append(o.wildcard, [2]string{strings.ToLower(scheme) + "://", "." + strings.ToLower(host)})
+		default:
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+				return o, fmt.Errorf("invalid cors origin %q", origin)
+			}
+			o.exact[strings.ToLower(origin)] = struct{}{}
+		}
+	}
+	return o, nil
+}
+
+// 是否允许所有来源
+func (o Origins) Any() bool {
+	return o.any
+}
+
+// 是否允许该来源，来源比较时忽略大小写
+func (o Origins) Allowed(origin string) bool {
+	if origin == "" || origin == "null" {
+		return false
+	}
+	if o.any {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := o.exact[origin]; ok {
+		return true
+	}
+	for _, w := range o.wildcard {
+		if strings.HasPrefix(origin, w[0]) && strings.HasSuffix(origin, w[1]) && len(origin) > len(w[0])+len(w[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按接口路径单独设置的来源，路径以 * 结尾时按前缀匹配
+type Override struct {
+	Path    string
+	Origins Origins
+}
+
+// 路由不区分大小写、忽略末尾的 /（fiber 默认配置），所以匹配前统一转小写并去掉末尾的 /，
+// 否则 /SYS/Dict/getByTypeCode/ 会路由到同一个接口却使用默认的来源
+func (o Override) match(path string) bool {
+	path = normalize(path)
+	if prefix, ok := strings.CutSuffix(o.Path, "*"); ok {
+		return strings.HasPrefix(path+"/", strings.ToLower(prefix))
+	}
+	return path == normalize(o.Path)
+}
+
+func normalize(path string) string {
+	return strings.ToLower(strings.TrimRight(path, "/"))
+}
+
+// 跨域策略
+type Policy struct {
+	Origins   Origins    // 默认允许的来源
+	Overrides []Override // 按路径单独设置的来源，匹配多个时使用最长的
+	Methods   []string   // 预检请求返回的允许的方法
+	Headers   []string   // 预检请求返回的允许的请求头
+	Expose    []string   // 允许前端读取的响应头
+	MaxAge    int        // 预检结果的缓存时间（秒）
+}
+
+// 解析按路径单独设置的来源，多个用 ; 号分隔，格式为 路径=来源,来源，只有路径时允许所有来源，
+// 例如 /open/*=*;/sys/dict/getByTypeCode=https://a.example.com,https://b.example.com
+func ParseOverrides(s string) ([]Override, error) {
+	var list []Override
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path, origins, ok := strings.Cut(entry, "=")
+		path = strings.TrimSpace(path)
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid cors api %q: path must start with /", entry)
+		}
+		if !ok {
+			origins = "*"
+		}
+		o, err := ParseOrigins(strings.Split(origins, ","))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, Override{Path: path, Origins: o})
+	}
+	return list, nil
+}
+
+// 该路径允许的来源
+func (p *Policy) Match(path string) Origins {
+	var match *Override
+	for i := range p.Overrides {
+		o := &p.Overrides[i]
+		if o.match(path) && (match == nil || len(o.Path) > len(match.Path)) {
+			match = o
+		}
+	}
+	if match != nil {
+		return match.Origins
+	}
+	return p.Origins
+}
@@ -0,0 +1,76 @@
+package cors
+
+import "testing"
+
+func mustOverrides(t *testing.T, s string) []Override {
+	t.Helper()
+	list, err := ParseOverrides(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestOrigins(t *testing.T) {
+	o, err := ParseOrigins([]string{"https://admin.example.com/", "https://*.example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://admin.example.com", true},
+		{"HTTPS://Admin.Example.com", true},
+		{"http://admin.example.com", false},
+		{"https://a.example.org", true},
+		{"https://example.org", false},
+		{"null", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := o.Allowed(tt.origin); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"admin.example.com", "https://*.*.com", "https://a.com/path"} {
+		if _, err := ParseOrigins([]string{bad}); err == nil {
+			t.Errorf("%q should be invalid", bad)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	def, _ := ParseOrigins([]string{"https://admin.example.com"})
+	p := &Policy{
+		Origins:   def,
+		Overrides: mustOverrides(t, "/open/*=*;/sys/dict/getByTypeCode=https://a.example.com;/open/private=https://b.example.com"),
+	}
+	tests := []struct {
+		path   string
+		origin string
+		want   bool
+	}{
+		{"/sys/user/list", "https://admin.example.com", true},
+		{"/sys/user/list", "https://a.example.com", false},
+		{"/sys/dict/getByTypeCode", "https://a.example.com", true},
+		{"/sys/dict/getByTypeCode", "https://admin.example.com", false},
+		// 大小写和末尾的 / 不影响匹配，不能绕过按路径单独设置的来源
+		{"/SYS/Dict/GetByTypeCode", "https://admin.example.com", false},
+		{"/sys/dict/getByTypeCode/", "https://admin.example.com", false},
+		{"/sys/dict/getByTypeCode/", "https://a.example.com", true},
+		{"/open/x", "https://any.example.net", true},
+		{"/OPEN/x/", "https://any.example.net", true},
+		// 最长的优先
+		{"/open/private", "https://any.example.net", false},
+		{"/Open/Private/", "https://b.example.com", true},
+	}
+	for _, tt := range tests {
+		if got := p.Match(tt.path).Allowed(tt.origin); got != tt.want {
+			t.Errorf("Match(%q).Allowed(%q) = %v, want %v", tt.path, tt.origin, got, tt.want)
+		}
+	}
+	if _, err := ParseOverrides("open/*=*"); err == nil {
+		t.Error("path without leading / should be invalid")
+	}
+}
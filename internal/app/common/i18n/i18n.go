@@ -0,0 +1,209 @@
+// ------------------------------------------------------------------------
+// ------------------------       国际化消息       ------------------------
+// ------------------------------------------------------------------------
+
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	ZhCN = "zh-CN" // 简体中文
+	EnUS = "en-US" // 英文
+
+	separatorKey = "list.separator" // 多条消息的分隔符
+)
+
+// 消息目录，每种语言一个文件，文件名为语言代码，内容为 key -> 消息（fmt 格式，可以带 %s、%d 等参数）
+//
+//go:embed locales/*.json
+var files embed.FS
+
+var (
+	catalogs  = map[string]map[string]string{}
+	supported []string
+	fallback  atomic.Value // 默认语言
+)
+
+func init() {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		messages := map[string]string{}
+		if err = json.Unmarshal(data, &messages); err != nil {
+			panic("invalid locale file " + entry.Name() + ": " + err.Error())
+		}
+		locale := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		catalogs[locale] = messages
+		supported = append(supported, locale)
+	}
+	fallback.Store(ZhCN)
+}
+
+// 支持的语言
+func Supported() []string {
+	return append([]string(nil), supported...)
+}
+
+// 默认语言：请求没有指定语言或者指定的语言不支持时使用
+func Default() string {
+	return fallback.Load().(string)
+}
+
+// 设置默认语言，不支持的语言返回 false
+func SetDefault(locale string) bool {
+	if locale = Normalize(locale); locale == "" {
+		return false
+	}
+	fallback.Store(locale)
+	return true
+}
+
+// 规范化语言代码：忽略大小写，支持 zh_CN 写法，只有语言没有地区的（如 en）匹配同语言的第一个，不支持的返回空字符串
+func Normalize(tag string) string {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return ""
+	}
+	for _, locale := range supported {
+		if strings.EqualFold(locale, tag) {
+			return locale
+		}
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	for _, locale := range supported {
+		if l, _, _ := strings.Cut(locale, "-"); strings.EqualFold(l, lang) {
+			return locale
+		}
+	}
+	return ""
+}
+
+// 按请求头 Accept-Language 选择语言（按 q 值从高到低），都不支持时返回默认语言
+func Match(acceptLanguage string) string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		t := tag{strings.TrimSpace(name), 1}
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(v, 64); err == nil {
+				t.q = q
+			}
+		}
+		if t.name != "" && t.q > 0 {
+			tags = append(tags, t)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	for _, t := range tags {
+		if t.name == "*" {
+			break
+		}
+		if locale := Normalize(t.name); locale != "" {
+			return locale
+		}
+	}
+	return Default()
+}
+
+// 翻译消息：先找指定语言，再找默认语言，都没有时使用 def（def 为空时使用 key）。
+// 参数中的 Msg、List 按同一种语言翻译
+func Translate(locale, key, def string, args ...any) string {
+	format, ok := lookup(locale, key)
+	if !ok {
+		format = def
+		if format == "" {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, localize(locale, args)...)
+}
+
+// 没有配置指定 key 的语言，用于启动时检查消息目录是否齐全
+func Missing(key string) []string {
+	var list []string
+	for _, locale := range supported {
+		if _, ok := catalogs[locale][key]; !ok {
+			list = append(list, locale)
+		}
+	}
+	return list
+}
+
+func lookup(locale, key string) (string, bool) {
+	if format, ok := catalogs[locale][key]; ok {
+		return format, true
+	}
+	format, ok := catalogs[Default()][key]
+	return format, ok
+}
+
+func localize(locale string, args []any) []any {
+	list := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case Msg:
+			list[i] = v.Localize(locale)
+		case List:
+			list[i] = v.Localize(locale)
+		default:
+			list[i] = arg
+		}
+	}
+	return list
+}
+
+// 可以翻译的消息，作为其他消息的参数时（如“%s已存在”中的字段名称）按同一种语言翻译
+type Msg struct {
+	Key  string
+	Args []any
+}
+
+func M(key string, args ...any) Msg {
+	return Msg{Key: key, Args: args}
+}
+
+func (m Msg) Localize(locale string) string {
+	return Translate(locale, m.Key, "", m.Args...)
+}
+
+// 默认语言的消息
+func (m Msg) String() string {
+	return m.Localize(Default())
+}
+
+// 多条消息，按语言的分隔符连接
+type List []Msg
+
+func (l List) Localize(locale string) string {
+	list := make([]string, len(l))
+	for i, m := range l {
+		list[i] = m.Localize(locale)
+	}
+	return strings.Join(list, Translate(locale, separatorKey, ", "))
+}
+
+func (l List) String() string {
+	return l.Localize(Default())
+}
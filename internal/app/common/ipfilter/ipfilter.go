@@ -0,0 +1,203 @@
+// ------------------------------------------------------------------------
+// ------------------------       IP黑白名单       ------------------------
+// ------------------------------------------------------------------------
+
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// IP列表，配置加载时编译好，匹配时不再解析
+type List struct {
+	all      bool
+	prefixes []netip.Prefix
+	ranges   [][2]netip.Addr
+}
+
+// 解析IP列表，每一项可以是：
+//   - 单个IP：192.168.1.10、2001:db8::1
+//   - CIDR：10.0.0.0/8、2001:db8::/32
+//   - 范围：192.168.1.10-192.168.1.50
+//   - 末尾的通配符（兼容旧配置，只支持IPv4）：10.1.*、10.1.*.*
+//   - *：所有IP
+func Parse(entries []string) (*List, error) {
+	l := &List{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if err := l.add(entry); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// 解析用 ; , 或空白分隔的IP列表
+func ParseString(s string) (*List, error) {
+	return Parse(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' ' || r == '\t' || r == '\n'
+	}))
+}
+
+func (l *List) add(entry string) error {
+	switch {
+	case entry == "*":
+		l.all = true
+	case strings.Contains(entry, "/"):
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return fmt.Errorf("invalid cidr %q: %w", entry, err)
+		}
+		l.prefixes = append(l.prefixes, unmapPrefix(prefix.Masked()))
+	case strings.Contains(entry, "-"):
+		from, to, _ := strings.Cut(entry, "-")
+		start, err1 := netip.ParseAddr(strings.TrimSpace(from))
+		end, err2 := netip.ParseAddr(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("invalid ip range %q", entry)
+		}
+		start, end = start.Unmap(), end.Unmap()
+		if start.Is4() != end.Is4() || start.Compare(end) > 0 {
+			return fmt.Errorf("invalid ip range %q", entry)
+		}
+		l.ranges = append(l.ranges, [2]netip.Addr{start, end})
+	case strings.Contains(entry, "*"):
+		prefix, err := wildcard(entry)
+		if err != nil {
+			return err
+		}
+		l.prefixes = append(l.prefixes, prefix)
+	default:
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return fmt.Errorf("invalid ip %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		l.prefixes = append(l.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return nil
+}
+
+// 10.1.* 转换为 10.1.0.0/16，通配符只能在末尾
+func wildcard(entry string) (netip.Prefix, error) {
+	parts := strings.Split(entry, ".")
+	if len(parts) > 4 {
+		return netip.Prefix{}, fmt.Errorf("invalid ip wildcard %q", entry)
+	}
+	var octets [4]byte
+	fixed := 0
+	for i, part := range parts {
+		if part == "*" {
+			continue
+		}
+		if fixed != i {
+			return netip.Prefix{}, fmt.Errorf("invalid ip wildcard %q: * must be at the end", entry)
+		}
+		n, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid ip wildcard %q", entry)
+		}
+		octets[i] = byte(n)
+		fixed++
+	}
+	return netip.PrefixFrom(netip.AddrFrom4(octets), fixed*8), nil
+}
+
+func unmapPrefix(p netip.Prefix) netip.Prefix {
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p
+}
+
+// 是否为空（没有配置任何IP）
+func (l *List) Empty() bool {
+	return l == nil || (!l.all && len(l.prefixes) == 0 && len(l.ranges) == 0)
+}
+
+// IP是否在列表中，IPv4映射的IPv6地址（::ffff:1.2.3.4）按IPv4匹配
+func (l *List) Contains(addr netip.Addr) bool {
+	if l == nil || !addr.IsValid() {
+		return false
+	}
+	if l.all {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	for _, r := range l.ranges {
+		if addr.Is4() == r[0].Is4() && addr.Compare(r[0]) >= 0 && addr.Compare(r[1]) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 黑白名单：黑名单优先，白名单为空时不限制
+type Access struct {
+	Allow *List
+	Deny  *List
+}
+
+func (a Access) Allowed(addr netip.Addr) bool {
+	if a.Deny.Contains(addr) {
+		return false
+	}
+	return a.Allow.Empty() || a.Allow.Contains(addr)
+}
+
+// 按接口路径前缀单独设置的黑白名单（如管理接口只允许办公网访问）
+type Group struct {
+	Prefix string
+	Access
+}
+
+// 全局的黑白名单 + 接口分组的黑白名单，分组只匹配最长的前缀，两者都通过才允许访问
+type Filter struct {
+	Access
+	Groups []Group
+}
+
+func (f *Filter) Allowed(path string, addr netip.Addr) bool {
+	if !f.Access.Allowed(addr) {
+		return false
+	}
+	if g := f.group(path); g != nil {
+		return g.Allowed(addr)
+	}
+	return true
+}
+
+// 按路径段匹配前缀：/sys/safe 匹配 /sys/safe、/sys/safe/update，不匹配 /sys/safeXxx。
+// 路由不区分大小写、忽略末尾的 /（fiber 默认配置），所以匹配前统一转小写并去掉末尾的 /，
+// 否则 /SYS/Safe/update/ 会路由到 /sys/safe/update 却绕过分组的黑白名单
+func (f *Filter) group(path string) *Group {
+	path = normalize(path)
+	var match *Group
+	var matchLen int
+	for i := range f.Groups {
+		g := &f.Groups[i]
+		prefix := normalize(g.Prefix)
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if match == nil || len(prefix) > matchLen {
+			match, matchLen = g, len(prefix)
+		}
+	}
+	return match
+}
+
+func normalize(path string) string {
+	return strings.ToLower(strings.TrimRight(path, "/"))
+}
@@ -0,0 +1,78 @@
+package ipfilter
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func mustParse(t *testing.T, s string) *List {
+	t.Helper()
+	l, err := ParseString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestFilterGroups(t *testing.T) {
+	f := &Filter{
+		Access: Access{Allow: mustParse(t, ""), Deny: mustParse(t, "203.0.113.9")},
+		Groups: []Group{
+			{Prefix: "/sys/safe", Access: Access{Allow: mustParse(t, "10.0.0.0/8"), Deny: mustParse(t, "")}},
+			{Prefix: "/sys/safe/update/", Access: Access{Allow: mustParse(t, "10.1.0.0/16"), Deny: mustParse(t, "")}},
+		},
+	}
+	office := netip.MustParseAddr("10.2.0.1")
+	admin := netip.MustParseAddr("10.1.0.1")
+	public := netip.MustParseAddr("198.51.100.1")
+	tests := []struct {
+		path string
+		addr netip.Addr
+		want bool
+	}{
+		{"/sys/user/list", public, true},
+		{"/sys/user/list", netip.MustParseAddr("203.0.113.9"), false},
+		{"/sys/safeXxx", public, true},
+		{"/sys/safe", public, false},
+		{"/sys/safe/getSafeSet", office, true},
+		{"/sys/safe/getSafeSet", public, false},
+		// 大小写和末尾的 / 不影响匹配（路由不区分大小写、不严格匹配末尾的 /）
+		{"/SYS/Safe/getSafeSet", public, false},
+		{"/sys/safe/", public, false},
+		{"/sys/safe//", public, false},
+		// 最长的前缀优先
+		{"/sys/safe/update", office, false},
+		{"/sys/safe/update", admin, true},
+		{"/SYS/SAFE/UPDATE/", office, false},
+	}
+	for _, tt := range tests {
+		if got := f.Allowed(tt.path, tt.addr); got != tt.want {
+			t.Errorf("Allowed(%q, %s) = %v, want %v", tt.path, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	l := mustParse(t, "192.168.1.10;10.0.0.0/8;172.16.0.1-172.16.0.20;192.168.2.*;::1")
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"192.168.1.10", true},
+		{"192.168.1.11", false},
+		{"10.200.1.1", true},
+		{"172.16.0.20", true},
+		{"172.16.0.21", false},
+		{"192.168.2.254", true},
+		{"::1", true},
+		{"::ffff:10.0.0.1", true},
+	}
+	for _, tt := range tests {
+		if got := l.Contains(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+	if _, err := ParseString("10.0.0.300"); err == nil {
+		t.Error("invalid address should fail")
+	}
+}
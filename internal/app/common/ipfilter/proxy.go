@@ -0,0 +1,40 @@
+package ipfilter
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// 获取客户端的真实IP：只有直接连接的是可信代理时才读取代理请求头（如 X-Forwarded-For），
+// 从右往左跳过可信代理，第一个不可信的就是客户端IP（最左边的可以被客户端伪造，不能直接取）。
+// 请求头中有格式错误的，使用最后一个可信代理的IP
+func ClientIP(remote netip.Addr, header string, trusted *List) netip.Addr {
+	remote = remote.Unmap()
+	if header == "" || !trusted.Contains(remote) {
+		return remote
+	}
+	ips := strings.Split(header, ",")
+	for i := len(ips) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(ips[i])
+		if !ok {
+			break
+		}
+		remote = addr
+		if !trusted.Contains(addr) {
+			break
+		}
+	}
+	return remote
+}
+
+// 支持带端口的格式：1.2.3.4:8080、[2001:db8::1]:8080
+func parseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
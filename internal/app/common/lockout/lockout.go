@@ -0,0 +1,87 @@
+// ------------------------------------------------------------------------
+// ------------------------       登录失败锁定       ------------------------
+// ------------------------------------------------------------------------
+
+package lockout
+
+import (
+	"sort"
+	"time"
+)
+
+// 锁定对象的类型
+const (
+	KindUser = "user" // 账号
+	KindIP   = "ip"   // IP
+)
+
+// 锁定规则
+type Policy struct {
+	MaxAttempts  int           // 连续失败多少次后锁定
+	LockDuration time.Duration // 第一次锁定的时长，之后每次锁定时长翻倍
+	MaxDuration  time.Duration // 锁定时长的上限，小于 LockDuration 时锁定时长不递增
+	Window       time.Duration // 最后一次失败或锁定结束后，超过这个时间没有再失败的，失败次数和锁定次数清零
+}
+
+func (p Policy) maxDuration() time.Duration {
+	return max(p.MaxDuration, p.LockDuration)
+}
+
+// 锁定时长：第 locks 次锁定时为 LockDuration * 2^(locks-1)，不超过上限
+func (p Policy) duration(locks int) time.Duration {
+	d, limit := p.LockDuration, p.maxDuration()
+	for i := 1; i < locks && d < limit; i++ {
+		d *= 2
+	}
+	return min(d, limit)
+}
+
+// 锁定状态
+type State struct {
+	Kind        string    `json:"kind"`        // 类型：user 账号，ip IP
+	Subject     string    `json:"subject"`     // 账号或IP
+	Failures    int       `json:"failures"`    // 当前连续失败次数（锁定后清零）
+	Locks       int       `json:"locks"`       // 已经锁定的次数，用于递增锁定时长
+	LockedUntil time.Time `json:"lockedUntil"` // 锁定截止时间，零值表示没有锁定过
+	LastFailure time.Time `json:"lastFailure"` // 最后一次失败的时间
+}
+
+// 是否锁定中
+func (s State) Locked() bool {
+	return time.Now().Before(s.LockedUntil)
+}
+
+// 剩余锁定时长
+func (s State) Remaining() time.Duration {
+	if d := time.Until(s.LockedUntil); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// 锁定引擎，计数和锁定都是原子操作，可以是 redis，也可以是内存（单元测试、单实例部署）
+type Engine interface {
+	// 获取状态，没有失败记录时返回零值
+	Get(kind, subject string) (State, error)
+	// 记录一次失败，达到次数时锁定，返回记录后的状态。锁定中的不再计数，counted 返回 false。
+	// 登录时在校验之前调用，先占用一次尝试次数，这样并发的请求也不会超过次数限制
+	Fail(kind, subject string, p Policy) (state State, counted bool, err error)
+	// 撤销 Fail 记录的一次失败（校验通过时归还占用的次数），at 为 Fail 返回的 LastFailure。
+	// 这次失败触发了锁定的，同时解除这次锁定
+	Release(kind, subject string, p Policy, at time.Time) error
+	// 清除失败记录和锁定状态（登录成功、管理员解锁）
+	Clear(kind, subject string) error
+	// 所有有失败记录或锁定中的对象，锁定中的排在前面
+	List() ([]State, error)
+}
+
+// 锁定中的排在前面，其余按最后一次失败时间倒序
+func sortStates(list []State) {
+	sort.Slice(list, func(i, j int) bool {
+		li, lj := list[i].Locked(), list[j].Locked()
+		if li != lj {
+			return li
+		}
+		return list[i].LastFailure.After(list[j].LastFailure)
+	})
+}
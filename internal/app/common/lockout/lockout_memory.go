@@ -0,0 +1,112 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// 内存锁定引擎，用于本地开发和单元测试（多实例部署时不可用）
+type MemoryEngine struct {
+	mu     sync.Mutex
+	states map[string]*memoryState
+}
+
+type memoryState struct {
+	state    State
+	expireAt time.Time
+}
+
+func NewMemoryEngine() *MemoryEngine {
+	return &MemoryEngine{states: map[string]*memoryState{}}
+}
+
+func (m *MemoryEngine) Get(kind, subject string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if item := m.get(kind, subject); item != nil {
+		return item.state, nil
+	}
+	return State{}, nil
+}
+
+func (m *MemoryEngine) Fail(kind, subject string, p Policy) (State, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	item := m.get(kind, subject)
+	if item == nil {
+		item = &memoryState{state: State{Kind: kind, Subject: subject}}
+		m.states[member(kind, subject)] = item
+	}
+	if now.Before(item.state.LockedUntil) {
+		return item.state, false, nil
+	}
+	item.state.Failures++
+	if item.state.Failures >= p.MaxAttempts {
+		item.state.Locks++
+		item.state.Failures = 0
+		item.state.LockedUntil = now.Add(p.duration(item.state.Locks))
+	}
+	item.state.LastFailure = now
+	item.expireAt = now.Add(p.Window)
+	if now.Before(item.state.LockedUntil) {
+		item.expireAt = item.state.LockedUntil.Add(p.Window)
+	}
+	return item.state, true, nil
+}
+
+func (m *MemoryEngine) Release(kind, subject string, p Policy, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item := m.get(kind, subject)
+	if item == nil {
+		return nil
+	}
+	s := &item.state
+	if s.Failures > 0 {
+		s.Failures--
+	} else if s.Locks > 0 && s.LastFailure.UnixMilli() == at.UnixMilli() && time.Now().Before(s.LockedUntil) {
+		// 这次失败触发的锁定
+		s.Locks--
+		s.Failures = max(p.MaxAttempts-1, 0)
+		s.LockedUntil = time.Time{}
+		item.expireAt = time.Now().Add(p.Window)
+	}
+	return nil
+}
+
+func (m *MemoryEngine) Clear(kind, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, member(kind, subject))
+	return nil
+}
+
+func (m *MemoryEngine) List() ([]State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]State, 0, len(m.states))
+	for key, item := range m.states {
+		if time.Now().After(item.expireAt) {
+			delete(m.states, key)
+			continue
+		}
+		list = append(list, item.state)
+	}
+	sortStates(list)
+	return list, nil
+}
+
+// 获取没有过期的状态，需要在加锁后调用
+func (m *MemoryEngine) get(kind, subject string) *memoryState {
+	key := member(kind, subject)
+	item, ok := m.states[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(item.expireAt) {
+		delete(m.states, key)
+		return nil
+	}
+	return item
+}
@@ -0,0 +1,162 @@
+package lockout
+
+import (
+	"errors"
+	"github.com/go-redis/redis"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 在一个脚本中完成判断、计数和锁定，避免并发请求越过次数限制
+// KEYS[1] 状态hash，KEYS[2] 索引集合
+// ARGV 当前时间、允许失败次数、第一次锁定时长、锁定时长上限、清零时间（毫秒），索引成员
+// 返回 失败次数、锁定次数、锁定截止时间、是否计数（锁定中的不计数）
+var failScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local lockedUntil = tonumber(redis.call('HGET', KEYS[1], 'until') or '0')
+local locks = tonumber(redis.call('HGET', KEYS[1], 'locks') or '0')
+if lockedUntil > now then
+	local failures = tonumber(redis.call('HGET', KEYS[1], 'fails') or '0')
+	return {failures, locks, lockedUntil, 0}
+end
+local failures = redis.call('HINCRBY', KEYS[1], 'fails', 1)
+if failures >= tonumber(ARGV[2]) then
+	locks = locks + 1
+	local d = tonumber(ARGV[3])
+	for i = 2, locks do
+		if d >= tonumber(ARGV[4]) then break end
+		d = d * 2
+	end
+	if d > tonumber(ARGV[4]) then d = tonumber(ARGV[4]) end
+	lockedUntil = now + d
+	failures = 0
+	redis.call('HSET', KEYS[1], 'fails', 0, 'locks', locks, 'until', lockedUntil)
+end
+redis.call('HSET', KEYS[1], 'last', ARGV[1])
+local ttl = tonumber(ARGV[5])
+if lockedUntil > now then ttl = ttl + lockedUntil - now end
+redis.call('PEXPIRE', KEYS[1], ttl)
+redis.call('SADD', KEYS[2], ARGV[6])
+return {failures, locks, lockedUntil, 1}
+`)
+
+// 撤销一次失败：失败次数大于0的减一，否则这次失败（最后一次失败的时间等于 at）触发了锁定的，解除这次锁定
+// KEYS[1] 状态hash，ARGV 失败时间、当前时间、允许失败次数、清零时间（毫秒）
+var releaseScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+local failures = tonumber(redis.call('HGET', KEYS[1], 'fails') or '0')
+if failures > 0 then
+	redis.call('HINCRBY', KEYS[1], 'fails', -1)
+	return 1
+end
+local locks = tonumber(redis.call('HGET', KEYS[1], 'locks') or '0')
+local lockedUntil = tonumber(redis.call('HGET', KEYS[1], 'until') or '0')
+if locks > 0 and redis.call('HGET', KEYS[1], 'last') == ARGV[1] and lockedUntil > tonumber(ARGV[2]) then
+	redis.call('HSET', KEYS[1], 'fails', math.max(tonumber(ARGV[3]) - 1, 0), 'locks', locks - 1, 'until', 0)
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+	return 1
+end
+return 0
+`)
+
+// redis锁定引擎，每个对象一个hash：prefix+kind:subject，另外用一个集合记录所有对象，用于列表查询
+type RedisEngine struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisEngine(client *redis.Client, prefix string) *RedisEngine {
+	return &RedisEngine{client: client, prefix: prefix}
+}
+
+func (r *RedisEngine) Get(kind, subject string) (State, error) {
+	m, err := r.client.HGetAll(r.key(kind, subject)).Result()
+	if err != nil {
+		return State{}, err
+	}
+	return parseState(kind, subject, m), nil
+}
+
+func (r *RedisEngine) Fail(kind, subject string, p Policy) (State, bool, error) {
+	now := time.Now().UnixMilli()
+	res, err := failScript.Run(r.client, []string{r.key(kind, subject), r.prefix + "index"},
+		now, p.MaxAttempts, p.LockDuration.Milliseconds(), p.maxDuration().Milliseconds(), p.Window.Milliseconds(), member(kind, subject)).Result()
+	if err != nil {
+		return State{}, false, err
+	}
+	values, _ := res.([]any)
+	if len(values) != 4 {
+		return State{}, false, errors.New("lockout: unexpected script result")
+	}
+	failures, _ := values[0].(int64)
+	locks, _ := values[1].(int64)
+	lockedUntil, _ := values[2].(int64)
+	counted, _ := values[3].(int64)
+	state := State{Kind: kind, Subject: subject, Failures: int(failures), Locks: int(locks), LastFailure: time.UnixMilli(now)}
+	if lockedUntil > 0 {
+		state.LockedUntil = time.UnixMilli(lockedUntil)
+	}
+	return state, counted == 1, nil
+}
+
+func (r *RedisEngine) Release(kind, subject string, p Policy, at time.Time) error {
+	return releaseScript.Run(r.client, []string{r.key(kind, subject)},
+		at.UnixMilli(), time.Now().UnixMilli(), p.MaxAttempts, p.Window.Milliseconds()).Err()
+}
+
+func (r *RedisEngine) Clear(kind, subject string) error {
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(r.key(kind, subject))
+		pipe.SRem(r.prefix+"index", member(kind, subject))
+		return nil
+	})
+	return err
+}
+
+func (r *RedisEngine) List() ([]State, error) {
+	members, err := r.client.SMembers(r.prefix + "index").Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]State, 0, len(members))
+	for _, m := range members {
+		kind, subject, ok := strings.Cut(m, ":")
+		if !ok {
+			continue
+		}
+		values, err := r.client.HGetAll(r.key(kind, subject)).Result()
+		if err != nil {
+			return nil, err
+		}
+		// 已经过期的，从索引中移除
+		if len(values) == 0 {
+			r.client.SRem(r.prefix+"index", m)
+			continue
+		}
+		list = append(list, parseState(kind, subject, values))
+	}
+	sortStates(list)
+	return list, nil
+}
+
+func (r *RedisEngine) key(kind, subject string) string {
+	return r.prefix + member(kind, subject)
+}
+
+func member(kind, subject string) string {
+	return kind + ":" + subject
+}
+
+func parseState(kind, subject string, m map[string]string) State {
+	state := State{Kind: kind, Subject: subject}
+	state.Failures, _ = strconv.Atoi(m["fails"])
+	state.Locks, _ = strconv.Atoi(m["locks"])
+	if v, _ := strconv.ParseInt(m["until"], 10, 64); v > 0 {
+		state.LockedUntil = time.UnixMilli(v)
+	}
+	if v, _ := strconv.ParseInt(m["last"], 10, 64); v > 0 {
+		state.LastFailure = time.UnixMilli(v)
+	}
+	return state
+}
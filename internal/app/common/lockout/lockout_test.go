@@ -0,0 +1,74 @@
+package lockout
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{MaxAttempts: 3, LockDuration: time.Minute, MaxDuration: time.Hour, Window: time.Hour}
+
+// 并发的尝试先占用次数，锁定之前最多只能有 MaxAttempts 次通过
+func TestFailConcurrent(t *testing.T) {
+	m := NewMemoryEngine()
+	var passed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, counted, _ := m.Fail(KindUser, "admin", testPolicy); counted {
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := passed.Load(); n != int32(testPolicy.MaxAttempts) {
+		t.Fatalf("%d attempts counted, want %d", n, testPolicy.MaxAttempts)
+	}
+	state, _ := m.Get(KindUser, "admin")
+	if !state.Locked() || state.Locks != 1 {
+		t.Fatalf("state = %+v, want locked once", state)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	m := NewMemoryEngine()
+	state, _, _ := m.Fail(KindIP, "10.0.0.1", testPolicy)
+	if err := m.Release(KindIP, "10.0.0.1", testPolicy, state.LastFailure); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ = m.Get(KindIP, "10.0.0.1"); state.Failures != 0 {
+		t.Fatalf("failures = %d, want 0", state.Failures)
+	}
+	// 触发锁定的那次失败被撤销时，同时解除锁定
+	for i := 0; i < testPolicy.MaxAttempts-1; i++ {
+		m.Fail(KindIP, "10.0.0.1", testPolicy)
+	}
+	state, counted, _ := m.Fail(KindIP, "10.0.0.1", testPolicy)
+	if !counted || !state.Locked() {
+		t.Fatalf("state = %+v, want locked by this failure", state)
+	}
+	m.Release(KindIP, "10.0.0.1", testPolicy, state.LastFailure)
+	state, _ = m.Get(KindIP, "10.0.0.1")
+	if state.Locked() || state.Locks != 0 || state.Failures != testPolicy.MaxAttempts-1 {
+		t.Fatalf("state = %+v, want unlocked with %d failures", state, testPolicy.MaxAttempts-1)
+	}
+	// 锁定中的不计数
+	for i := 0; i < 2; i++ {
+		state, counted, _ = m.Fail(KindIP, "10.0.0.1", testPolicy)
+	}
+	if counted || !state.Locked() {
+		t.Fatalf("state = %+v, counted = %v, want locked and not counted", state, counted)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	p := Policy{LockDuration: 15 * time.Minute, MaxDuration: time.Hour}
+	for locks, want := range map[int]time.Duration{1: 15 * time.Minute, 2: 30 * time.Minute, 3: time.Hour, 5: time.Hour} {
+		if got := p.duration(locks); got != want {
+			t.Errorf("duration(%d) = %s, want %s", locks, got, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// ------------------------------------------------------------------------
+// ------------------------       结构化日志       ------------------------
+// ------------------------------------------------------------------------
+
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// 日志配置
+type Options struct {
+	Level    string            // 默认级别：debug、info、warn、error
+	Levels   map[string]string // 按模块（Named 的名称）单独设置的级别
+	Format   string            // 输出格式：text（默认）或 json
+	Dir      string            // 日志文件目录，为空时不写文件
+	MaxSize  int64             // 单个日志文件的最大字节数，为0时只按天切分
+	MaxFiles int               // 最多保留的日志文件数，为0时不清理
+	Console  bool              // 是否同时输出到控制台
+}
+
+// 当前使用的日志输出，Init 之前输出到控制台
+type root struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+	file    *RotateWriter
+}
+
+var current atomic.Pointer[root]
+
+func init() {
+	current.Store(&root{handler: slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}), level: slog.LevelInfo})
+	slog.SetDefault(Named(""))
+}
+
+// 按配置初始化日志，替换掉原来的输出。已经通过 Named 获取的日志对象也会使用新的配置
+func Init(opts Options) error {
+	var writers []io.Writer
+	var file *RotateWriter
+	if opts.Dir != "" {
+		w, err := NewRotateWriter(opts.Dir, opts.MaxSize, opts.MaxFiles)
+		if err != nil {
+			return err
+		}
+		file = w
+		writers = append(writers, w)
+	}
+	if opts.Console || len(writers) == 0 {
+		writers = append(writers, os.Stdout)
+	}
+	out := io.MultiWriter(writers...)
+	// 级别在 namedHandler 中判断，这里不过滤
+	handlerOpts := &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true}
+	var handler slog.Handler
+	if strings.EqualFold(opts.Format, "json") {
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	} else {
+		handler = slog.NewTextHandler(out, handlerOpts)
+	}
+	r := &root{handler: handler, level: ParseLevel(opts.Level), levels: map[string]slog.Level{}, file: file}
+	for name, level := range opts.Levels {
+		r.levels[name] = ParseLevel(level)
+	}
+	if old := current.Swap(r); old.file != nil {
+		old.file.Close()
+	}
+	return nil
+}
+
+// 把缓冲区中的日志写入文件，程序退出前调用
+func Sync() {
+	if file := current.Load().file; file != nil {
+		file.Flush()
+	}
+}
+
+// 解析日志级别，无法识别的按 info 处理
+func ParseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// 获取模块的日志对象，模块名会作为 module 字段输出，并使用 Levels 中对应的级别
+func Named(name string) *slog.Logger {
+	logger := slog.New(&namedHandler{name: name})
+	if name != "" {
+		logger = logger.With("module", name)
+	}
+	return logger
+}
+
+// ================================== 上下文字段 ==================================
+
+type ctxKey struct{}
+
+// 在上下文中添加字段（如请求id、用户id），用 XxxContext 方法输出日志时会带上这些字段
+func WithContext(ctx context.Context, args ...any) context.Context {
+	attrs := append(Attrs(ctx), argsToAttrs(args)...)
+	return context.WithValue(ctx, ctxKey{}, attrs)
+}
+
+// 上下文中的字段
+func Attrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	return attrs[:len(attrs):len(attrs)] // 避免 append 时修改到父上下文的字段
+}
+
+func argsToAttrs(args []any) []slog.Attr {
+	var attrs []slog.Attr
+	r := slog.Record{}
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// ================================== handler ==================================
+
+// 每次输出时从 current 获取实际的 handler，按模块判断级别，并补充上下文中的字段
+type namedHandler struct {
+	name string
+	ops  []func(slog.Handler) slog.Handler // With、WithGroup 的操作，输出时按顺序作用到实际的 handler 上
+}
+
+func (h *namedHandler) Enabled(_ context.Context, level slog.Level) bool {
+	r := current.Load()
+	min, ok := r.levels[h.name]
+	if !ok {
+		min = r.level
+	}
+	return level >= min
+}
+
+func (h *namedHandler) Handle(ctx context.Context, record slog.Record) error {
+	r := current.Load()
+	handler := r.handler
+	// 上下文中的字段放在最外层，不受 WithGroup 影响
+	if attrs := Attrs(ctx); len(attrs) > 0 {
+		handler = handler.WithAttrs(attrs)
+	}
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+	err := handler.Handle(ctx, record)
+	// 错误日志立即写入文件，避免程序崩溃时丢失
+	if record.Level >= slog.LevelError && r.file != nil {
+		r.file.Flush()
+	}
+	return err
+}
+
+func (h *namedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *namedHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *namedHandler) with(op func(slog.Handler) slog.Handler) *namedHandler {
+	return &namedHandler{name: h.name, ops: append(h.ops[:len(h.ops):len(h.ops)], op)}
+}
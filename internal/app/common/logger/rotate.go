@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 带缓冲的日志文件，按天和大小切分：当天的文件为 2006-01-02.log，超过大小后依次为 2006-01-02.1.log、2006-01-02.2.log ...
+// 缓冲区每秒刷新一次，Error 及以上级别的日志立即刷新
+type RotateWriter struct {
+	mu       sync.Mutex
+	dir      string // 日志目录
+	maxSize  int64  // 单个文件的最大字节数，为0时只按天切分
+	maxFiles int    // 最多保留的文件数，为0时不清理
+	day      string // 当前文件的日期
+	index    int    // 当前文件的序号
+	size     int64  // 当前文件已写入的字节数
+	file     *os.File
+	buf      *bufio.Writer
+	done     chan struct{}
+}
+
+// 创建日志文件，maxSize 单位为字节
+func NewRotateWriter(dir string, maxSize int64, maxFiles int) (*RotateWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &RotateWriter{dir: dir, maxSize: maxSize, maxFiles: maxFiles, done: make(chan struct{})}
+	if err := w.open(time.Now()); err != nil {
+		return nil, err
+	}
+	go w.flushLoop()
+	return w, nil
+}
+
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	now := time.Now()
+	if now.Format(time.DateOnly) != w.day || (w.maxSize > 0 && w.size+int64(len(p)) > w.maxSize && w.size > 0) {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.buf.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// 把缓冲区写入文件
+func (w *RotateWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf == nil {
+		return nil
+	}
+	return w.buf.Flush()
+}
+
+// 刷新缓冲区并关闭文件
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	close(w.done)
+	w.buf.Flush()
+	err := w.file.Close()
+	w.file, w.buf = nil, nil
+	return err
+}
+
+func (w *RotateWriter) flushLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.Flush()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// 关闭当前文件，打开下一个文件
+func (w *RotateWriter) rotate(now time.Time) error {
+	w.buf.Flush()
+	w.file.Close()
+	index := w.index
+	if now.Format(time.DateOnly) == w.day {
+		w.index++ // 同一天超过大小，写到下一个序号的文件
+	}
+	if err := w.open(now); err != nil {
+		w.index = index
+		return err
+	}
+	w.cleanup()
+	return nil
+}
+
+// 打开当天还没有写满的文件，打开失败时保持原来的日期和序号，下次写入时重试
+func (w *RotateWriter) open(now time.Time) error {
+	day, index := now.Format(time.DateOnly), w.index
+	if day != w.day {
+		index = 0
+	}
+	for {
+		info, err := os.Stat(w.path(day, index))
+		if err != nil || w.maxSize <= 0 || info.Size() < w.maxSize {
+			break
+		}
+		index++
+	}
+	file, err := os.OpenFile(w.path(day, index), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.day, w.index = day, index
+	w.file, w.size = file, info.Size()
+	if w.buf == nil {
+		w.buf = bufio.NewWriterSize(file, 64*1024)
+	} else {
+		w.buf.Reset(file)
+	}
+	return nil
+}
+
+func (w *RotateWriter) path(day string, index int) string {
+	if index == 0 {
+		return filepath.Join(w.dir, day+".log")
+	}
+	return filepath.Join(w.dir, fmt.Sprintf("%s.%d.log", day, index))
+}
+
+// 删除超出保留数量的旧文件（按修改时间）
+func (w *RotateWriter) cleanup() {
+	if w.maxFiles <= 0 {
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(w.dir, "????-??-??*.log"))
+	if len(files) <= w.maxFiles {
+		return
+	}
+	modTime := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			modTime[f] = info.ModTime()
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return modTime[files[i]].Before(modTime[files[j]]) })
+	for _, f := range files[:len(files)-w.maxFiles] {
+		if f != w.file.Name() {
+			os.Remove(f)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"strings"
+)
+
+// 跨域：在IP黑白名单和鉴权之前执行，预检请求（OPTIONS）直接返回，不经过鉴权。
+// 来源不在允许范围内的不返回跨域响应头（由浏览器拦截），预检请求返回403
+func Cors() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Vary(fiber.HeaderOrigin)
+		origin := c.Get(fiber.HeaderOrigin)
+		preflight := c.Method() == fiber.MethodOptions && c.Get(fiber.HeaderAccessControlRequestMethod) != ""
+		if origin == "" {
+			return c.Next()
+		}
+		policy := config.Cors
+		origins := policy.Match(c.Path())
+		if !origins.Allowed(origin) {
+			if preflight {
+				return c.SendStatus(fiber.StatusForbidden)
+			}
+			return c.Next()
+		}
+		// 返回请求的来源，只有明确配置的来源才允许携带凭证，配置为 * 的不允许
+		c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+		if !origins.Any() {
+			c.Set(fiber.HeaderAccessControlAllowCredentials, "true")
+		}
+		if preflight {
+			c.Vary(fiber.HeaderAccessControlRequestMethod, fiber.HeaderAccessControlRequestHeaders)
+			c.Set(fiber.HeaderAccessControlAllowMethods, strings.Join(policy.Methods, ", "))
+			c.Set(fiber.HeaderAccessControlAllowHeaders, strings.Join(policy.Headers, ", "))
+			if policy.MaxAge > 0 {
+				c.Set(fiber.HeaderAccessControlMaxAge, strconv.Itoa(policy.MaxAge))
+			}
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+		c.Set(fiber.HeaderAccessControlExposeHeaders, strings.Join(policy.Expose, ", "))
+		return c.Next()
+	}
+}
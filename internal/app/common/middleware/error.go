@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
+	"fiber-web-api/internal/app/common/logger"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"gorm.io/gorm"
+	"runtime/debug"
+	"strconv"
+)
+
+var log = logger.Named("middleware")
+
+// 统一的错误处理：接口返回的错误转换为统一的返回格式，HTTP状态码按错误目录中的设置返回，返回信息按请求的语言翻译。
+// 未知错误（包括 panic）返回“未知异常”，原始错误只输出到日志
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	appErr := toAppError(err)
+	if appErr.Status >= fiber.StatusInternalServerError {
+		log.ErrorContext(c.UserContext(), "请求处理失败", "method", c.Method(), "path", c.Path(), "err", err)
+	}
+	return c.Status(appErr.Status).JSON(appErr.Result().Localize(config.Locale(c)))
+}
+
+// panic 转换为错误交给 ErrorHandler 处理，堆栈输出到日志
+func Recover() fiber.Handler {
+	return recover.New(recover.Config{
+		EnableStackTrace: true,
+		StackTraceHandler: func(c *fiber.Ctx, e any) {
+			log.ErrorContext(c.UserContext(), "panic", "method", c.Method(), "path", c.Path(), "err", fmt.Sprint(e), "stack", string(debug.Stack()))
+		},
+	})
+}
+
+func toAppError(err error) *config.AppError {
+	var appErr *config.AppError
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return config.ErrNotFound.With(i18n.M("field.data")).Wrap(err)
+	case isValidationError(err):
+		return config.ErrParam.Wrap(err)
+	case errors.As(err, &fiberErr):
+		switch fiberErr.Code {
+		case fiber.StatusNotFound, fiber.StatusMethodNotAllowed:
+			return config.ErrRoute.Wrap(err)
+		case fiber.StatusBadRequest, fiber.StatusUnprocessableEntity, fiber.StatusRequestEntityTooLarge:
+			return config.ErrParam.Wrap(err)
+		}
+		// 其他的保留原来的状态码
+		e := config.ErrUnknown.Wrap(err)
+		e.Status = fiberErr.Code
+		return e
+	}
+	return config.ErrUnknown.Wrap(err)
+}
+
+// 请求参数解析失败（BodyParser、QueryParser 等）
+func isValidationError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var numErr *strconv.NumError
+	var multiErr fiber.MultiError
+	var convErr fiber.ConversionError
+	var emptyErr fiber.EmptyFieldError
+	var unknownErr fiber.UnknownKeyError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.As(err, &numErr) ||
+		errors.As(err, &multiErr) || errors.As(err, &convErr) || errors.As(err, &emptyErr) || errors.As(err, &unknownErr)
+}
@@ -1,170 +1,360 @@
 package middleware
 
 import (
+	"encoding/json"
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/ipfilter"
+	"fiber-web-api/internal/app/common/logger"
+	"fiber-web-api/internal/app/common/rbac"
 	"fiber-web-api/internal/app/common/utils"
 	model "fiber-web-api/internal/app/model/sys"
-	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"net"
-	"net/http"
-	"regexp"
+	"github.com/google/uuid"
+	"log/slog"
+	"net/netip"
+	"net/url"
 	"strings"
 	"time"
 )
 
-// isIPInWhitelist
-//
-//	@Description:
-//	@param ip
-//	@return bool
-func isIPInWhitelist(ip string) bool {
-	pIp := net.ParseIP(ip)
-	for _, allowedIp := range config.AuthHost {
-		if allowedIp == "*" {
-			return true
-		}
-		if strings.Contains(allowedIp, "*") {
-			// 将 * 转换为正则表达式
-			regexPattern := strings.ReplaceAll(allowedIp, "*", ".*")
-			if match, _ := regexp.MatchString("^"+regexPattern+"$", ip); match {
-				return true
-			}
-		} else {
-			// 非通配符的精确匹配
-			if pIp.Equal(net.ParseIP(allowedIp)) {
-				return true
-			}
+// IP黑白名单：先解析客户端的真实IP（经过可信反向代理的从代理请求头中取），再按全局和接口分组的黑白名单校验，
+// 在所有接口之前执行（包括不存在的接口），被拒绝的请求也会记录访问日志
+func IPFilter() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		remote, _ := netip.AddrFromSlice(c.Context().RemoteIP())
+		ip := ipfilter.ClientIP(remote, c.Get(config.ProxyHeader), config.TrustedProxies)
+		c.Locals(config.ClientIPLocal, ip.String())
+		if !config.IPFilter.Allowed(c.Path(), ip) {
+			return config.ErrIllegal
 		}
+		return c.Next()
 	}
-	return false
 }
 
 // CheckToken
 //
-//	@Description: 验证token
+//	@Description: 验证token并鉴权，注册在每个接口上（路由匹配之后），按 c.Route() 的方法和路由路径获取鉴权规则
 //	@param c
 //	@return error
 func CheckToken(c *fiber.Ctx) error {
-	// 获取用户请求的ip
-	ip := c.IP()
-	// 校验用户 IP 是否在白名单内
-	if !isIPInWhitelist(ip) {
-		return c.Status(http.StatusOK).JSON(config.Error("非法访问"))
-	}
-	// 排除指定接口，不校验token
-	path := c.Path()
-	if path == "/sys/login" || path == "/sys/getKey" || path == "/sys/getCode" {
+	// 没有鉴权规则的接口不允许访问，公开接口不校验token
+	path := c.Route().Path
+	rule, ok := config.RouteRules.Match(c.Route().Method, path)
+	if !ok {
+		return config.ErrForbidden
+	}
+	if rule.Level == rbac.Public {
 		return c.Next()
 	}
 	// 获取请求头中的token，并校验
 	token, err := model.GetToken(c)
 	if err != nil {
-		return c.Status(http.StatusOK).JSON(err)
+		return err
 	}
-	// 鉴权
-	if !checkPermission(c, token) {
-		return c.Status(http.StatusOK).JSON(config.Error("没有操作权限"))
+	// 后续的日志带上用户id，返回信息按用户的语言偏好翻译，操作日志记录操作人（退出登录后也能取到）
+	userId, userName, locale := model.GetSessionUser(token)
+	c.Locals(config.UserIdLocal, userId)
+	c.Locals(config.LocaleLocal, locale)
+	c.Locals(model.LogOperator, userName)
+	c.SetUserContext(logger.WithContext(c.UserContext(), "userId", userId))
+	// 受限会话（如密码已过期、必须绑定身份验证器）只能访问对应的少数接口，且不需要再鉴权
+	if restrict := model.GetRestrict(token); restrict != "" {
+		if !utils.IsContain(restrictApis[restrict], path) {
+			return model.RestrictError(restrict)
+		}
+		c.Locals(config.RestrictLocal, restrict) // 没有鉴权，接口中只能操作自己的数据
+	} else if !checkPermission(rule, token) { // 鉴权
+		return config.ErrForbidden
+	}
+	// 刷新token有效期刷新和定期刷新（jwt模式由客户端调用 /sys/refresh 刷新）
+	if config.TokenMode != config.TokenModeJwt {
+		token = refreshToken(c, token)
 	}
-	// 设置请求头
-	setHeader(c)
-	// 刷新token有效期刷新和定期刷新
-	refreshToken(c, token)
 	// 排除三个接口，都要经过中间件，然后这个中间件获取token时，已经解析、检验过token了
 	// 所以这里直接将解析且校验通过的token重新设置到请求头中，当那些接口去拿请求头的token时，直接拿，不用再进行解析校验。
 	c.Request().Header.Set(config.TokenHeader, token)
 	return c.Next()
 }
 
-func refreshToken(c *fiber.Ctx, token string) {
-	// 刷新有效期
-	v := model.GetCreateTime(token)
-	// 获取token创建时间
-	// 判断token的创建时间是否大于2小时，如果是则需要刷新token
-	s := time.Now().Unix() - v
-	hour := s / 1000 / 3600
+// 刷新token：有效期刷新，创建超过2小时的token重新生成，返回刷新后的token
+func refreshToken(c *fiber.Ctx, token string) string {
+	// 获取token创建时间，判断token的创建时间是否大于2小时，如果是则需要刷新token
+	createTime := model.GetCreateTime(token)
+	hour := (time.Now().Unix() - createTime) / 3600
 	if hour >= 2 {
-		// TODO
-		user := model.GetLoginUser(token)
-		expire := model.GetExpire(token)
-		// TODO
-		splits := strings.Split(token, "_")
-		var newToken string
-		if len(splits) > 1 {
-			newToken = user.Login(splits[0], expire)
-		} else {
-			newToken = user.Login("", expire)
-		}
-		token = newToken
-		// 设置新的toke到 请求头中
-		c.Response().Header.Set(config.TokenHeader, newToken)
+		token = model.RenewToken(token)
+		// 设置新的toke到响应头中
+		c.Response().Header.Set(config.TokenHeader, token)
+		return token
 	}
-	// 获取token的过期时间
-	timeOut := model.GetTimeOut(token)
-	if timeOut != -1 {
+	// 刷新有效期（永不过期的不需要刷新）
+	if model.GetTimeOut(token) != -1 {
 		model.UpdateTimeOut(token, config.TokenExpire)
 	}
+	return token
+}
+
+var apis = config.RouteApi
+
+var accessLog = logger.Named("access")
+
+// 受限会话允许访问的接口
+var restrictApis = map[string][]string{
+	model.RestrictPwdChange:  {"/sys/user/updatePassword", "/sys/user/getLoginUser", "/sys/logout"},
+	model.RestrictPwdExpired: {"/sys/user/updatePassword", "/sys/user/getLoginUser", "/sys/logout"},
+	model.RestrictMfaEnroll:  {"/sys/mfa/status", "/sys/mfa/setup", "/sys/mfa/enable", "/sys/user/getLoginUser", "/sys/logout"},
 }
 
-func setHeader(c *fiber.Ctx) {
-	// 校验Origin值
-	origin := c.Get("Origin")
-	if origin != "" && utils.IsContain(config.AllowedOrigins, origin) {
-		c.Set("Access-Control-Allow-Origin", origin)
-	} else {
-		c.Set("Access-Control-Allow-Origin", "")
+// 登录即可访问的接口不需要查询权限列表
+func checkPermission(rule rbac.Rule, token string) bool {
+	if rule.Level == rbac.Authenticated {
+		return true
 	}
-	c.Set("Set-Cookie", "name=value; SameSite=Strict;cookiename=httponlyTest;Path=/;Domain=domainvalue;Max-Age=seconds;Secure;HTTPOnly")
-	c.Set("Content-Security-Policy", "default-src 'self'; script-src 'self'; frame-ancestors 'self'; object-src 'none'")
-	c.Set("Access-Control-Allow-Credentials", "true")
-	c.Set("Referrer-Policy", "no-referrer")
-	c.Set("X-XXS-Protection", "1; mode=block") //1; mode=block: 启用XSS保护，并检查到XSS攻击时，停止渲染页面
-	c.Set("X-Content-Type-Options", "nosniff") //互联网上的资源有各种类型，通常浏览器会根据响应头的Content-Type字段来分辨它们的类型。通过这响应头可以禁用浏览器的类型猜测行为
-	c.Set("X-Frame-Options", "SAMEORIGIN")     //SAMEORIGIN: 不允许被本域以外的页面嵌入
-	c.Set("X-DNS-Prefetch-Control", "off")
-	c.Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
-	c.Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	c.Set("Pragma", "no-cache")
-	c.Set("Expires", "0")
+	user := model.GetLoginUser(token)
+	return rule.Allow(model.GetPermList(user.RoleId))
 }
 
-var apis = config.RouteApi
+// 操作日志：记录所有修改类接口（非GET）的操作人、参数、结果和耗时，异步写入数据库。
+// 注册在限流和鉴权之前，没有登录、没有权限、请求过于频繁被拒绝的请求也会记录
+func SysLogInit(c *fiber.Ctx) error {
+	method := c.Method()
+	if method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions {
+		return c.Next()
+	}
+	if api, ok := apis[c.Route().Path]; ok && api.NoAudit {
+		return c.Next()
+	}
+	start := time.Now()
+	params := maskParams(c)
+	err := c.Next()
+	// 路由匹配之后才能拿到接口信息，没有注册的接口（404）不记录
+	api, ok := apis[c.Route().Path]
+	if !ok {
+		return err
+	}
+	syslog := model.SysLog{
+		IP:      config.ClientIP(c),
+		Title:   api.Description,
+		Type:    logType(api.Path),
+		Method:  method,
+		Url:     c.Path(),
+		Group:   api.Group,
+		Params:  params,
+		Latency: time.Since(start).Milliseconds(),
+	}
+	syslog.Ctx = c.UserContext()
+	var message string
+	syslog.Code, message = responseResult(c, err)
+	// 操作人在 CheckToken 校验令牌后设置（请求头中的令牌可能是加密的，不能在这里解析），没有登录的接口由接口自己设置
+	operator, _ := c.Locals(model.LogOperator).(string)
+	syslog.CreatorId = &operator
+	syslog.State = "操作成功"
+	if syslog.Code != 0 {
+		syslog.State = "操作失败"
+		syslog.Info = message
+	}
+	// 没有登录、签名错误、没有权限、受限会话、请求过于频繁被拒绝的
+	switch syslog.Code {
+	case config.CodeNotLogin, config.CodeSignMissing, config.CodeSignExpired, config.CodeSignReplayed, config.CodeSignInvalid,
+		config.CodeForbidden, config.CodePwdExpired, config.CodePwdChange, config.CodeMfaEnroll, config.CodeTooMany:
+		syslog.State = "拒绝访问"
+	}
+	if syslog.Type == "登录" {
+		syslog.State = strings.Replace(syslog.State, "操作", "登录", 1)
+	}
+	if v, ok := c.Locals(model.LogState).(string); ok && v != "" {
+		syslog.State = v
+	}
+	if v, ok := c.Locals(model.LogInfo).(string); ok && v != "" {
+		syslog.Info = v
+	}
+	syslog.InsertAsync()
+	return err
+}
+
+// 操作类型，根据接口地址的最后一级判断（忽略路径参数），对应 SysLog.Type
+var logTypes = map[string]string{
+	"login":          "登录",
+	"logout":         "退出",
+	"insert":         "新增",
+	"update":         "修改",
+	"updateState":    "修改",
+	"delete":         "删除",
+	"deleteType":     "删除",
+	"upload":         "上传",
+	"import":         "导入",
+	"updatePassword": "设置密码",
+	"resetPassword":  "重置密码",
+}
+
+func logType(path string) string {
+	segments := strings.Split(path, "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if t, ok := logTypes[segments[i]]; ok {
+			return t
+		}
+	}
+	return "其他"
+}
+
+// 从返回的json中获取返回码和返回信息，处理函数返回错误时（还没有经过 ErrorHandler）按错误目录转换
+func responseResult(c *fiber.Ctx, err error) (int, string) {
+	if err != nil {
+		e := config.AsAppError(err)
+		return e.Code, e.Error()
+	}
+	var result config.Result
+	if json.Unmarshal(c.Response().Body(), &result) != nil {
+		return 0, ""
+	}
+	return result.Code, result.Message
+}
+
+// 需要脱敏的参数：名称包含以下关键字的（忽略大小写），以及验证码
+var sensitiveParams = []string{"password", "pwd", "secret", "token", "sign"}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	if key == "code" {
+		return true
+	}
+	for _, s := range sensitiveParams {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
 
-func checkPermission(c *fiber.Ctx, token string) bool {
-	path := c.Path()
-	flag := false
-	api := apis[path]
-	if api.Permission != "" {
-		user := model.GetLoginUser(token)
-		permList := model.GetPermList(user.RoleId)
-		split := strings.Split(api.Permission, ";")
-		for i := range split {
-			if utils.IsContain(permList, split[i]) {
-				flag = true
-				break
+// 请求参数（查询参数和请求体），敏感字段替换为 ******，最多保留2000个字符
+func maskParams(c *fiber.Ctx) string {
+	var parts []string
+	if query := string(c.Request().URI().QueryString()); query != "" {
+		parts = append(parts, maskForm(query))
+	}
+	body := c.Body()
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	switch {
+	case len(body) == 0:
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		var v any
+		if json.Unmarshal(body, &v) == nil {
+			masked, _ := json.Marshal(maskJson(v))
+			parts = append(parts, string(masked))
+		}
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationForm):
+		parts = append(parts, maskForm(string(body)))
+	case strings.HasPrefix(contentType, fiber.MIMEMultipartForm):
+		if form, err := c.MultipartForm(); err == nil {
+			values := url.Values{}
+			for k, v := range form.Value {
+				values[k] = v
+			}
+			for k, files := range form.File {
+				for _, f := range files {
+					values.Add(k, f.Filename)
+				}
 			}
+			parts = append(parts, maskForm(values.Encode()))
 		}
 	}
-	return flag
+	params := strings.Join(parts, " ")
+	if r := []rune(params); len(r) > 2000 {
+		params = string(r[:2000])
+	}
+	return params
 }
 
-func SysLogInit(c *fiber.Ctx) error {
-	return c.Next()
+func maskForm(raw string) string {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return ""
+	}
+	for k := range values {
+		if isSensitive(k) {
+			values[k] = []string{"******"}
+		}
+	}
+	masked, _ := url.QueryUnescape(values.Encode())
+	return masked
+}
+
+func maskJson(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for k, item := range value {
+			if isSensitive(k) {
+				value[k] = "******"
+			} else {
+				value[k] = maskJson(item)
+			}
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = maskJson(item)
+		}
+	}
+	return v
 }
 
-// 统一的日志格式化输出中间件
+// 请求id和访问日志：请求头 X-Request-ID 合法时沿用，否则生成新的，返回到响应头中，并添加到这个请求的所有日志中。
+// 请求结束后输出访问日志，4xx 为 warn 级别，5xx 为 error 级别
 func LoggerPrint() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		start := time.Now()
+		requestId := c.Get(fiber.HeaderXRequestID)
+		if !validRequestId(requestId) {
+			requestId = strings.ReplaceAll(uuid.NewString(), "-", "")
+		}
+		c.Set(fiber.HeaderXRequestID, requestId)
+		c.Locals(config.RequestIdLocal, requestId)
+		c.SetUserContext(logger.WithContext(c.UserContext(), "requestId", requestId))
+
+		// 错误在这里交给 ErrorHandler 处理，才能拿到最终的状态码
+		if err := c.Next(); err != nil {
+			if err = c.App().ErrorHandler(c, err); err != nil {
+				c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+		status := c.Response().StatusCode()
+		userId, _ := c.Locals(config.UserIdLocal).(string) // 没有登录的接口为空
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		} else if status >= fiber.StatusBadRequest {
+			level = slog.LevelWarn
+		}
+		accessLog.LogAttrs(c.UserContext(), level, "access",
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Int("bytes", responseSize(c)),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", config.ClientIP(c)),
+			slog.String("userId", userId),
+			slog.String("userAgent", c.Get(fiber.HeaderUserAgent)),
+		)
+		return nil
+	}
+}
 
-		err := c.Next()
-		var logMessage string
-		if err != nil {
-			logMessage = fmt.Sprintf("[%s] %s %s - %s ==> [Error] %s\n", start.Format("2006-01-02 15:04:05"), c.Method(), c.Path(), time.Since(start), err.Error())
-		} else {
-			logMessage = "Success"
+// 请求头中的请求id只允许字母、数字和 -_.:，最长64位，避免日志注入
+func validRequestId(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
 		}
-		fmt.Printf(logMessage)
-		return err
 	}
+	return true
+}
+
+// 响应体大小，流式输出（如导出）读取响应体会把整个流读到内存中，这里返回-1
+func responseSize(c *fiber.Ctx) int {
+	if c.Response().IsBodyStream() {
+		return -1
+	}
+	return len(c.Response().Body())
 }
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/ratelimit"
+	"github.com/gofiber/fiber/v2"
+	"math"
+	"strconv"
+)
+
+// 接口限流：按接口注册时的限流类别，kind 为 ratelimit.KindIP 时按客户端IP限流（在鉴权之前执行），
+// 为 ratelimit.KindUser 时按登录用户限流（在鉴权之后执行，没有登录的接口不限）。
+// 同一个接口分组共用一个令牌桶，超过限制返回429和 Retry-After（秒）。限流器异常时不拦截请求
+func RateLimit(kind string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !config.RateLimitOn {
+			return c.Next()
+		}
+		api, ok := apis[c.Route().Path]
+		if !ok {
+			return c.Next()
+		}
+		class := api.RateClass()
+		limit := config.RateLimits[class].IP
+		subject := config.ClientIP(c)
+		if kind == ratelimit.KindUser {
+			limit = config.RateLimits[class].User
+			subject, _ = c.Locals(config.UserIdLocal).(string)
+		}
+		if limit.Unlimited() || subject == "" {
+			return c.Next()
+		}
+		result, err := config.RateLimiter.Take(kind+":"+class+":"+api.Group+":"+subject, limit)
+		if err != nil {
+			log.WarnContext(c.UserContext(), "限流失败", "kind", kind, "path", c.Path(), "err", err)
+			return c.Next()
+		}
+		if !result.Allowed {
+			seconds := int(math.Ceil(result.RetryAfter.Seconds()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+			return config.ErrTooMany.With(seconds)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// 安全响应头：在所有中间件之前设置，未登录、出错、不存在的接口的返回也都带上，按请求路径使用 security.routes 中覆盖的响应头
+func SecureHeaders() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, h := range config.Security.Headers(c.Path()) {
+			c.Set(h[0], h[1])
+		}
+		return c.Next()
+	}
+}
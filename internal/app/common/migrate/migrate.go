@@ -0,0 +1,130 @@
+// ------------------------------------------------------------------------
+// ------------------------       数据库结构迁移       ------------------------
+// ------------------------------------------------------------------------
+
+package migrate
+
+import (
+	"embed"
+	"fmt"
+	"gorm.io/gorm"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 迁移脚本，文件名为 版本号_说明.sql（如 0001_user_password_update_time.sql），按版本号顺序执行。
+// 已经发布的脚本不能再修改，结构变化需要新增脚本
+//
+//go:embed sql/*.sql
+var scripts embed.FS
+
+// 记录已执行的迁移版本
+type SysMigration struct {
+	Version   string    `json:"version"`
+	ApplyTime time.Time `json:"applyTime"`
+}
+
+// 获取表名
+func (SysMigration) TableName() string {
+	return "sys_migration"
+}
+
+// 多个实例同时启动时，用数据库锁保证迁移只执行一次
+const lockName = "go-web:migration"
+
+// 迁移脚本
+type script struct {
+	Version string   // 版本号（文件名去掉 .sql）
+	Stmts   []string // sql 语句
+}
+
+// 执行还没有执行过的迁移脚本
+func Run(db *gorm.DB) error {
+	list, err := load()
+	if err != nil {
+		return err
+	}
+	return db.Connection(func(conn *gorm.DB) (err error) {
+		var locked int
+		if err = conn.Raw("SELECT GET_LOCK(?, 60)", lockName).Scan(&locked).Error; err != nil {
+			return
+		}
+		if locked != 1 {
+			return fmt.Errorf("migrate: wait lock %s timeout", lockName)
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", lockName)
+
+		err = conn.Exec("CREATE TABLE IF NOT EXISTS sys_migration (" +
+			"version varchar(64) NOT NULL PRIMARY KEY, apply_time datetime NOT NULL)").Error
+		if err != nil {
+			return
+		}
+		var applied []string
+		if err = conn.Table(SysMigration{}.TableName()).Pluck("version", &applied).Error; err != nil {
+			return
+		}
+		done := make(map[string]bool, len(applied))
+		for _, version := range applied {
+			done[version] = true
+		}
+		for _, s := range list {
+			if done[s.Version] {
+				continue
+			}
+			// mysql 的 DDL 不能回滚，脚本中途失败时需要人工处理后重新启动
+			for _, stmt := range s.Stmts {
+				if err = conn.Exec(stmt).Error; err != nil {
+					return fmt.Errorf("migrate %s: %w", s.Version, err)
+				}
+			}
+			if err = conn.Create(&SysMigration{Version: s.Version, ApplyTime: time.Now()}).Error; err != nil {
+				return
+			}
+		}
+		return
+	})
+}
+
+// 读取全部迁移脚本，按版本号排序
+func load() (list []script, err error) {
+	entries, err := scripts.ReadDir("sql")
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		var data []byte
+		if data, err = scripts.ReadFile(path.Join("sql", entry.Name())); err != nil {
+			return
+		}
+		list = append(list, script{
+			Version: strings.TrimSuffix(entry.Name(), ".sql"),
+			Stmts:   split(string(data)),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return
+}
+
+// 按行尾的分号拆分 sql 语句，忽略空行和 -- 开头的注释行
+func split(data string) (stmts []string) {
+	var stmt []string
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		if strings.HasSuffix(line, ";") {
+			stmt = append(stmt, strings.TrimSuffix(line, ";"))
+			stmts = append(stmts, strings.Join(stmt, "\n"))
+			stmt = nil
+			continue
+		}
+		stmt = append(stmt, line)
+	}
+	if len(stmt) > 0 {
+		stmts = append(stmts, strings.Join(stmt, "\n"))
+	}
+	return
+}
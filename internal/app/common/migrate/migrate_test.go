@@ -0,0 +1,40 @@
+package migrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	data := "-- 注释\r\nALTER TABLE a ADD COLUMN b int;\n\nCREATE TABLE c (\n  id int\n);\nALTER TABLE d DROP COLUMN e"
+	want := []string{"ALTER TABLE a ADD COLUMN b int", "CREATE TABLE c (\nid int\n)", "ALTER TABLE d DROP COLUMN e"}
+	if got := split(data); !reflect.DeepEqual(got, want) {
+		t.Fatalf("split = %q, want %q", got, want)
+	}
+}
+
+// 脚本版本号不能重复，每个脚本至少有一条语句
+func TestLoad(t *testing.T) {
+	list, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 {
+		t.Fatal("no migration scripts")
+	}
+	seen := map[string]bool{}
+	for _, s := range list {
+		number, _, ok := strings.Cut(s.Version, "_")
+		if !ok || len(number) != 4 {
+			t.Errorf("%s: file name must be NNNN_desc.sql", s.Version)
+		}
+		if seen[number] {
+			t.Errorf("%s: duplicate version %s", s.Version, number)
+		}
+		seen[number] = true
+		if len(s.Stmts) == 0 {
+			t.Errorf("%s: empty script", s.Version)
+		}
+	}
+}
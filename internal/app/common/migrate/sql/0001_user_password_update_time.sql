@@ -0,0 +1,2 @@
+-- 密码最后修改时间，为空时按用户创建时间计算密码更改周期
+ALTER TABLE sys_user ADD COLUMN password_update_time datetime NULL DEFAULT NULL COMMENT '密码最后修改时间';
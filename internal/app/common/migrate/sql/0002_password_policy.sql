@@ -0,0 +1,17 @@
+-- 密码复杂度和历史密码策略
+ALTER TABLE sys_safe
+  ADD COLUMN pwd_min_length int NOT NULL DEFAULT 0 COMMENT '密码最小长度（0：不限制）',
+  ADD COLUMN pwd_char_class varchar(64) NOT NULL DEFAULT '' COMMENT '密码必须包含的字符类型，逗号分隔（upper,lower,digit,special）',
+  ADD COLUMN pwd_no_user_info tinyint NOT NULL DEFAULT 0 COMMENT '密码不能包含用户名、真实姓名（0：否。1：是）',
+  ADD COLUMN pwd_no_common tinyint NOT NULL DEFAULT 0 COMMENT '密码不能是常见弱密码（0：否。1：是）',
+  ADD COLUMN pwd_history int NOT NULL DEFAULT 0 COMMENT '最近几次使用过的密码不能再次使用（0：不限制）';
+
+-- 用户历史密码
+CREATE TABLE IF NOT EXISTS sys_password_history (
+  id varchar(32) NOT NULL COMMENT 'id',
+  user_id varchar(32) NOT NULL COMMENT '用户id',
+  password varchar(128) NOT NULL COMMENT 'bcrypt加密后的密码',
+  create_time datetime NOT NULL COMMENT '创建时间',
+  PRIMARY KEY (id),
+  KEY idx_user_id_create_time (user_id, create_time)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='用户历史密码';
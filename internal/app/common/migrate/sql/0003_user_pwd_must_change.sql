@@ -0,0 +1,2 @@
+-- 新增用户和重置密码后，登录时必须修改密码
+ALTER TABLE sys_user ADD COLUMN pwd_must_change tinyint NOT NULL DEFAULT 0 COMMENT '登录后必须修改密码（1 是 0 否）';
@@ -0,0 +1,18 @@
+-- 双因素认证（TOTP）
+ALTER TABLE sys_user
+  ADD COLUMN totp_enable tinyint NOT NULL DEFAULT 0 COMMENT '是否开启双因素认证（1 是 0 否）',
+  ADD COLUMN totp_secret varchar(255) NOT NULL DEFAULT '' COMMENT '动态验证码（TOTP）密钥，用 mfa.key 加密保存';
+
+ALTER TABLE sys_safe
+  ADD COLUMN mfa_mandatory tinyint NOT NULL DEFAULT 0 COMMENT '是否强制开启双因素认证（0：否。1：是）',
+  ADD COLUMN mfa_role_ids varchar(1024) NOT NULL DEFAULT '' COMMENT '强制开启双因素认证的角色id，逗号分隔，为空时所有用户都必须开启';
+
+-- 双因素认证恢复码，每个只能使用一次
+CREATE TABLE IF NOT EXISTS sys_recovery_code (
+  id varchar(32) NOT NULL COMMENT 'id',
+  user_id varchar(32) NOT NULL COMMENT '用户id',
+  code varchar(128) NOT NULL COMMENT 'bcrypt加密后的恢复码',
+  create_time datetime NOT NULL COMMENT '创建时间',
+  PRIMARY KEY (id),
+  KEY idx_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='双因素认证恢复码';
@@ -0,0 +1,4 @@
+-- 登录验证码策略
+ALTER TABLE sys_safe
+  ADD COLUMN captcha_policy tinyint NOT NULL DEFAULT 0 COMMENT '登录验证码（0：不需要。1：每次都需要。2：IP或账号登录失败达到指定次数后需要）',
+  ADD COLUMN captcha_error_num int NOT NULL DEFAULT 3 COMMENT '登录失败多少次后需要验证码（验证码策略为2时生效）';
@@ -0,0 +1,6 @@
+-- 操作日志补充接口组、请求参数、返回码和耗时
+ALTER TABLE sys_log
+  ADD COLUMN api_group varchar(64) NOT NULL DEFAULT '' COMMENT '接口所属组',
+  ADD COLUMN params text NULL COMMENT '请求参数（密码等敏感字段已脱敏）',
+  ADD COLUMN code int NOT NULL DEFAULT 0 COMMENT '返回码',
+  ADD COLUMN latency bigint NOT NULL DEFAULT 0 COMMENT '耗时（毫秒）';
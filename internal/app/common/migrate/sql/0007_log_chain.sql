@@ -0,0 +1,16 @@
+-- 操作日志哈希链
+ALTER TABLE sys_log
+  ADD COLUMN seq bigint NOT NULL DEFAULT 0 COMMENT '哈希链序号，没有开启哈希链时为0',
+  ADD COLUMN prev_hash varchar(64) NOT NULL DEFAULT '' COMMENT '上一条日志的哈希',
+  ADD COLUMN hash varchar(64) NOT NULL DEFAULT '' COMMENT '本条日志内容和上一条日志哈希的哈希',
+  ADD KEY idx_seq (seq);
+
+-- 哈希链的链头，只有 id=1 的一行
+CREATE TABLE IF NOT EXISTS sys_log_chain (
+  id int NOT NULL COMMENT 'id',
+  seq bigint NOT NULL DEFAULT 0 COMMENT '最后一条日志的序号',
+  hash varchar(64) NOT NULL DEFAULT '' COMMENT '最后一条日志的哈希',
+  archive_seq bigint NOT NULL DEFAULT 0 COMMENT '最后一条已归档日志的序号',
+  archive_hash varchar(64) NOT NULL DEFAULT '' COMMENT '最后一条已归档日志的哈希',
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='操作日志哈希链';
@@ -0,0 +1,2 @@
+-- 用户的语言偏好
+ALTER TABLE sys_user ADD COLUMN locale varchar(16) NOT NULL DEFAULT '' COMMENT '语言偏好（zh-CN、en-US），为空时按请求头 Accept-Language 选择';
@@ -0,0 +1,8 @@
+-- 恢复码按明文前缀查找，不再逐个比较
+ALTER TABLE sys_recovery_code
+  ADD COLUMN prefix varchar(8) NOT NULL DEFAULT '' COMMENT '恢复码的前两位（明文）',
+  DROP KEY idx_user_id,
+  ADD KEY idx_user_id_prefix (user_id, prefix);
+
+-- 旧的恢复码没有前缀，无法再使用，需要用户重新生成
+DELETE FROM sys_recovery_code WHERE prefix = '';
@@ -0,0 +1,197 @@
+// ------------------------------------------------------------------------
+// ------------------------       密码复杂度策略       ------------------------
+// ------------------------------------------------------------------------
+
+package password
+
+import (
+	"bufio"
+	"crypto/rand"
+	_ "embed"
+	"fiber-web-api/internal/app/common/i18n"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// 字符类型
+const (
+	ClassUpper   = "upper"   // 大写字母
+	ClassLower   = "lower"   // 小写字母
+	ClassDigit   = "digit"   // 数字
+	ClassSpecial = "special" // 特殊字符
+)
+
+// 字符类型名称的国际化key
+var classNames = map[string]string{
+	ClassUpper:   "password.class.upper",
+	ClassLower:   "password.class.lower",
+	ClassDigit:   "password.class.digit",
+	ClassSpecial: "password.class.special",
+}
+
+// 内置的常见弱密码列表，每行一个，比较时忽略大小写。只包含最常见的一部分，
+// 可以通过配置 password.common_list 加载更完整的列表（见 LoadCommonFile）
+//
+//go:embed common.txt
+var commonText string
+
+var common = func() map[string]struct{} {
+	m := make(map[string]struct{})
+	addCommon(m, strings.NewReader(commonText))
+	return m
+}()
+
+// 从文件加载常见弱密码列表，格式和内置列表一样（每行一个，# 开头的是注释），
+// 加到内置列表中，返回新增的数量。只在启动时调用
+func LoadCommonFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return addCommon(common, f)
+}
+
+func addCommon(m map[string]struct{}, r io.Reader) (int, error) {
+	n := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, ok := m[line]; !ok {
+			m[line] = struct{}{}
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+// 密码策略，零值表示不做任何限制
+type Policy struct {
+	MinLength  int      // 最小长度，0不限制
+	Classes    []string // 必须包含的字符类型（upper、lower、digit、special）
+	NoUserInfo bool     // 不能包含用户名、真实姓名
+	NoCommon   bool     // 不能是常见弱密码
+	UserName   string   // 用户名
+	RealName   string   // 真实姓名
+}
+
+// 校验密码，返回没有通过的规则（国际化消息），全部通过时返回空
+func (p Policy) Check(password string) (fails i18n.List) {
+	if p.MinLength > 0 && len([]rune(password)) < p.MinLength {
+		fails = append(fails, i18n.M("password.minLength", p.MinLength))
+	}
+	has := classes(password)
+	for _, class := range p.Classes {
+		name, ok := classNames[class]
+		if ok && !has[class] {
+			fails = append(fails, i18n.M("password.class", i18n.M(name)))
+		}
+	}
+	if p.NoUserInfo {
+		lower := strings.ToLower(password)
+		if p.UserName != "" && strings.Contains(lower, strings.ToLower(p.UserName)) {
+			fails = append(fails, i18n.M("password.userName"))
+		}
+		if p.RealName != "" && strings.Contains(lower, strings.ToLower(p.RealName)) {
+			fails = append(fails, i18n.M("password.realName"))
+		}
+	}
+	if p.NoCommon && IsCommon(password) {
+		fails = append(fails, i18n.M("password.common"))
+	}
+	return
+}
+
+// 是否是常见弱密码
+func IsCommon(password string) bool {
+	_, ok := common[strings.ToLower(password)]
+	return ok
+}
+
+// 解析逗号分隔的字符类型，忽略不认识的类型
+func ParseClasses(s string) (list []string) {
+	for _, class := range strings.Split(s, ",") {
+		class = strings.TrimSpace(class)
+		if _, ok := classNames[class]; ok {
+			list = append(list, class)
+		}
+	}
+	return
+}
+
+// 统计密码包含的字符类型
+func classes(password string) map[string]bool {
+	has := make(map[string]bool, 4)
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			has[ClassUpper] = true
+		case unicode.IsLower(r):
+			has[ClassLower] = true
+		case unicode.IsDigit(r):
+			has[ClassDigit] = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || r == ' ':
+			has[ClassSpecial] = true
+		}
+	}
+	return has
+}
+
+// 生成符合策略的随机密码（一次性密码），包含所有字符类型，长度不少于12位
+func (p Policy) Generate() (string, error) {
+	sets := []string{upperChars, lowerChars, digitChars, specialChars}
+	length := max(p.MinLength, 12)
+	for {
+		buf := make([]byte, 0, length)
+		// 每种字符类型至少一个，剩下的从所有字符中随机
+		for _, set := range sets {
+			c, err := randomChar(set)
+			if err != nil {
+				return "", err
+			}
+			buf = append(buf, c)
+		}
+		all := strings.Join(sets, "")
+		for len(buf) < length {
+			c, err := randomChar(all)
+			if err != nil {
+				return "", err
+			}
+			buf = append(buf, c)
+		}
+		// 打乱顺序
+		for i := len(buf) - 1; i > 0; i-- {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+			if err != nil {
+				return "", err
+			}
+			j := n.Int64()
+			buf[i], buf[j] = buf[j], buf[i]
+		}
+		if pwd := string(buf); len(p.Check(pwd)) == 0 {
+			return pwd, nil
+		}
+	}
+}
+
+// 生成随机密码用的字符，去掉了容易混淆的字符（0、O、1、l、I）
+const (
+	upperChars   = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	lowerChars   = "abcdefghijkmnpqrstuvwxyz"
+	digitChars   = "23456789"
+	specialChars = "!@#$%^&*_-+="
+)
+
+func randomChar(set string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+	if err != nil {
+		return 0, err
+	}
+	return set[n.Int64()], nil
+}
@@ -0,0 +1,66 @@
+package password
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCommonFile(t *testing.T) {
+	// 加载会修改全局列表，在副本上测试，结束后恢复，-count、-shuffle 时结果不变
+	saved := common
+	common = maps.Clone(saved)
+	t.Cleanup(func() { common = saved })
+
+	if !IsCommon("Password") {
+		t.Fatal("built-in list should ignore case")
+	}
+	if IsCommon("Tr0ub4dor&3x") {
+		t.Fatal("Tr0ub4dor&3x should not be common yet")
+	}
+	path := filepath.Join(t.TempDir(), "common.txt")
+	os.WriteFile(path, []byte("# comment\n\nTr0ub4dor&3x\n  correcthorse  \npassword\n"), 0o600)
+	n, err := LoadCommonFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// password 已经在内置列表中，不重复计数
+	if n != 2 {
+		t.Fatalf("loaded %d, want 2", n)
+	}
+	for _, pwd := range []string{"tr0ub4dor&3x", "CorrectHorse", "password"} {
+		if !IsCommon(pwd) {
+			t.Errorf("%q should be common", pwd)
+		}
+	}
+	if IsCommon("# comment") {
+		t.Error("comments should be skipped")
+	}
+	if _, err = LoadCommonFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing file should fail")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := Policy{MinLength: 8, Classes: []string{ClassUpper, ClassDigit}, NoUserInfo: true, NoCommon: true, UserName: "admin"}
+	tests := []struct {
+		password string
+		fails    int
+	}{
+		{"Xk3vPq9z", 0},
+		{"Xk3v", 1},
+		{"xk3vpq9z", 1},
+		{"Admin123x", 1},
+		{"123456", 3},
+	}
+	for _, tt := range tests {
+		if fails := p.Check(tt.password); len(fails) != tt.fails {
+			t.Errorf("Check(%q) = %d fails, want %d", tt.password, len(fails), tt.fails)
+		}
+	}
+	pwd, err := p.Generate()
+	if err != nil || len(p.Check(pwd)) != 0 {
+		t.Fatalf("Generate() = %q, %v", pwd, err)
+	}
+}
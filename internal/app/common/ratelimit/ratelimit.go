@@ -0,0 +1,84 @@
+// ------------------------------------------------------------------------
+// ------------------------       接口限流       ------------------------
+// ------------------------------------------------------------------------
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 限流对象的类型
+const (
+	KindIP   = "ip"   // 按IP
+	KindUser = "user" // 按登录用户
+)
+
+// 令牌桶：每秒生成 Rate 个令牌，最多积攒 Burst 个，每个请求消耗一个。零值表示不限制
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// 解析限流配置，格式为 次数/单位[,突发数]，单位 s、m、h，突发数默认等于次数，例如 10/m、100/s,200。
+// 为空或者 0 时不限制
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+	rate, burst, hasBurst := strings.Cut(s, ",")
+	count, unit, ok := strings.Cut(rate, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[strings.TrimSpace(unit)]
+	if per == 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: unit must be s, m or h", s)
+	}
+	l := Limit{Rate: float64(n) / per.Seconds(), Burst: n}
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || l.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid rate limit %q", s)
+		}
+	}
+	return l, nil
+}
+
+// 是否不限制
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// 令牌从空到满需要的时间，超过这个时间没有请求的，桶的状态可以删除
+func (l Limit) fill() time.Duration {
+	return time.Duration(math.Ceil(float64(l.Burst) / l.Rate * float64(time.Second)))
+}
+
+// 一次请求的结果
+type Result struct {
+	Allowed    bool          // 是否允许
+	Remaining  int           // 剩余的令牌数
+	RetryAfter time.Duration // 不允许时，需要等待多久才有令牌
+}
+
+// 限流器，取令牌是原子操作，可以是 redis（多实例共享），也可以是内存（单实例部署、本地开发）
+type Limiter interface {
+	// 从 key 对应的桶中取一个令牌
+	Take(key string, l Limit) (Result, error)
+}
+
+// 按当前令牌数计算结果，tokens 为补充令牌之后、扣除之前的令牌数
+func take(tokens float64, l Limit) (float64, Result) {
+	if tokens >= 1 {
+		tokens--
+		return tokens, Result{Allowed: true, Remaining: int(tokens)}
+	}
+	wait := time.Duration(math.Ceil((1 - tokens) / l.Rate * float64(time.Second)))
+	return tokens, Result{RetryAfter: wait}
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// 内存限流器，用于单实例部署和本地开发（多实例部署时每个实例单独计数）
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	expireAt time.Time
+}
+
+// 过期的桶（已经补满）每隔 interval 清理一次，避免占用内存
+func NewMemoryLimiter(interval time.Duration) *MemoryLimiter {
+	m := &MemoryLimiter{buckets: map[string]*bucket{}}
+	if interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				m.cleanup()
+			}
+		}()
+	}
+	return m
+}
+
+func (m *MemoryLimiter) Take(key string, l Limit) (Result, error) {
+	if l.Unlimited() {
+		return Result{Allowed: true}, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	b, ok := m.buckets[key]
+	if !ok || !now.Before(b.expireAt) {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	var result Result
+	b.tokens, result = take(b.tokens, l)
+	b.expireAt = now.Add(l.fill())
+	return result, nil
+}
+
+func (m *MemoryLimiter) cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for key, b := range m.buckets {
+		if !now.Before(b.expireAt) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"errors"
+	"github.com/go-redis/redis"
+	"strconv"
+	"time"
+)
+
+// 在一个脚本中完成补充令牌和扣除，避免并发请求超过限制
+// KEYS[1] 桶的hash（t 令牌数，ts 上次补充的时间）
+// ARGV 当前时间（毫秒）、每毫秒生成的令牌数、桶的容量、过期时间（毫秒）
+// 返回 是否允许、剩余令牌数、需要等待的毫秒数
+var takeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local tokens = tonumber(redis.call('HGET', KEYS[1], 't') or burst)
+local last = tonumber(redis.call('HGET', KEYS[1], 'ts') or now)
+if now > last then
+	tokens = math.min(burst, tokens + (now - last) * rate)
+end
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 't', tostring(tokens), 'ts', math.max(now, last))
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {allowed, math.floor(tokens), wait}
+`)
+
+// redis限流器，每个桶一个hash：prefix+key
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisLimiter(client *redis.Client, prefix string) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix}
+}
+
+func (r *RedisLimiter) Take(key string, l Limit) (Result, error) {
+	if l.Unlimited() {
+		return Result{Allowed: true}, nil
+	}
+	now := time.Now().UnixMilli()
+	rate := strconv.FormatFloat(l.Rate/1000, 'g', -1, 64)
+	res, err := takeScript.Run(r.client, []string{r.prefix + key}, now, rate, l.Burst, l.fill().Milliseconds()).Result()
+	if err != nil {
+		return Result{}, err
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 3 {
+		return Result{}, errors.New("ratelimit: unexpected script result")
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	wait, _ := values[2].(int64)
+	return Result{Allowed: allowed == 1, Remaining: int(remaining), RetryAfter: time.Duration(wait) * time.Millisecond}, nil
+}
@@ -0,0 +1,152 @@
+// ------------------------------------------------------------------------
+// ------------------------       接口鉴权       ------------------------
+// ------------------------------------------------------------------------
+
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 权限表达式：多个权限标识用 ; 号分隔表示满足任意一个即可，用 & 号连接表示必须全部满足，& 优先于 ;
+// 例如 system:user:view&system:dept:view;system:admin 表示同时有前两个权限，或者有 system:admin 权限。
+var ErrInvalid = errors.New("rbac: invalid permission expression")
+
+// 接口的鉴权级别
+type Level string
+
+const (
+	Public        Level = "public"        // 公开接口，不需要登录
+	Authenticated Level = "authenticated" // 登录即可访问
+	Permissioned  Level = "permissioned"  // 登录并且满足权限表达式
+)
+
+// 一个接口的鉴权规则
+type Rule struct {
+	Method     string
+	Path       string // 路由定义的路径（如 /sys/user/getById/:id），不是请求的实际路径
+	Level      Level
+	Permission string     // 原始的权限表达式
+	anyOf      [][]string // 满足任意一组即可，组内的权限标识必须全部满足
+}
+
+// 解析权限表达式，level 为空时按表达式判断：表达式为空是 Authenticated，否则是 Permissioned
+func Parse(level Level, expr string) (Rule, error) {
+	expr = strings.TrimSpace(expr)
+	rule := Rule{Level: level, Permission: expr}
+	if level == "" {
+		rule.Level = Authenticated
+		if expr != "" {
+			rule.Level = Permissioned
+		}
+	}
+	switch rule.Level {
+	case Public, Authenticated:
+		if expr != "" {
+			return Rule{}, fmt.Errorf("%w: %s route must not have permission %q", ErrInvalid, rule.Level, expr)
+		}
+		return rule, nil
+	case Permissioned:
+	default:
+		return Rule{}, fmt.Errorf("%w: unknown level %q", ErrInvalid, level)
+	}
+	for _, term := range strings.Split(expr, ";") {
+		var all []string
+		for _, perm := range strings.Split(term, "&") {
+			perm = strings.TrimSpace(perm)
+			if perm == "" || strings.ContainsAny(perm, " \t") {
+				return Rule{}, fmt.Errorf("%w: %q", ErrInvalid, expr)
+			}
+			all = append(all, perm)
+		}
+		rule.anyOf = append(rule.anyOf, all)
+	}
+	return rule, nil
+}
+
+// 拥有的权限标识是否满足规则（公开接口和登录即可访问的接口都满足）
+func (r Rule) Allow(perms []string) bool {
+	if len(r.anyOf) == 0 {
+		return true
+	}
+	has := make(map[string]struct{}, len(perms))
+	for _, perm := range perms {
+		has[perm] = struct{}{}
+	}
+	for _, all := range r.anyOf {
+		ok := true
+		for _, perm := range all {
+			if _, ok = has[perm]; !ok {
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 按请求方法 + 路由路径保存的鉴权规则
+type Engine struct {
+	mu    sync.RWMutex
+	rules map[string]Rule
+}
+
+func New() *Engine {
+	return &Engine{rules: map[string]Rule{}}
+}
+
+func key(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// 注册接口的鉴权规则，级别和表达式不匹配、表达式不合法或者重复注册时返回错误
+func (e *Engine) Add(method, path string, level Level, expr string) error {
+	rule, err := Parse(level, expr)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	rule.Method, rule.Path = strings.ToUpper(method), path
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	k := key(method, path)
+	if _, ok := e.rules[k]; ok {
+		return fmt.Errorf("rbac: duplicate route %s", k)
+	}
+	e.rules[k] = rule
+	return nil
+}
+
+// 根据请求方法和路由路径（c.Route().Path）获取鉴权规则，HEAD 请求使用 GET 的规则
+func (e *Engine) Match(method, path string) (Rule, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	rule, ok := e.rules[key(method, path)]
+	if !ok && strings.EqualFold(method, http.MethodHead) {
+		rule, ok = e.rules[key(http.MethodGet, path)]
+	}
+	return rule, ok
+}
+
+// 所有的鉴权规则，按路径、方法排序
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	list := make([]Rule, 0, len(e.rules))
+	for _, rule := range e.rules {
+		list = append(list, rule)
+	}
+	e.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list
+}
@@ -0,0 +1,89 @@
+package rbac
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr  string
+		perms []string
+		allow bool
+	}{
+		{"system:user:view", []string{"system:user:view"}, true},
+		{"system:user:view", []string{"system:dept:view"}, false},
+		{"system:user:view;system:dept:view", []string{"system:dept:view"}, true},
+		{"system:user:view;system:dept:view", nil, false},
+		{"system:user:view&system:dept:view", []string{"system:user:view"}, false},
+		{"system:user:view&system:dept:view", []string{"system:dept:view", "system:user:view"}, true},
+		{"system:user:view&system:dept:view;system:admin", []string{"system:admin"}, true},
+		{"system:user:view&system:dept:view;system:admin", []string{"system:user:view"}, false},
+		{" system:user:view ; system:admin ", []string{"system:admin"}, true},
+	}
+	for _, tt := range tests {
+		rule, err := Parse("", tt.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.expr, err)
+		}
+		if rule.Level != Permissioned {
+			t.Errorf("%q: level = %s, want %s", tt.expr, rule.Level, Permissioned)
+		}
+		if got := rule.Allow(tt.perms); got != tt.allow {
+			t.Errorf("%q with %v = %v, want %v", tt.expr, tt.perms, got, tt.allow)
+		}
+	}
+	for _, expr := range []string{"a;;b", "a&", "a b", "&"} {
+		if _, err := Parse("", expr); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: err = %v, want ErrInvalid", expr, err)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if rule, err := Parse("", ""); err != nil || rule.Level != Authenticated || !rule.Allow(nil) {
+		t.Fatalf("empty expression = %+v, %v, want authenticated", rule, err)
+	}
+	if rule, err := Parse(Public, ""); err != nil || !rule.Allow(nil) {
+		t.Fatalf("public = %+v, %v", rule, err)
+	}
+	for _, level := range []Level{Public, Authenticated} {
+		if _, err := Parse(level, "system:user:view"); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s route with permission: err = %v, want ErrInvalid", level, err)
+		}
+	}
+	if _, err := Parse("admin", ""); !errors.Is(err, ErrInvalid) {
+		t.Errorf("unknown level: err = %v, want ErrInvalid", err)
+	}
+}
+
+func TestEngine(t *testing.T) {
+	e := New()
+	if err := e.Add("get", "/sys/user/getById/:id", "", "system:user:view"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Add("GET", "/sys/user/getById/:id", "", ""); err == nil {
+		t.Fatal("duplicate route should fail")
+	}
+	if err := e.Add("POST", "/sys/user/insert", Public, "system:user:add"); err == nil {
+		t.Fatal("invalid rule should fail")
+	}
+	rule, ok := e.Match("GET", "/sys/user/getById/:id")
+	if !ok || rule.Method != "GET" || rule.Path != "/sys/user/getById/:id" || rule.Level != Permissioned {
+		t.Fatalf("Match = %+v, %v", rule, ok)
+	}
+	// HEAD 请求使用 GET 的规则
+	if _, ok = e.Match("HEAD", "/sys/user/getById/:id"); !ok {
+		t.Fatal("HEAD should use the GET rule")
+	}
+	// 按路由路径匹配，不是请求的实际路径
+	if _, ok = e.Match("GET", "/sys/user/getById/1"); ok {
+		t.Fatal("request path should not match")
+	}
+	if _, ok = e.Match("POST", "/sys/user/getById/:id"); ok {
+		t.Fatal("other method should not match")
+	}
+	if n := len(e.Rules()); n != 1 {
+		t.Fatalf("%d rules, want 1", n)
+	}
+}
@@ -0,0 +1,246 @@
+// ------------------------------------------------------------------------
+// ------------------------       RSA密钥管理       ------------------------
+// ------------------------------------------------------------------------
+
+package rsakey
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrKeyNotFound = errors.New("rsa key not found or expired") // 密钥不存在或已过期（轮换后超过了宽限期）
+	ErrDecrypt     = errors.New("rsa decrypt failed")           // 密文格式错误或解密失败
+)
+
+const (
+	bits         = 2048
+	currentFile  = "current.pem"
+	previousFile = "previous.pem"
+	createdAt    = "Created-At" // pem头：密钥的创建时间
+	expireAt     = "Expire-At"  // pem头：轮换下来的旧密钥的过期时间
+)
+
+// 密钥
+type Key struct {
+	Id       string          // 密钥id，公钥的sha256摘要前16位
+	Private  *rsa.PrivateKey // 私钥
+	Created  time.Time       // 创建时间
+	ExpireAt time.Time       // 过期时间，当前密钥为零值
+}
+
+// 公钥信息，返回给前端用于加密
+type PublicKey struct {
+	KeyId     string `json:"keyId"`     // 密钥id，加密的数据需要一起传给后端
+	PublicKey string `json:"publicKey"` // base64编码的PEM格式公钥（PKIX）
+}
+
+// 密钥管理：当前密钥用于加密，轮换后旧密钥在宽限期内仍可以解密（前端可能还在用旧的公钥）
+// 密钥保存在 dir 目录下，重启后不会变化。多实例部署时需要共享这个目录，或者关闭自动轮换
+type Manager struct {
+	mu       sync.RWMutex
+	dir      string        // 密钥保存目录，为空时只保存在内存中
+	rotate   time.Duration // 轮换周期，为0时不轮换
+	grace    time.Duration // 轮换后旧密钥的宽限期
+	current  *Key
+	previous *Key
+}
+
+// 从 dir 目录加载密钥，没有时生成新的密钥并保存
+func NewManager(dir string, rotate, grace time.Duration) (*Manager, error) {
+	m := &Manager{dir: dir, rotate: rotate, grace: grace}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		current, err := m.load(currentFile)
+		if err != nil {
+			return nil, err
+		}
+		m.current = current
+		if previous, err := m.load(previousFile); err == nil && previous != nil && time.Now().Before(previous.ExpireAt) {
+			m.previous = previous
+		}
+	}
+	if m.current == nil {
+		key, err := newKey()
+		if err != nil {
+			return nil, err
+		}
+		m.current = key
+		if err = m.save(currentFile, key); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// 定时检查是否需要轮换，interval 为检查间隔
+func (m *Manager) Start(interval time.Duration) {
+	if m.rotate <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			m.mu.RLock()
+			due := time.Since(m.current.Created) >= m.rotate
+			m.mu.RUnlock()
+			if due {
+				m.Rotate()
+			}
+		}
+	}()
+}
+
+// 立即轮换：生成新的当前密钥，原来的密钥在宽限期内仍可以解密
+func (m *Manager) Rotate() error {
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 在副本上设置过期时间，两个文件都保存成功后才替换，失败时正在使用的密钥不变
+	previous := *m.current
+	previous.ExpireAt = time.Now().Add(m.grace)
+	if err = m.save(previousFile, &previous); err != nil {
+		return err
+	}
+	if err = m.save(currentFile, key); err != nil {
+		return err
+	}
+	m.previous, m.current = &previous, key
+	return nil
+}
+
+// 当前公钥
+func (m *Manager) Public() (PublicKey, error) {
+	m.mu.RLock()
+	key := m.current
+	m.mu.RUnlock()
+	der, err := x509.MarshalPKIXPublicKey(&key.Private.PublicKey)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	block := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return PublicKey{KeyId: key.Id, PublicKey: base64.StdEncoding.EncodeToString(block)}, nil
+}
+
+// 用当前公钥加密（RSA-OAEP SHA-256），返回base64编码的密文
+func (m *Manager) Encrypt(plaintext string) (string, error) {
+	m.mu.RLock()
+	key := m.current
+	m.mu.RUnlock()
+	encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &key.Private.PublicKey, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// 解密base64编码的密文，keyId 为空时依次尝试当前密钥和宽限期内的旧密钥
+func (m *Manager) Decrypt(keyId, ciphertext string) (string, error) {
+	keys := m.keys(keyId)
+	if len(keys) == 0 {
+		return "", ErrKeyNotFound
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	for _, key := range keys {
+		if plaintext, err := key.Private.Decrypt(nil, data, &rsa.OAEPOptions{Hash: crypto.SHA256}); err == nil {
+			return string(plaintext), nil
+		}
+	}
+	return "", ErrDecrypt
+}
+
+// 可以用于解密的密钥
+func (m *Manager) keys(keyId string) []*Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []*Key
+	if keyId == "" || keyId == m.current.Id {
+		keys = append(keys, m.current)
+	}
+	if p := m.previous; p != nil && time.Now().Before(p.ExpireAt) && (keyId == "" || keyId == p.Id) {
+		keys = append(keys, p)
+	}
+	return keys
+}
+
+// 从文件加载密钥，文件不存在时返回空
+func (m *Manager) load(name string) (*Key, error) {
+	data, err := os.ReadFile(filepath.Join(m.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid rsa key file: " + name)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not a rsa private key: " + name)
+	}
+	key := &Key{Id: keyId(private), Private: private}
+	key.Created, _ = time.Parse(time.RFC3339, block.Headers[createdAt])
+	key.ExpireAt, _ = time.Parse(time.RFC3339, block.Headers[expireAt])
+	return key, nil
+}
+
+// 保存密钥到文件，先写临时文件再重命名，避免写到一半时进程退出
+func (m *Manager) save(name string, key *Key) error {
+	if m.dir == "" {
+		return nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{createdAt: key.Created.Format(time.RFC3339)}
+	if !key.ExpireAt.IsZero() {
+		headers[expireAt] = key.ExpireAt.Format(time.RFC3339)
+	}
+	path := filepath.Join(m.dir, name)
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Headers: headers, Bytes: der}), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newKey() (*Key, error) {
+	private, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{Id: keyId(private), Private: private, Created: time.Now()}, nil
+}
+
+// 密钥id：公钥的sha256摘要前16位
+func keyId(private *rsa.PrivateKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
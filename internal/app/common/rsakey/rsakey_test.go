@@ -0,0 +1,130 @@
+package rsakey
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestManager(t *testing.T, dir string, grace time.Duration) *Manager {
+	t.Helper()
+	m, err := NewManager(dir, 0, grace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func encrypt(t *testing.T, m *Manager, plaintext string) (keyId, ciphertext string) {
+	t.Helper()
+	pub, err := m.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ciphertext, err = m.Encrypt(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	return pub.KeyId, ciphertext
+}
+
+func decrypt(t *testing.T, m *Manager, keyId, ciphertext, want string) {
+	t.Helper()
+	got, err := m.Decrypt(keyId, ciphertext)
+	if err != nil || got != want {
+		t.Fatalf("Decrypt(%q) = %q, %v, want %q", keyId, got, err, want)
+	}
+}
+
+// 保存到目录的密钥重启后不变，旧实例加密的数据新实例可以解密
+func TestLoadSave(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir, time.Hour)
+	keyId, ciphertext := encrypt(t, m, "secret")
+
+	loaded := newTestManager(t, dir, time.Hour)
+	if pub, _ := loaded.Public(); pub.KeyId != keyId {
+		t.Fatalf("reloaded key id = %s, want %s", pub.KeyId, keyId)
+	}
+	if !loaded.current.Created.Equal(m.current.Created.Truncate(time.Second)) {
+		t.Fatalf("created = %v, want %v", loaded.current.Created, m.current.Created)
+	}
+	decrypt(t, loaded, keyId, ciphertext, "secret")
+}
+
+// 轮换后旧密钥在宽限期内仍然可以解密，重启后也一样
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir, time.Hour)
+	oldId, ciphertext := encrypt(t, m, "secret")
+	if err := m.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	newId, _ := encrypt(t, m, "secret")
+	if newId == oldId {
+		t.Fatal("key id not changed after rotate")
+	}
+	if !m.current.ExpireAt.IsZero() {
+		t.Fatal("current key should not expire")
+	}
+	decrypt(t, m, oldId, ciphertext, "secret")
+	decrypt(t, m, "", ciphertext, "secret")
+
+	loaded := newTestManager(t, dir, time.Hour)
+	if pub, _ := loaded.Public(); pub.KeyId != newId {
+		t.Fatalf("reloaded key id = %s, want %s", pub.KeyId, newId)
+	}
+	decrypt(t, loaded, oldId, ciphertext, "secret")
+}
+
+// 超过宽限期的旧密钥不能再解密，重启后也不再加载
+func TestGraceExpiry(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir, -time.Second)
+	oldId, ciphertext := encrypt(t, m, "secret")
+	if err := m.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Decrypt(oldId, ciphertext); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Decrypt(expired) = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := m.Decrypt("", ciphertext); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Decrypt(\"\") = %v, want ErrDecrypt", err)
+	}
+	if loaded := newTestManager(t, dir, -time.Second); loaded.previous != nil {
+		t.Fatal("expired previous key should not be loaded")
+	}
+}
+
+func TestDecryptUnknownKey(t *testing.T) {
+	m := newTestManager(t, "", time.Hour)
+	keyId, ciphertext := encrypt(t, m, "secret")
+	if _, err := m.Decrypt("0123456789abcdef", ciphertext); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Decrypt(unknown) = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := m.Decrypt(keyId, "not base64!"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Decrypt(invalid) = %v, want ErrDecrypt", err)
+	}
+}
+
+// 保存失败时正在使用的密钥不变
+func TestRotateSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	m := newTestManager(t, dir, time.Hour)
+	keyId, ciphertext := encrypt(t, m, "secret")
+	// 临时文件的位置是目录，保存当前密钥时失败（旧密钥已经保存成功）
+	if err := os.Mkdir(filepath.Join(dir, currentFile+".tmp"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Rotate(); err == nil {
+		t.Fatal("rotate should fail")
+	}
+	if pub, _ := m.Public(); pub.KeyId != keyId {
+		t.Fatalf("key id = %s, want %s", pub.KeyId, keyId)
+	}
+	if !m.current.ExpireAt.IsZero() || m.previous != nil {
+		t.Fatalf("current expire = %v, previous = %v, want unchanged", m.current.ExpireAt, m.previous)
+	}
+	decrypt(t, m, keyId, ciphertext, "secret")
+}
@@ -0,0 +1,143 @@
+// ------------------------------------------------------------------------
+// ------------------------       安全响应头       ------------------------
+// ------------------------------------------------------------------------
+
+package secure
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	HeaderCSP           = "Content-Security-Policy"
+	HeaderCSPReportOnly = "Content-Security-Policy-Report-Only"
+)
+
+// 默认的安全响应头
+var Defaults = map[string]string{
+	HeaderCSP:                   "default-src 'self'; script-src 'self'; frame-ancestors 'self'; object-src 'none'",
+	"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+	"X-Frame-Options":           "SAMEORIGIN", // 不允许被本域以外的页面嵌入
+	"X-Content-Type-Options":    "nosniff",    // 禁止浏览器猜测 Content-Type
+	"X-XSS-Protection":          "0",          // 旧浏览器的XSS过滤器本身有漏洞，关闭，由CSP防护
+	"Referrer-Policy":           "no-referrer",
+	"X-DNS-Prefetch-Control":    "off",
+	"Cache-Control":             "no-cache, no-store, must-revalidate",
+	"Pragma":                    "no-cache",
+	"Expires":                   "0",
+}
+
+// 响应头配置：名称 -> 值，值为空表示不输出该响应头（用于覆盖默认值）
+type Headers map[string]string
+
+// 按接口路径覆盖的响应头，路径以 * 结尾时按前缀匹配
+type Route struct {
+	Path    string
+	Headers Headers
+}
+
+// CSP 配置
+type CSP struct {
+	Policy     string // 策略，为空时使用 headers 中的 Content-Security-Policy
+	ReportOnly bool   // 只上报不拦截（Content-Security-Policy-Report-Only），用于上线新策略前观察
+	ReportURI  string // 违规报告的上报地址，不为空时追加到策略的 report-uri 中
+}
+
+// 安全响应头策略，创建时合并好每个路径的响应头，请求时不再合并
+type Policy struct {
+	defaults [][2]string
+	routes   []compiled
+}
+
+type compiled struct {
+	path    string
+	headers [][2]string
+}
+
+// 创建策略：默认值 < headers < 路径覆盖，csp.Policy 优先于 headers 中的 CSP，路径单独设置的 CSP 优先于 csp.Policy
+func New(headers Headers, csp CSP, routes []Route) *Policy {
+	base := Headers{}
+	for k, v := range Defaults {
+		base[http.CanonicalHeaderKey(k)] = v
+	}
+	merge(base, headers)
+	p := &Policy{defaults: build(base, csp)}
+	for _, r := range routes {
+		h := Headers{}
+		merge(h, base)
+		merge(h, r.Headers)
+		c := csp
+		if hasKey(r.Headers, HeaderCSP) {
+			c.Policy = "" // 路径单独设置了 CSP 的，使用路径的
+		}
+		p.routes = append(p.routes, compiled{r.Path, build(h, c)})
+	}
+	// 前缀长的优先匹配
+	sort.SliceStable(p.routes, func(i, j int) bool { return len(p.routes[i].path) > len(p.routes[j].path) })
+	return p
+}
+
+func hasKey(h Headers, key string) bool {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func merge(dst, src Headers) {
+	for k, v := range src {
+		dst[http.CanonicalHeaderKey(k)] = v
+	}
+}
+
+func build(headers Headers, csp CSP) [][2]string {
+	h := Headers{}
+	merge(h, headers)
+	policy := h[HeaderCSP]
+	delete(h, HeaderCSP)
+	delete(h, HeaderCSPReportOnly)
+	if csp.Policy != "" {
+		policy = csp.Policy
+	}
+	if policy != "" {
+		if csp.ReportURI != "" && !strings.Contains(policy, "report-uri") {
+			policy = strings.TrimSuffix(strings.TrimSpace(policy), ";") + "; report-uri " + csp.ReportURI
+		}
+		if csp.ReportOnly {
+			h[HeaderCSPReportOnly] = policy
+		} else {
+			h[HeaderCSP] = policy
+		}
+	}
+	list := make([][2]string, 0, len(h))
+	for k, v := range h {
+		if v != "" {
+			list = append(list, [2]string{k, v})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i][0] < list[j][0] })
+	return list
+}
+
+// 请求路径对应的响应头，路由不区分大小写、忽略末尾的 /（fiber 默认配置），所以匹配前统一转小写并去掉末尾的 /
+func (p *Policy) Headers(path string) [][2]string {
+	path = normalize(path)
+	for _, r := range p.routes {
+		if prefix, ok := strings.CutSuffix(r.path, "*"); ok {
+			if strings.HasPrefix(path+"/", strings.ToLower(prefix)) {
+				return r.headers
+			}
+		} else if path == normalize(r.path) {
+			return r.headers
+		}
+	}
+	return p.defaults
+}
+
+func normalize(path string) string {
+	return strings.ToLower(strings.TrimRight(path, "/"))
+}
@@ -0,0 +1,126 @@
+package secure
+
+import (
+	"net/http"
+	"testing"
+)
+
+func toMap(list [][2]string) map[string]string {
+	m := map[string]string{}
+	for _, h := range list {
+		m[h[0]] = h[1]
+	}
+	return m
+}
+
+func TestDefaults(t *testing.T) {
+	got := toMap(New(nil, CSP{}, nil).Headers("/sys/user/list"))
+	if len(got) != len(Defaults) {
+		t.Fatalf("got %d headers, want %d", len(got), len(Defaults))
+	}
+	for k, v := range Defaults {
+		if got[http.CanonicalHeaderKey(k)] != v {
+			t.Errorf("%s = %q, want %q", k, got[http.CanonicalHeaderKey(k)], v)
+		}
+	}
+}
+
+func TestHeadersOverride(t *testing.T) {
+	p := New(Headers{"x-frame-options": "DENY", "Pragma": "", "X-Custom": "1"}, CSP{}, nil)
+	got := toMap(p.Headers("/"))
+	if got["X-Frame-Options"] != "DENY" {
+		t.Errorf("X-Frame-Options = %q, want DENY", got["X-Frame-Options"])
+	}
+	if _, ok := got["Pragma"]; ok {
+		t.Error("empty value should remove the header")
+	}
+	if got["X-Custom"] != "1" {
+		t.Errorf("X-Custom = %q, want 1", got["X-Custom"])
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	p := New(nil, CSP{}, []Route{
+		{Path: "/sys/*", Headers: Headers{"X-Frame-Options": "DENY"}},
+		{Path: "/sys/user/*", Headers: Headers{"X-Frame-Options": "ALLOW-FROM-USER"}},
+		{Path: "/sys/user/upload", Headers: Headers{"X-Frame-Options": "", "Cache-Control": "private"}},
+	})
+	tests := []struct {
+		path  string
+		frame string
+		cache string
+	}{
+		{"/", "SAMEORIGIN", Defaults["Cache-Control"]},
+		{"/system", "SAMEORIGIN", Defaults["Cache-Control"]},
+		{"/sys/dept/list", "DENY", Defaults["Cache-Control"]},
+		{"/sys/user/list", "ALLOW-FROM-USER", Defaults["Cache-Control"]},
+		{"/sys/user/upload", "", "private"},
+		{"/sys/user/upload/x", "ALLOW-FROM-USER", Defaults["Cache-Control"]},
+		// 大小写和末尾的 / 不影响匹配（和路由一致，/sys 和 /sys/ 是同一个路由）
+		{"/sys", "DENY", Defaults["Cache-Control"]},
+		{"/SYS/Dept/list", "DENY", Defaults["Cache-Control"]},
+		{"/SYS/USER/UPLOAD/", "", "private"},
+		{"/sys/user/upload//", "", "private"},
+	}
+	for _, tt := range tests {
+		got := toMap(p.Headers(tt.path))
+		if got["X-Frame-Options"] != tt.frame || got["Cache-Control"] != tt.cache {
+			t.Errorf("%s: X-Frame-Options = %q, Cache-Control = %q, want %q, %q",
+				tt.path, got["X-Frame-Options"], got["Cache-Control"], tt.frame, tt.cache)
+		}
+		if got["X-Content-Type-Options"] != "nosniff" {
+			t.Errorf("%s: route headers should keep the defaults", tt.path)
+		}
+	}
+}
+
+func TestCSP(t *testing.T) {
+	const policy = "default-src 'self'"
+	tests := []struct {
+		name       string
+		headers    Headers
+		csp        CSP
+		routes     []Route
+		path       string
+		header     string
+		want       string
+		wantAbsent string
+	}{
+		{"default", nil, CSP{}, nil, "/", HeaderCSP, Defaults[HeaderCSP], HeaderCSPReportOnly},
+		{"policy", nil, CSP{Policy: policy}, nil, "/", HeaderCSP, policy, HeaderCSPReportOnly},
+		{"headers", Headers{HeaderCSP: policy}, CSP{}, nil, "/", HeaderCSP, policy, HeaderCSPReportOnly},
+		{"report only", nil, CSP{Policy: policy, ReportOnly: true}, nil, "/", HeaderCSPReportOnly, policy, HeaderCSP},
+		{"report uri", nil, CSP{Policy: policy + ";", ReportURI: "/sys/csp/report"}, nil, "/", HeaderCSP,
+			policy + "; report-uri /sys/csp/report", HeaderCSPReportOnly},
+		{"keep report uri", nil, CSP{Policy: policy + "; report-uri /other", ReportURI: "/sys/csp/report"}, nil, "/", HeaderCSP,
+			policy + "; report-uri /other", HeaderCSPReportOnly},
+		{"report only with uri", nil, CSP{Policy: policy, ReportOnly: true, ReportURI: "/r"}, nil, "/", HeaderCSPReportOnly,
+			policy + "; report-uri /r", HeaderCSP},
+		{"route", nil, CSP{Policy: policy}, []Route{{Path: "/doc/*", Headers: Headers{HeaderCSP: "default-src *"}}}, "/doc/a", HeaderCSP,
+			"default-src *", HeaderCSPReportOnly},
+		{"route keeps global", nil, CSP{Policy: policy}, []Route{{Path: "/doc/*", Headers: Headers{"X-Frame-Options": "DENY"}}}, "/doc/a", HeaderCSP,
+			policy, HeaderCSPReportOnly},
+		{"route report only", nil, CSP{Policy: policy, ReportOnly: true}, []Route{{Path: "/doc/*", Headers: Headers{HeaderCSP: "default-src *"}}}, "/doc/a",
+			HeaderCSPReportOnly, "default-src *", HeaderCSP},
+		{"disabled", Headers{HeaderCSP: ""}, CSP{}, nil, "/", HeaderCSP, "", HeaderCSPReportOnly},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toMap(New(tt.headers, tt.csp, tt.routes).Headers(tt.path))
+			if got[tt.header] != tt.want {
+				t.Errorf("%s = %q, want %q", tt.header, got[tt.header], tt.want)
+			}
+			if _, ok := got[tt.wantAbsent]; ok {
+				t.Errorf("%s should not be set", tt.wantAbsent)
+			}
+		})
+	}
+}
+
+func TestNewDoesNotMutateDefaults(t *testing.T) {
+	before := Defaults[HeaderCSP]
+	New(Headers{HeaderCSP: "default-src *"}, CSP{Policy: "x", ReportURI: "/r"}, []Route{{Path: "/a", Headers: Headers{"X-Frame-Options": "DENY"}}})
+	if Defaults[HeaderCSP] != before || Defaults["X-Frame-Options"] != "SAMEORIGIN" {
+		t.Fatal("New must not modify Defaults")
+	}
+}
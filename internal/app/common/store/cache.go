@@ -0,0 +1,35 @@
+// ------------------------------------------------------------------------
+// ------------------------       通用缓存存储       ------------------------
+// ------------------------------------------------------------------------
+
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// 缓存不存在或已过期
+var ErrNotFound = errors.New("cache not found")
+
+// 带有效期的键值缓存，用于防重放的nonce、验证码等短期数据，可以是 redis，也可以是内存
+type Cache interface {
+	// 设置缓存，expire 不大于0时永不过期
+	Set(key, value string, expire time.Duration) error
+	// key 不存在时才设置，返回是否设置成功
+	SetNX(key, value string, expire time.Duration) (bool, error)
+	// 获取缓存，不存在时返回 ErrNotFound
+	Get(key string) (string, error)
+	// 获取并删除缓存（只能取一次），不存在时返回 ErrNotFound
+	Take(key string) (string, error)
+	// 删除缓存
+	Del(keys ...string) error
+	// 获取哈希的全部字段，不存在时返回 ErrNotFound
+	HGetAll(key string) (map[string]string, error)
+	// 设置哈希的字段，不改变原有的有效期
+	HSet(key string, values map[string]string) error
+	// 删除哈希的字段
+	HDel(key string, fields ...string) error
+	// 设置有效期，expire 不大于0时永不过期
+	Expire(key string, expire time.Duration) error
+}
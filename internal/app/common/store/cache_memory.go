@@ -0,0 +1,155 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// 内存缓存，用于本地开发和单元测试（多实例部署时不可用）
+type MemoryCache struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+}
+
+type memoryItem struct {
+	value    string
+	hash     map[string]string // 哈希类型的缓存
+	expireAt time.Time         // 过期时间，零值表示永不过期
+}
+
+// 过期的缓存在访问时判断，另外每隔 interval 清理一次，避免占用内存
+func NewMemoryCache(interval time.Duration) *MemoryCache {
+	m := &MemoryCache{items: map[string]memoryItem{}}
+	if interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				m.cleanup()
+			}
+		}()
+	}
+	return m
+}
+
+func (m *MemoryCache) Set(key, value string, expire time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = memoryItem{value: value, expireAt: expireAt(expire)}
+	return nil
+}
+
+func (m *MemoryCache) SetNX(key, value string, expire time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(key); ok {
+		return false, nil
+	}
+	m.items[key] = memoryItem{value: value, expireAt: expireAt(expire)}
+	return true, nil
+}
+
+func (m *MemoryCache) Get(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if item, ok := m.get(key); ok {
+		return item.value, nil
+	}
+	return "", ErrNotFound
+}
+
+func (m *MemoryCache) Take(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	delete(m.items, key)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return item.value, nil
+}
+
+func (m *MemoryCache) Del(keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+func (m *MemoryCache) HGetAll(key string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok || len(item.hash) == 0 {
+		return nil, ErrNotFound
+	}
+	values := make(map[string]string, len(item.hash))
+	for k, v := range item.hash {
+		values[k] = v
+	}
+	return values, nil
+}
+
+func (m *MemoryCache) HSet(key string, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok || item.hash == nil {
+		item = memoryItem{hash: map[string]string{}, expireAt: item.expireAt}
+	}
+	for k, v := range values {
+		item.hash[k] = v
+	}
+	m.items[key] = item
+	return nil
+}
+
+func (m *MemoryCache) HDel(key string, fields ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		return nil
+	}
+	for _, field := range fields {
+		delete(item.hash, field)
+	}
+	// 和 redis 一样，字段全部删除后整个缓存也不存在了
+	if len(item.hash) == 0 {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+func (m *MemoryCache) Expire(key string, expire time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if item, ok := m.get(key); ok {
+		item.expireAt = expireAt(expire)
+		m.items[key] = item
+	}
+	return nil
+}
+
+// 获取未过期的缓存，调用方需要持有锁
+func (m *MemoryCache) get(key string) (memoryItem, bool) {
+	item, ok := m.items[key]
+	if !ok || (!item.expireAt.IsZero() && time.Now().After(item.expireAt)) {
+		return memoryItem{}, false
+	}
+	return item, true
+}
+
+// 清理已过期的缓存
+func (m *MemoryCache) cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.items {
+		if _, ok := m.get(key); !ok {
+			delete(m.items, key)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	m := NewMemoryCache(0)
+	m.Set("a", "1", time.Hour)
+	if v, err := m.Get("a"); err != nil || v != "1" {
+		t.Fatalf("Get(a) = %q, %v", v, err)
+	}
+	if ok, _ := m.SetNX("a", "2", time.Hour); ok {
+		t.Fatal("SetNX on existing key should fail")
+	}
+	if ok, _ := m.SetNX("b", "2", 20*time.Millisecond); !ok {
+		t.Fatal("SetNX on missing key should succeed")
+	}
+	// 只能取一次
+	if v, err := m.Take("a"); err != nil || v != "1" {
+		t.Fatalf("Take(a) = %q, %v", v, err)
+	}
+	if _, err := m.Take("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Take(a) = %v, want ErrNotFound", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := m.Get("b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(b) = %v, want expired", err)
+	}
+	// 过期后可以重新设置
+	if ok, _ := m.SetNX("b", "3", time.Hour); !ok {
+		t.Fatal("SetNX on expired key should succeed")
+	}
+	m.Del("b")
+	if _, err := m.Get("b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(b) after Del = %v", err)
+	}
+}
+
+// 并发获取同一个缓存，只有一个能取到（防重放）
+func TestMemoryCacheTakeOnce(t *testing.T) {
+	m := NewMemoryCache(0)
+	m.Set("nonce", "1", time.Minute)
+	var taken atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Take("nonce"); err == nil {
+				taken.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := taken.Load(); n != 1 {
+		t.Fatalf("taken %d times, want 1", n)
+	}
+}
+
+func TestMemoryCacheHash(t *testing.T) {
+	m := NewMemoryCache(0)
+	if _, err := m.HGetAll("h"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("HGetAll on missing key = %v, want ErrNotFound", err)
+	}
+	m.HSet("h", map[string]string{"r1": "a;b", "r2": "c"})
+	m.HSet("h", map[string]string{"r2": "d"})
+	values, err := m.HGetAll("h")
+	if err != nil || values["r1"] != "a;b" || values["r2"] != "d" {
+		t.Fatalf("HGetAll(h) = %v, %v", values, err)
+	}
+	// 返回的是副本
+	values["r1"] = "x"
+	if values, _ = m.HGetAll("h"); values["r1"] != "a;b" {
+		t.Fatal("HGetAll should return a copy")
+	}
+	m.HDel("h", "r1")
+	if values, _ = m.HGetAll("h"); len(values) != 1 {
+		t.Fatalf("HGetAll(h) after HDel = %v", values)
+	}
+	// 字段全部删除后整个缓存不存在
+	m.HDel("h", "r2")
+	if _, err := m.HGetAll("h"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("HGetAll after deleting all fields = %v, want ErrNotFound", err)
+	}
+
+	// HSet 不改变有效期
+	m.HSet("scope", map[string]string{"childId": "1"})
+	m.Expire("scope", 20*time.Millisecond)
+	m.HSet("scope", map[string]string{"childName": "x"})
+	time.Sleep(30 * time.Millisecond)
+	if _, err := m.HGetAll("scope"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("HGetAll(scope) = %v, want expired", err)
+	}
+	m.HSet("scope", map[string]string{"childId": "1"})
+	m.Expire("scope", 20*time.Millisecond)
+	m.Expire("scope", -1)
+	time.Sleep(30 * time.Millisecond)
+	if _, err := m.HGetAll("scope"); err != nil {
+		t.Fatalf("HGetAll(scope) = %v, want no expiry", err)
+	}
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// redis 缓存
+type RedisCache struct {
+	client *redis.Client
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (r *RedisCache) Set(key, value string, expire time.Duration) error {
+	return r.client.Set(key, value, ttl(expire)).Err()
+}
+
+func (r *RedisCache) SetNX(key, value string, expire time.Duration) (bool, error) {
+	return r.client.SetNX(key, value, ttl(expire)).Result()
+}
+
+func (r *RedisCache) Get(key string) (string, error) {
+	val, err := r.client.Get(key).Result()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	return val, err
+}
+
+func (r *RedisCache) Take(key string) (string, error) {
+	// GET 和 DEL 放在同一个事务中执行，保证并发时只有一个请求能取到
+	var get *redis.StringCmd
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return get.Val(), nil
+}
+
+func (r *RedisCache) Del(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(keys...).Err()
+}
+
+func (r *RedisCache) HGetAll(key string) (map[string]string, error) {
+	values, err := r.client.HGetAll(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+	return values, nil
+}
+
+func (r *RedisCache) HSet(key string, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	fields := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		fields[k] = v
+	}
+	return r.client.HMSet(key, fields).Err()
+}
+
+func (r *RedisCache) HDel(key string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return r.client.HDel(key, fields...).Err()
+}
+
+func (r *RedisCache) Expire(key string, expire time.Duration) error {
+	// EXPIRE 0 会直接删除 key，永不过期用 PERSIST
+	if expire <= 0 {
+		return r.client.Persist(key).Err()
+	}
+	return r.client.Expire(key, expire).Err()
+}
+
+// redis 中过期时间为0表示永不过期
+func ttl(expire time.Duration) time.Duration {
+	if expire < 0 {
+		return 0
+	}
+	return expire
+}
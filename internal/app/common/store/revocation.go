@@ -0,0 +1,16 @@
+// ------------------------------------------------------------------------
+// ------------------------     jwt会话注销列表     ------------------------
+// ------------------------------------------------------------------------
+
+package store
+
+import "time"
+
+// jwt模式下已经注销的会话（sid），访问令牌在有效期内仍然可以通过签名校验，需要在注销列表中排除。
+// 每个请求都要检查，所以检查只在本地内存中进行，不访问redis
+type Revocations interface {
+	// 注销会话，ttl 为访问令牌的最长有效期，超过后令牌自然失效，不需要再记录
+	Revoke(sid string, ttl time.Duration) error
+	// 会话是否已经注销
+	Revoked(sid string) bool
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// 内存注销列表，用于单实例部署、本地开发和单元测试
+type MemoryRevocations struct {
+	mu   sync.RWMutex
+	sids map[string]time.Time // sid => 记录的过期时间
+}
+
+// 过期的记录每隔 interval 清理一次
+func NewMemoryRevocations(interval time.Duration) *MemoryRevocations {
+	m := &MemoryRevocations{sids: map[string]time.Time{}}
+	if interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				m.cleanup()
+			}
+		}()
+	}
+	return m
+}
+
+func (m *MemoryRevocations) Revoke(sid string, ttl time.Duration) error {
+	m.add(sid, time.Now().Add(ttl))
+	return nil
+}
+
+func (m *MemoryRevocations) Revoked(sid string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	expireAt, ok := m.sids[sid]
+	return ok && time.Now().Before(expireAt)
+}
+
+// 记录注销的会话，已经有记录时保留较晚的过期时间
+func (m *MemoryRevocations) add(sid string, expireAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.sids[sid]; !ok || expireAt.After(old) {
+		m.sids[sid] = expireAt
+	}
+}
+
+// 清理已过期的记录
+func (m *MemoryRevocations) cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for sid, expireAt := range m.sids {
+		if !now.Before(expireAt) {
+			delete(m.sids, sid)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRevocations(t *testing.T) {
+	m := NewMemoryRevocations(0)
+	if m.Revoked("a") {
+		t.Fatal("a should not be revoked")
+	}
+	m.Revoke("a", time.Hour)
+	m.Revoke("b", 20*time.Millisecond)
+	if !m.Revoked("a") || !m.Revoked("b") {
+		t.Fatal("a and b should be revoked")
+	}
+	// 已经有记录时保留较晚的过期时间
+	m.Revoke("a", time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if !m.Revoked("a") {
+		t.Fatal("a should still be revoked")
+	}
+	if m.Revoked("b") {
+		t.Fatal("b should have expired")
+	}
+	m.cleanup()
+	if len(m.sids) != 1 {
+		t.Fatalf("%d records after cleanup, want 1", len(m.sids))
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// redis 注销列表：注销记录保存在有序集合中（分数为过期时间的秒级时间戳），同时通过发布订阅通知所有实例，
+// 每个实例在本地内存中保存一份用于检查。订阅断开期间可能会丢失通知，所以每隔 interval 从有序集合全量同步一次
+type RedisRevocations struct {
+	client *redis.Client
+	key    string // 有序集合的key，同时也是发布订阅的频道
+	local  *MemoryRevocations
+}
+
+func NewRedisRevocations(client *redis.Client, key string, interval time.Duration) *RedisRevocations {
+	r := &RedisRevocations{client: client, key: key, local: NewMemoryRevocations(interval)}
+	r.sync()
+	go r.subscribe()
+	if interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				r.sync()
+			}
+		}()
+	}
+	return r
+}
+
+func (r *RedisRevocations) Revoke(sid string, ttl time.Duration) error {
+	expireAt := time.Now().Add(ttl)
+	r.local.add(sid, expireAt)
+	score := strconv.FormatInt(expireAt.Unix(), 10)
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(r.key, redis.Z{Score: float64(expireAt.Unix()), Member: sid})
+		pipe.ZRemRangeByScore(r.key, "-inf", strconv.FormatInt(time.Now().Unix(), 10)) // 顺便清理过期的记录
+		pipe.Publish(r.key, sid+" "+score)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisRevocations) Revoked(sid string) bool {
+	return r.local.Revoked(sid)
+}
+
+// 从有序集合同步所有未过期的记录
+func (r *RedisRevocations) sync() {
+	list, err := r.client.ZRangeByScoreWithScores(r.key, redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return
+	}
+	for _, z := range list {
+		if sid, ok := z.Member.(string); ok {
+			r.local.add(sid, time.Unix(int64(z.Score), 0))
+		}
+	}
+}
+
+// 接收其他实例的注销通知，消息格式为 "sid 过期时间"，断开后会自动重连
+func (r *RedisRevocations) subscribe() {
+	for msg := range r.client.Subscribe(r.key).Channel() {
+		sid, score, ok := strings.Cut(msg.Payload, " ")
+		expireAt, err := strconv.ParseInt(score, 10, 64)
+		if ok && err == nil {
+			r.local.add(sid, time.Unix(expireAt, 0))
+		}
+	}
+}
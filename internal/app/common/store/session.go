@@ -0,0 +1,60 @@
+// ------------------------------------------------------------------------
+// ------------------------       登录会话存储       ------------------------
+// ------------------------------------------------------------------------
+
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")     // 会话不存在或已过期
+	ErrRefreshInvalid  = errors.New("refresh token invalid") // 刷新令牌不正确
+	ErrRefreshReused   = errors.New("refresh token reused")  // 刷新令牌已经使用过（可能被盗用）
+)
+
+// 永不过期的会话，TTL 返回该值
+const NoExpire time.Duration = -1
+
+// 每个会话最多保留多少个已经轮换掉的刷新令牌摘要，用于发现重复使用
+const MaxUsedRefresh = 20
+
+// 登录会话
+type Session struct {
+	Id         string        `json:"id"`         // 会话编号，用于展示和注销，不能用来访问接口
+	Token      string        `json:"token"`      // 令牌（jwt模式下为会话id）
+	UserId     string        `json:"userId"`     // 用户id，同一用户的会话按它建立索引
+	User       string        `json:"user"`       // 登录用户信息（json）
+	LoginType  string        `json:"loginType"`  // 登录类型
+	IP         string        `json:"ip"`         // 登录IP
+	UserAgent  string        `json:"userAgent"`  // 登录设备（User-Agent）
+	CreateTime int64         `json:"createTime"` // 创建时间（秒级时间戳）
+	Expire     time.Duration `json:"expire"`     // 有效期，小于0表示永不过期
+	Refresh    string        `json:"refresh"`    // 当前有效的刷新令牌摘要（jwt模式）
+	Restrict   string        `json:"restrict"`   // 会话限制，不为空时只能访问限制范围内的接口
+}
+
+// 会话存储，所有与登录会话相关的读写都通过它完成，可以是 redis，也可以是内存
+type SessionStore interface {
+	// 新建会话，s.Expire 小于0时永不过期
+	Create(s *Session) error
+	// 根据token获取会话，不存在时返回 ErrSessionNotFound
+	Get(token string) (*Session, error)
+	// 更新会话中的用户信息
+	SetUser(token, user string) error
+	// 更新会话限制，为空时解除限制
+	SetRestrict(token, restrict string) error
+	// 刷新有效期，expire 小于0时改为永不过期
+	Touch(token string, expire time.Duration) error
+	// 注销会话
+	Revoke(tokens ...string) error
+	// 获取某个用户所有未过期的会话
+	ListByUser(userId string) ([]*Session, error)
+	// 获取剩余有效时长，永不过期返回 NoExpire，不存在返回 ErrSessionNotFound
+	TTL(token string) (time.Duration, error)
+	// 轮换刷新令牌：used 与当前有效的摘要一致时替换为 next；
+	// used 是已经轮换掉的旧令牌时返回 ErrRefreshReused，其他情况返回 ErrRefreshInvalid
+	Rotate(token, used, next string) error
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// 内存会话存储，用于本地开发和单元测试（不依赖redis，多实例部署时不可用）
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*memorySession
+}
+
+type memorySession struct {
+	session  Session
+	expireAt time.Time // 过期时间，零值表示永不过期
+	used     []string  // 已经轮换掉的刷新令牌摘要（最近的在前，最多 MaxUsedRefresh 个）
+}
+
+// 过期的会话在访问时判断，另外每隔 interval 清理一次，避免占用内存
+func NewMemorySessionStore(interval time.Duration) *MemorySessionStore {
+	m := &MemorySessionStore{sessions: map[string]*memorySession{}}
+	if interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				m.cleanup()
+			}
+		}()
+	}
+	return m
+}
+
+func (m *MemorySessionStore) Create(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.Token] = &memorySession{session: *s, expireAt: expireAt(s.Expire)}
+	return nil
+}
+
+func (m *MemorySessionStore) Get(token string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	item := m.get(token)
+	if item == nil {
+		return nil, ErrSessionNotFound
+	}
+	s := item.session
+	return &s, nil
+}
+
+func (m *MemorySessionStore) SetUser(token, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item := m.get(token)
+	if item == nil {
+		return ErrSessionNotFound
+	}
+	item.session.User = user
+	return nil
+}
+
+func (m *MemorySessionStore) SetRestrict(token, restrict string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item := m.get(token)
+	if item == nil {
+		return ErrSessionNotFound
+	}
+	item.session.Restrict = restrict
+	return nil
+}
+
+func (m *MemorySessionStore) Touch(token string, expire time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item := m.get(token)
+	if item == nil {
+		return ErrSessionNotFound
+	}
+	item.expireAt = expireAt(expire)
+	return nil
+}
+
+func (m *MemorySessionStore) Revoke(tokens ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, token := range tokens {
+		delete(m.sessions, token)
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) ListByUser(userId string) ([]*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var list []*Session
+	for token, item := range m.sessions {
+		if item.session.UserId != userId {
+			continue
+		}
+		if item := m.get(token); item != nil {
+			s := item.session
+			list = append(list, &s)
+		}
+	}
+	return list, nil
+}
+
+func (m *MemorySessionStore) TTL(token string) (time.Duration, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	item := m.get(token)
+	if item == nil {
+		return 0, ErrSessionNotFound
+	}
+	if item.expireAt.IsZero() {
+		return NoExpire, nil
+	}
+	return time.Until(item.expireAt), nil
+}
+
+func (m *MemorySessionStore) Rotate(token, used, next string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item := m.get(token)
+	if item == nil {
+		return ErrSessionNotFound
+	}
+	if item.session.Refresh == "" || item.session.Refresh != used {
+		for _, digest := range item.used {
+			if digest == used {
+				return ErrRefreshReused
+			}
+		}
+		return ErrRefreshInvalid
+	}
+	item.used = append([]string{used}, item.used[:min(len(item.used), MaxUsedRefresh-1)]...)
+	item.session.Refresh = next
+	return nil
+}
+
+// 获取未过期的会话，调用方需要持有锁
+func (m *MemorySessionStore) get(token string) *memorySession {
+	item, ok := m.sessions[token]
+	if !ok || (!item.expireAt.IsZero() && time.Now().After(item.expireAt)) {
+		return nil
+	}
+	return item
+}
+
+// 清理已过期的会话
+func (m *MemorySessionStore) cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for token := range m.sessions {
+		if m.get(token) == nil {
+			delete(m.sessions, token)
+		}
+	}
+}
+
+// 根据有效期计算过期时间，不大于0表示永不过期
+func expireAt(expire time.Duration) time.Time {
+	if expire <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(expire)
+}
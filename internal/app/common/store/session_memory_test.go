@@ -0,0 +1,111 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemorySession(t *testing.T) {
+	m := NewMemorySessionStore(0)
+	m.Create(&Session{Token: "a", UserId: "u1", User: "{}", Expire: time.Hour})
+	m.Create(&Session{Token: "b", UserId: "u1", Expire: -1})
+	m.Create(&Session{Token: "c", UserId: "u2", Expire: time.Hour})
+
+	s, err := m.Get("a")
+	if err != nil || s.UserId != "u1" {
+		t.Fatalf("Get(a) = %+v, %v", s, err)
+	}
+	// 返回的是副本，修改不影响存储中的会话
+	s.User = "changed"
+	if s, _ = m.Get("a"); s.User != "{}" {
+		t.Fatal("Get should return a copy")
+	}
+	m.SetUser("a", `{"id":"u1"}`)
+	m.SetRestrict("a", "pwdExpired")
+	if s, _ = m.Get("a"); s.User != `{"id":"u1"}` || s.Restrict != "pwdExpired" {
+		t.Fatalf("session = %+v", s)
+	}
+	if err := m.SetUser("x", ""); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("SetUser(x) = %v, want ErrSessionNotFound", err)
+	}
+
+	if ttl, _ := m.TTL("b"); ttl != NoExpire {
+		t.Fatalf("TTL(b) = %s, want NoExpire", ttl)
+	}
+	if ttl, _ := m.TTL("a"); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("TTL(a) = %s", ttl)
+	}
+	if list, _ := m.ListByUser("u1"); len(list) != 2 {
+		t.Fatalf("ListByUser(u1) = %d sessions, want 2", len(list))
+	}
+
+	m.Revoke("a", "b")
+	if _, err := m.Get("a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Get(a) after revoke = %v", err)
+	}
+	if list, _ := m.ListByUser("u1"); len(list) != 0 {
+		t.Fatalf("ListByUser(u1) = %d sessions after revoke, want 0", len(list))
+	}
+}
+
+func TestMemorySessionExpire(t *testing.T) {
+	m := NewMemorySessionStore(0)
+	m.Create(&Session{Token: "a", UserId: "u1", Expire: 20 * time.Millisecond})
+	m.Create(&Session{Token: "b", UserId: "u1", Expire: 20 * time.Millisecond})
+	// 刷新有效期后不会过期
+	m.Touch("b", -1)
+	time.Sleep(30 * time.Millisecond)
+	if _, err := m.Get("a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Get(a) = %v, want expired", err)
+	}
+	if _, err := m.TTL("a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("TTL(a) = %v, want expired", err)
+	}
+	if list, _ := m.ListByUser("u1"); len(list) != 1 || list[0].Token != "b" {
+		t.Fatalf("ListByUser(u1) = %v, want only b", list)
+	}
+	m.cleanup()
+	if len(m.sessions) != 1 {
+		t.Fatalf("%d sessions after cleanup, want 1", len(m.sessions))
+	}
+}
+
+func TestMemorySessionRotate(t *testing.T) {
+	m := NewMemorySessionStore(0)
+	m.Create(&Session{Token: "a", Refresh: "r1", Expire: time.Hour})
+	if err := m.Rotate("a", "r1", "r2"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := m.Get("a"); s.Refresh != "r2" {
+		t.Fatalf("refresh = %q, want r2", s.Refresh)
+	}
+	// 再次使用已经轮换掉的刷新令牌
+	if err := m.Rotate("a", "r1", "r3"); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("Rotate(r1) = %v, want ErrRefreshReused", err)
+	}
+	if err := m.Rotate("a", "xx", "r3"); !errors.Is(err, ErrRefreshInvalid) {
+		t.Fatalf("Rotate(xx) = %v, want ErrRefreshInvalid", err)
+	}
+	if err := m.Rotate("b", "r2", "r3"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Rotate on missing session = %v, want ErrSessionNotFound", err)
+	}
+}
+
+// 已经轮换掉的刷新令牌只保留最近的 MaxUsedRefresh 个
+func TestMemorySessionRotateBounded(t *testing.T) {
+	m := NewMemorySessionStore(0)
+	m.Create(&Session{Token: "a", Refresh: "r0", Expire: time.Hour})
+	for i := 1; i <= MaxUsedRefresh+5; i++ {
+		if err := m.Rotate("a", fmt.Sprintf("r%d", i-1), fmt.Sprintf("r%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(m.sessions["a"].used); n != MaxUsedRefresh {
+		t.Fatalf("%d used digests kept, want %d", n, MaxUsedRefresh)
+	}
+	if err := m.Rotate("a", fmt.Sprintf("r%d", MaxUsedRefresh+4), "x"); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("recent digest = %v, want ErrRefreshReused", err)
+	}
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 轮换刷新令牌，用过的令牌摘要以逗号分隔保存在会话的 used 字段中（最近的在前，最多 ARGV[3] 个），用于发现重复使用
+var rotateScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'refresh')
+if not current then
+	return -1
+end
+local used = redis.call('HGET', KEYS[1], 'used') or ''
+if current == ARGV[1] then
+	local list = {ARGV[1]}
+	for digest in string.gmatch(used, '[^,]+') do
+		if #list >= tonumber(ARGV[3]) then
+			break
+		end
+		table.insert(list, digest)
+	end
+	redis.call('HSET', KEYS[1], 'refresh', ARGV[2], 'used', table.concat(list, ','))
+	return 1
+end
+for digest in string.gmatch(used, '[^,]+') do
+	if digest == ARGV[1] then
+		return 2
+	end
+end
+return 0
+`)
+
+// 会话存在时才更新字段，检查和写入在同一个脚本中执行，避免已经过期或注销的会话被重新创建
+var setScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+end
+return -1
+`)
+
+// redis 会话存储，每个会话是一个hash：prefix+token => {id, userId, user, createTime, expire, ...}
+// 另外每个用户有一个set索引：prefix+index:userId => {token...}，过期会话在查询时从索引中清理
+type RedisSessionStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisSessionStore(client *redis.Client, prefix string) *RedisSessionStore {
+	return &RedisSessionStore{client: client, prefix: prefix}
+}
+
+func (r *RedisSessionStore) Create(s *Session) error {
+	var expire float64 = -1 // 有效时长（秒）
+	if s.Expire > 0 {
+		expire = s.Expire.Seconds()
+	}
+	key := r.prefix + s.Token
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(key, map[string]any{
+			"id":         s.Id,
+			"userId":     s.UserId,
+			"user":       s.User,
+			"loginType":  s.LoginType,
+			"ip":         s.IP,
+			"userAgent":  s.UserAgent,
+			"createTime": s.CreateTime,
+			"expire":     expire,
+			"refresh":    s.Refresh,
+			"restrict":   s.Restrict,
+		})
+		if s.Expire > 0 {
+			pipe.Expire(key, s.Expire)
+		}
+		pipe.SAdd(r.indexKey(s.UserId), s.Token)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisSessionStore) Get(token string) (*Session, error) {
+	val, err := r.client.HGetAll(r.prefix + token).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(val) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	s := &Session{
+		Id:        val["id"],
+		Token:     token,
+		UserId:    val["userId"],
+		User:      val["user"],
+		LoginType: val["loginType"],
+		IP:        val["ip"],
+		UserAgent: val["userAgent"],
+		Refresh:   val["refresh"],
+		Restrict:  val["restrict"],
+	}
+	s.CreateTime, _ = strconv.ParseInt(val["createTime"], 10, 64)
+	expire, _ := strconv.ParseFloat(val["expire"], 64)
+	if expire < 0 {
+		s.Expire = -1
+	} else {
+		s.Expire = time.Duration(expire * float64(time.Second))
+	}
+	return s, nil
+}
+
+func (r *RedisSessionStore) SetUser(token, user string) error {
+	return r.set(token, "user", user)
+}
+
+func (r *RedisSessionStore) SetRestrict(token, restrict string) error {
+	return r.set(token, "restrict", restrict)
+}
+
+// 更新会话的某个字段，会话不存在时返回 ErrSessionNotFound
+func (r *RedisSessionStore) set(token, field, value string) error {
+	n, err := setScript.Run(r.client, []string{r.prefix + token}, field, value).Int()
+	if err != nil {
+		return err
+	}
+	if n == -1 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *RedisSessionStore) Touch(token string, expire time.Duration) error {
+	var ok bool
+	var err error
+	if expire < 0 {
+		// Persist 删除key的过期时间，使其永不过期（本来就永不过期时返回false，需要再判断是否存在）
+		if ok, err = r.client.Persist(r.prefix + token).Result(); err == nil && !ok {
+			var n int64
+			n, err = r.client.Exists(r.prefix + token).Result()
+			ok = n > 0
+		}
+	} else {
+		ok, err = r.client.Expire(r.prefix+token, expire).Result()
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *RedisSessionStore) Revoke(tokens ...string) error {
+	for _, token := range tokens {
+		userId, err := r.client.HGet(r.prefix+token, "userId").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		_, err = r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Del(r.prefix + token)
+			pipe.SRem(r.indexKey(userId), token)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisSessionStore) ListByUser(userId string) ([]*Session, error) {
+	tokens, err := r.client.SMembers(r.indexKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var list []*Session
+	for _, token := range tokens {
+		s, err := r.Get(token)
+		if err == ErrSessionNotFound {
+			r.client.SRem(r.indexKey(userId), token) // 会话已过期，从索引中清理
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+func (r *RedisSessionStore) TTL(token string) (time.Duration, error) {
+	// 如果 key 不存在，TTL 返回 -2；如果 key 没有设置过期时间，返回 -1
+	ttl, err := r.client.TTL(r.prefix + token).Result()
+	if err != nil {
+		return 0, err
+	}
+	switch ttl {
+	case -2 * time.Second:
+		return 0, ErrSessionNotFound
+	case -1 * time.Second:
+		return NoExpire, nil
+	}
+	return ttl, nil
+}
+
+func (r *RedisSessionStore) Rotate(token, used, next string) error {
+	n, err := rotateScript.Run(r.client, []string{r.prefix + token}, used, next, MaxUsedRefresh).Int()
+	if err != nil {
+		return err
+	}
+	switch n {
+	case 1:
+		return nil
+	case 2:
+		return ErrRefreshReused
+	case -1:
+		return ErrSessionNotFound
+	}
+	return ErrRefreshInvalid
+}
+
+// 用户会话索引的key
+func (r *RedisSessionStore) indexKey(userId string) string {
+	return r.prefix + "index:" + userId
+}
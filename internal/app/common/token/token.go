@@ -0,0 +1,94 @@
+// ------------------------------------------------------------------------
+// ------------------------       jwt 访问令牌       ------------------------
+// ------------------------------------------------------------------------
+
+package token
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 访问令牌中携带的用户信息，鉴权时直接从令牌中取，不需要再查redis
+type Claims struct {
+	Sid      string `json:"sid"`                // 会话id，每次请求检查是否在注销列表中，刷新令牌、退出登录时使用
+	Restrict string `json:"rst,omitempty"`      // 会话限制，不为空时只能访问限制范围内的接口
+	UserName string `json:"userName"`           // 用户名称
+	RealName string `json:"realName,omitempty"` // 真实姓名
+	DeptId   string `json:"deptId,omitempty"`   // 部门id
+	DeptName string `json:"deptName,omitempty"` // 部门名称
+	RoleId   string `json:"roleId,omitempty"`   // 角色id
+	RoleKey  string `json:"roleKey,omitempty"`  // 角色代码
+	RoleName string `json:"roleName,omitempty"` // 角色名称
+	Picture  string `json:"picture,omitempty"`  // 头像地址
+	Locale   string `json:"loc,omitempty"`      // 语言偏好
+	jwt.RegisteredClaims
+}
+
+// 令牌签发和校验
+type Signer struct {
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	issuer    string
+	Expire    time.Duration // 访问令牌有效期
+}
+
+// HS256 签名，secret 至少32字节
+func NewHS256(secret, issuer string, expire time.Duration) (*Signer, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("token.secret 长度不能少于32位")
+	}
+	return &Signer{jwt.SigningMethodHS256, []byte(secret), []byte(secret), issuer, expire}, nil
+}
+
+// RS256 签名，读取PEM格式的私钥和公钥文件
+func NewRS256(privateKeyPath, publicKeyPath, issuer string, expire time.Duration) (*Signer, error) {
+	privatePem, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取私钥失败: %s", err)
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePem)
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥失败: %s", err)
+	}
+	var publicKey *rsa.PublicKey
+	if publicKeyPath == "" {
+		publicKey = &privateKey.PublicKey
+	} else {
+		publicPem, err := os.ReadFile(publicKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取公钥失败: %s", err)
+		}
+		if publicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicPem); err != nil {
+			return nil, fmt.Errorf("解析公钥失败: %s", err)
+		}
+	}
+	return &Signer{jwt.SigningMethodRS256, privateKey, publicKey, issuer, expire}, nil
+}
+
+// 签发访问令牌
+func (s *Signer) Sign(claims Claims) (string, error) {
+	now := time.Now()
+	claims.Issuer = s.issuer
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(s.Expire))
+	return jwt.NewWithClaims(s.method, claims).SignedString(s.signKey)
+}
+
+// 校验并解析访问令牌（签名、算法、签发者、有效期）
+func (s *Signer) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (any, error) {
+		return s.verifyKey, nil
+	}, jwt.WithValidMethods([]string{s.method.Alg()}), jwt.WithIssuer(s.issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -1,22 +1,55 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/logger"
 	"github.com/mojocn/base64Captcha"
 	"github.com/mozillazg/go-pinyin"
-	"github.com/pkg/errors"
 	"image/color"
 	"io"
-	mrand "math/rand"
 	"mime/multipart"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 )
 
-// 验证码，第一个参数是验证码的上限个数（最多存多少个验证码），第二个参数是验证码的有效时间
-var captchaStore = base64Captcha.NewMemoryStore(500, 1*time.Minute)
+var log = logger.Named("utils")
+
+// 验证码存储在 config.Cache 中（redis或内存），多实例部署时也能校验
+var captchaStore base64Captcha.Store = cacheCaptchaStore{}
+
+type cacheCaptchaStore struct{}
+
+func (cacheCaptchaStore) Set(id string, value string) error {
+	return config.Cache.Set(config.CaptchaKey+id, value, config.CaptchaExpire)
+}
+
+// 获取验证码答案，clear 为 true 时获取后删除
+func (cacheCaptchaStore) Get(id string, clear bool) string {
+	var value string
+	if clear {
+		value, _ = config.Cache.Take(config.CaptchaKey + id)
+	} else {
+		value, _ = config.Cache.Get(config.CaptchaKey + id)
+	}
+	return value
+}
+
+// 校验验证码，不管是否正确，校验一次后都会删除
+func (s cacheCaptchaStore) Verify(id, answer string, clear bool) bool {
+	value := s.Get(id, true)
+	return value != "" && strings.EqualFold(value, strings.TrimSpace(answer))
+}
+
+// 校验验证码（忽略大小写），每个验证码只能校验一次
+func CaptVerify(id, answer string) bool {
+	if id == "" || answer == "" {
+		return false
+	}
+	return captchaStore.Verify(id, answer, true)
+}
 
 // 生成验证码
 func GenerateCaptcha(length, width, height int) (lid string, lb64s string) {
@@ -47,14 +80,13 @@ func GenerateCaptcha(length, width, height int) (lid string, lb64s string) {
 	return
 }
 
-// 生成随机字符串作为令牌
+// 生成随机字符串作为令牌：length 个字节的安全随机数（crypto/rand），base64url编码（不含 . 号，可以作为分隔符）
 func GenerateRandomToken(length int) string {
 	tokenBytes := make([]byte, length)
-	mrand.NewSource(time.Now().UnixNano())
-	for i := range tokenBytes {
-		tokenBytes[i] = config.RandomCharset[mrand.Intn(len(config.RandomCharset))]
+	if _, err := rand.Read(tokenBytes); err != nil {
+		panic(err) // 系统随机数不可用时不能继续生成令牌
 	}
-	return string(tokenBytes)
+	return base64.RawURLEncoding.EncodeToString(tokenBytes)
 }
 
 // 判断数组中是否包含指定元素
@@ -99,19 +131,19 @@ func SaveFile(form *multipart.Form, relative, fileName string) error {
 	// 获取文件数据
 	file, err := form.File["file"][0].Open()
 	if err != nil {
-		err = errors.New("上传文件失败：" + err.Error())
+		err = config.ErrUnknown.WithMessage("error.upload", "上传文件失败").Wrap(err)
 		return err
 	}
 	defer file.Close()
 	content, err := io.ReadAll(file)
 	if err != nil {
-		err = errors.New("上传文件失败：" + err.Error())
+		err = config.ErrUnknown.WithMessage("error.upload", "上传文件失败").Wrap(err)
 		return err
 	}
 	// 获取当前项目路径
 	currentDir, err := os.Getwd()
 	if err != nil {
-		err = errors.New("获取项目路径失败：" + err.Error())
+		err = config.ErrUnknown.WithMessage("error.upload", "上传文件失败").Wrap(err)
 		return err
 	}
 	// 文件上传的绝对路径
@@ -119,20 +151,20 @@ func SaveFile(form *multipart.Form, relative, fileName string) error {
 	// 创建目录
 	err = os.MkdirAll(absolute, os.ModePerm)
 	if err != nil {
-		err = errors.New("上传文件失败：" + err.Error())
+		err = config.ErrUnknown.WithMessage("error.upload", "上传文件失败").Wrap(err)
 		return err
 	}
 	// 在当前项目路径中的 /upload/20231208/ 下创建新文件
 	newFile, err := os.Create(filepath.Join(absolute, fileName))
 	if err != nil {
-		err = errors.New("上传文件失败：" + err.Error())
+		err = config.ErrUnknown.WithMessage("error.upload", "上传文件失败").Wrap(err)
 		return err
 	}
 	defer newFile.Close()
 	// 将文件内容写入新文件
 	_, err = newFile.Write(content)
 	if err != nil {
-		err = errors.New("上传文件失败：" + err.Error())
+		err = config.ErrUnknown.WithMessage("error.upload", "上传文件失败").Wrap(err)
 		return err
 	}
 	return nil
@@ -6,18 +6,16 @@ package utils
 
 import (
 	"bytes"
-	"crypto"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
 	crand "crypto/rand"
-	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/pem"
-	"fiber-web-api/internal/app/common/mylog"
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/rsakey"
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -32,67 +30,49 @@ func MD5(v string) string {
 	return hex.EncodeToString(m.Sum(nil))
 }
 
-// ====================================  RSA加解密开始  ====================================
+// sha256摘要
+func SHA256(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])
+}
 
-var (
-	PrivateKey *rsa.PrivateKey
-	PublicKey  rsa.PublicKey
-)
+// ====================================  RSA加解密开始  ====================================
 
-// 生成随机密钥对
-func GenerateKeyPair() (*rsa.PrivateKey, *rsa.PublicKey) {
-	var err any
-	PrivateKey, err = rsa.GenerateKey(crand.Reader, 2048) //生成私钥
-	if err != nil {
-		panic(err)
-	}
-	PublicKey = PrivateKey.PublicKey //生成公钥
-	return PrivateKey, &PublicKey
+// 获取当前的RSA公钥和密钥id
+func GetPublicKey() (rsakey.PublicKey, error) {
+	return config.RSAKeys.Public()
 }
 
-// 获取公钥
-func GetPublicKey() string {
-	publicKeyBytes := x509.MarshalPKCS1PublicKey(&PublicKey)
-	pemBlock := &pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: publicKeyBytes,
+// RSA加密（当前公钥，RSA-OAEP SHA-256），返回base64编码的密文
+func RSAEncrypt(str string) (string, error) {
+	if str == "" {
+		return str, nil
 	}
-	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(pemBlock))
+	return config.RSAKeys.Encrypt(str)
 }
 
-// RSA加密
-func RSAEncrypt(str string) string {
-	if str == "" {
-		return str
-	}
-	//根据公钥加密
-	encryptedBytes, err := rsa.EncryptOAEP(sha256.New(), crand.Reader, &PublicKey, []byte(str), nil)
+// RSA解密，keyId 为加密时使用的公钥id（为空时尝试当前密钥和宽限期内的旧密钥）
+func RSADecrypt(ctx context.Context, keyId, str string) (string, error) {
+	decrypted, err := config.RSAKeys.Decrypt(keyId, str)
 	if err != nil {
-		panic(err)
-		return ""
+		log.WarnContext(ctx, "RSA解密失败", "keyId", keyId, "err", err)
 	}
-	// 加密后进行base64编码
-	encryptBase64 := base64.StdEncoding.EncodeToString(encryptedBytes)
-	return encryptBase64
+	return decrypted, err
 }
 
-// RSA解密
-func RSADecrypt(str string) string {
-	// base64解码
-	decodedBase64, err := base64.StdEncoding.DecodeString(str)
-	if err != nil {
-		panic(err)
-		mylog.Error(err.Error())
-		return ""
-	}
-	//根据私钥解密
-	decryptBytes, err := PrivateKey.Decrypt(nil, decodedBase64, &rsa.OAEPOptions{Hash: crypto.SHA256})
-	if err != nil {
-		panic(err)
-		mylog.Error(err.Error())
-		return ""
+// 批量RSA解密，解密后的值写回原来的字段，空字段跳过
+func RSADecryptFields(ctx context.Context, keyId string, fields ...*string) error {
+	for _, field := range fields {
+		if field == nil || *field == "" {
+			continue
+		}
+		decrypted, err := RSADecrypt(ctx, keyId, *field)
+		if err != nil {
+			return err
+		}
+		*field = decrypted
 	}
-	return string(decryptBytes)
+	return nil
 }
 
 // ====================================  盐值加密开始  ====================================
@@ -102,8 +82,7 @@ func GetEncryptedPassword(password string) (string, error) {
 	// 加密密码，使用 bcrypt 包当中的 GenerateFromPassword 方法，bcrypt.DefaultCost 代表使用默认加密成本
 	encryptPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		panic(err)
-		mylog.Error(err.Error())
+		log.Error("密码加密失败", "err", err)
 		return "", err
 	}
 	return string(encryptPassword), nil
@@ -119,7 +98,7 @@ func AuthenticatePassword(plaintextPassword string, encryptedPassword string) bo
 
 // ====================================  AES加解密开始  ====================================
 
-// AES加密（要加密的内容、密钥、偏移量）
+// AES加密（要加密的内容、密钥、偏移量），CBC模式零填充，没有完整性校验，新功能请使用 AESGCMEncrypt
 func AESEncrypt(content, key, iv string) (string, error) {
 	block, err := aes.NewCipher([]byte(key))
 	if err != nil {
@@ -157,3 +136,53 @@ func AESDecrypt(content, key, iv string) (string, error) {
 	mode.CryptBlocks(decrypted, encrypted)
 	return string(bytes.TrimRight(decrypted, "\x00")), nil
 }
+
+// ====================================  AES-GCM加解密开始  ====================================
+
+// AES-GCM加密（要加密的内容、密钥、附加数据），返回 base64(随机nonce+密文)
+// 附加数据不加密但参与认证，解密时必须一致，用于把密文和请求绑定在一起
+func AESGCMEncrypt(content string, key []byte, aad string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = crand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %s", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(content), []byte(aad))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// AES-GCM解密（要解密的内容、密钥、附加数据），同时返回加密时使用的nonce，用于防重放
+func AESGCMDecrypt(content string, key []byte, aad string) (string, []byte, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return "", nil, fmt.Errorf("base64解码失败: %s", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(encrypted) < gcm.NonceSize()+gcm.Overhead() {
+		return "", nil, fmt.Errorf("密文长度不足")
+	}
+	nonce, ciphertext := encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():]
+	decrypted, err := gcm.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return "", nil, fmt.Errorf("密文校验失败: %s", err)
+	}
+	return string(decrypted), nonce, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES加密块失败: %s", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建GCM失败: %s", err)
+	}
+	return gcm, nil
+}
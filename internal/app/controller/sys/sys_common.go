@@ -0,0 +1,43 @@
+package sys
+
+import (
+	"errors"
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/logger"
+	"fiber-web-api/internal/app/common/rsakey"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var log = logger.Named("controller")
+
+// 批量操作时接收的id集合
+type idsParam struct {
+	Ids []string `json:"ids" form:"ids" query:"ids"`
+}
+
+// 获取请求中的id集合，支持 json、form 表单和 ?ids=1,2,3 三种传参方式
+func getIds(c *fiber.Ctx) []string {
+	param := idsParam{}
+	c.BodyParser(&param)
+	if len(param.Ids) == 0 {
+		if ids := c.Query("ids"); ids != "" {
+			param.Ids = strings.Split(ids, ",")
+		}
+	}
+	return param.Ids
+}
+
+// 前端是否标记了数据已加密
+func isEncrypted(v string) bool {
+	return v == "1" || v == "true"
+}
+
+// 解密失败时的返回，公钥已经轮换过期的需要前端重新获取公钥
+func decryptError(err error) error {
+	if errors.Is(err, rsakey.ErrKeyNotFound) {
+		return config.ErrKeyExpired.Wrap(err)
+	}
+	return config.ErrDecrypt.Wrap(err)
+}
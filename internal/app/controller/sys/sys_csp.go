@@ -0,0 +1,21 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CspController struct{}
+
+// 违规报告最多记录的长度
+const cspReportMax = 4 << 10
+
+// 接收浏览器上报的CSP违规报告（report-uri），只记录日志
+func (CspController) Report(c *fiber.Ctx) error {
+	report := c.Body()
+	if len(report) > cspReportMax {
+		report = report[:cspReportMax]
+	}
+	log.WarnContext(c.UserContext(), "csp violation", "ip", config.ClientIP(c), "userAgent", c.Get(fiber.HeaderUserAgent), "report", string(report))
+	return c.SendStatus(fiber.StatusNoContent)
+}
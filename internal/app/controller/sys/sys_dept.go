@@ -0,0 +1,69 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+)
+
+type DeptController struct{}
+
+// 部门树列表
+func (DeptController) GetList(c *fiber.Ctx) error {
+	dept := sys.SysDept{}
+	dept.Token = c.Get(config.TokenHeader)
+	dept.Ctx = c.UserContext()
+	return c.Status(200).JSON(config.Success(dept.GetListTree()))
+}
+
+// 根据id获取部门
+func (DeptController) GetById(c *fiber.Ctx) error {
+	dept := sys.SysDept{}
+	dept.Id = c.Params("id")
+	dept.Token = c.Get(config.TokenHeader)
+	dept.Ctx = c.UserContext()
+	if err := dept.GetById(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(dept))
+}
+
+// 新增部门
+func (DeptController) Insert(c *fiber.Ctx) error {
+	dept := sys.SysDept{}
+	if err := c.BodyParser(&dept); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	dept.Token = c.Get(config.TokenHeader)
+	dept.Ctx = c.UserContext()
+	if err := dept.Insert(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 修改部门
+func (DeptController) Update(c *fiber.Ctx) error {
+	dept := sys.SysDept{}
+	if err := c.BodyParser(&dept); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	dept.Token = c.Get(config.TokenHeader)
+	dept.Ctx = c.UserContext()
+	if err := dept.Update(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 删除部门
+func (DeptController) Delete(c *fiber.Ctx) error {
+	dept := sys.SysDept{}
+	dept.Id = c.Params("id")
+	dept.Token = c.Get(config.TokenHeader)
+	dept.Ctx = c.UserContext()
+	if err := dept.Delete(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
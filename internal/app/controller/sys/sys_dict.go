@@ -0,0 +1,129 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+)
+
+type DictController struct{}
+
+// 获取字典类型列表
+func (DictController) GetTypeList(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	dict.DictName = c.Query("dictName")
+	return c.Status(200).JSON(config.Success(dict.GetTypeList()))
+}
+
+// 字典项列表分页
+func (DictController) GetPage(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	dict.DictName = c.Query("dictName")
+	dict.DictCode = c.Query("dictCode")
+	dict.ParentId = c.Query("parentId")
+	pageSize := c.QueryInt("pageSize", 10)
+	pageNum := c.QueryInt("pageNum", 1)
+	return c.Status(200).JSON(config.Success(dict.GetPage(pageSize, pageNum)))
+}
+
+// 根据id获取字典
+func (DictController) GetById(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	dict.Id = c.Params("id")
+	dict.GetById()
+	return c.Status(200).JSON(config.Success(dict))
+}
+
+// 生成字典代码（已存在时在末尾追加序号）
+func (DictController) CreateCode(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	dict.DictCode = c.Query("dictCode")
+	if dict.DictCode == "" {
+		return c.Status(200).JSON(config.Success(""))
+	}
+	return c.Status(200).JSON(config.Success(dict.CreateNameOrCode()))
+}
+
+// 字典名称是否存在
+func (DictController) HasByName(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	dict.Id = c.Query("id")
+	dict.DictName = c.Query("dictName")
+	if dict.DictName == "" {
+		return c.Status(200).JSON(config.Success(false))
+	}
+	return c.Status(200).JSON(config.Success(dict.HasDictByNameAndCode()))
+}
+
+// 字典代码是否存在
+func (DictController) HasByCode(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	dict.Id = c.Query("id")
+	dict.DictCode = c.Query("dictCode")
+	if dict.DictCode == "" {
+		return c.Status(200).JSON(config.Success(false))
+	}
+	return c.Status(200).JSON(config.Success(dict.HasDictByNameAndCode()))
+}
+
+// 新增字典
+func (DictController) Insert(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	if err := c.BodyParser(&dict); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	dict.Token = c.Get(config.TokenHeader)
+	dict.Ctx = c.UserContext()
+	if err := dict.Insert(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 修改字典
+func (DictController) Update(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	if err := c.BodyParser(&dict); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	dict.Token = c.Get(config.TokenHeader)
+	dict.Ctx = c.UserContext()
+	if err := dict.Update(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 删除字典类型
+func (DictController) DeleteType(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	dict.Id = c.Params("id")
+	dict.Token = c.Get(config.TokenHeader)
+	dict.Ctx = c.UserContext()
+	if err := dict.DeleteType(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 删除字典
+func (DictController) Delete(c *fiber.Ctx) error {
+	ids := getIds(c)
+	if len(ids) == 0 {
+		return config.ErrParam.WithMessage("error.noDeleteSelection", "请选择要删除的数据")
+	}
+	dict := sys.SysDict{}
+	dict.Token = c.Get(config.TokenHeader)
+	dict.Ctx = c.UserContext()
+	if err := dict.Delete(ids); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 根据字典类型代码获取字典项列表
+func (DictController) GetByTypeCode(c *fiber.Ctx) error {
+	dict := sys.SysDict{}
+	dict.DictCode = c.Query("typeCode")
+	return c.Status(200).JSON(config.Success(dict.GetSelectList()))
+}
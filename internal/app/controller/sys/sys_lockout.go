@@ -0,0 +1,30 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+)
+
+type LockoutController struct{}
+
+// 登录失败记录和锁定状态列表
+func (LockoutController) GetList(c *fiber.Ctx) error {
+	list, err := sys.GetLockouts()
+	if err != nil {
+		return config.ErrUnknown.Wrap(err)
+	}
+	return c.Status(200).JSON(config.Success(list))
+}
+
+// 解除锁定
+func (LockoutController) Clear(c *fiber.Ctx) error {
+	ids := getIds(c)
+	if len(ids) == 0 {
+		return config.ErrParam.WithMessage("error.noUnlockSelection", "请选择要解除锁定的数据")
+	}
+	if err := sys.ClearLockouts(ids); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
@@ -0,0 +1,187 @@
+package sys
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type LogController struct{}
+
+// 日志导出最多的行数（xlsx单个工作表最多1048576行）
+const logExportLimit = 1000000
+
+// 导出的列
+var logExportHeader = []string{"操作时间", "操作人", "真实姓名", "IP", "所属组", "操作", "类型", "请求方法", "请求地址", "状态", "返回码", "耗时（毫秒）", "详细信息", "请求参数"}
+
+// 日志列表
+func (LogController) GetPage(c *fiber.Ctx) error {
+	query, err := logQuery(c)
+	if err != nil {
+		return err
+	}
+	pageSize := c.QueryInt("pageSize", 10)
+	pageNum := c.QueryInt("pageNum", 1)
+	return c.Status(200).JSON(config.Success(query.GetPage(pageSize, pageNum)))
+}
+
+// 导出日志（format=csv 或 xlsx），按查询条件边查询边输出，不会把所有数据加载到内存中
+func (LogController) Export(c *fiber.Ctx) error {
+	query, err := logQuery(c)
+	if err != nil {
+		return err
+	}
+	format := c.Query("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		return config.ErrParam.WithMessage("error.exportFormat", "导出格式只支持csv、xlsx")
+	}
+	fileName := "sys_log_" + time.Now().Format("20060102150405") + "." + format
+	c.Attachment(fileName)
+	ctx := c.UserContext() // 写入响应时请求已经处理完，提前取出上下文
+	c.Response().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var err error
+		if format == "csv" {
+			err = writeLogCsv(w, query)
+		} else {
+			err = writeLogXlsx(w, query)
+		}
+		if err != nil {
+			log.ErrorContext(ctx, "日志导出失败", "err", err)
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// 校验操作日志的哈希链，返回第一个断开的位置
+func (LogController) Verify(c *fiber.Ctx) error {
+	if !config.AuditChain {
+		return config.ErrFailed.WithMessage("error.chainDisabled", "没有开启操作日志哈希链")
+	}
+	result, err := sys.VerifyLogChain()
+	if err != nil {
+		return config.ErrUnknown.Wrap(err)
+	}
+	return c.Status(200).JSON(config.Success(result))
+}
+
+// 获取查询条件：startTime、endTime 为 yyyy-MM-dd 或 yyyy-MM-dd HH:mm:ss，只有日期的结束时间包含当天。
+// 兼容原来的 createTime（查询某一天）和 creatorId（操作人）参数
+func logQuery(c *fiber.Ctx) (*sys.SysLogQuery, error) {
+	query := sys.SysLogQuery{
+		Operator: c.Query("operator", c.Query("creatorId")),
+		IP:       c.Query("ip"),
+		Type:     c.Query("type"),
+		State:    c.Query("state"),
+		Url:      c.Query("url"),
+	}
+	start, end := c.Query("startTime"), c.Query("endTime")
+	if createTime := c.Query("createTime"); createTime != "" {
+		start, end = createTime, createTime
+	}
+	var err error
+	if start != "" {
+		if query.StartTime, _, err = parseQueryTime(start); err != nil {
+			return nil, err
+		}
+	}
+	if end != "" {
+		t, dateOnly, err := parseQueryTime(end)
+		if err != nil {
+			return nil, err
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		query.EndTime = t
+	}
+	return &query, nil
+}
+
+func parseQueryTime(v string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", v, time.Local); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return t, false, config.ErrParam.WithMessage("error.dateFormat", "日期格式错误")
+	}
+	return t, true, nil
+}
+
+func logExportRow(row sys.SysLogView) []string {
+	var operator string
+	if row.CreatorId != nil {
+		operator = *row.CreatorId
+	}
+	return []string{
+		row.CreateTime.Format("2006-01-02 15:04:05"), operator, row.RealName, row.IP, row.Group, row.Title, row.Type,
+		row.Method, row.Url, row.State, strconv.Itoa(row.Code), strconv.FormatInt(row.Latency, 10), row.Info, row.Params,
+	}
+}
+
+// 防止CSV公式注入：以 = + - @ 制表符 回车开头的值会被Excel当作公式执行（如访问地址、参数、登录失败的用户名），
+// 前面加上 ' 号作为文本显示
+func csvEscape(values []string) []string {
+	for i, v := range values {
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			values[i] = "'" + v
+		}
+	}
+	return values
+}
+
+func writeLogCsv(w *bufio.Writer, query *sys.SysLogQuery) error {
+	w.WriteString("\xEF\xBB\xBF") // UTF-8 BOM，Excel打开时中文不乱码
+	writer := csv.NewWriter(w)
+	writer.Write(logExportHeader)
+	err := query.Each(logExportLimit, func(row sys.SysLogView) error {
+		return writer.Write(csvEscape(logExportRow(row)))
+	})
+	writer.Flush()
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// xlsx使用流式写入，超出内存阈值的部分会写到临时文件。
+// 所有的值都写成字符串类型的单元格（inlineStr），不会被当作公式，不需要像CSV一样转义
+func writeLogXlsx(w *bufio.Writer, query *sys.SysLogQuery) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := f.GetSheetName(0)
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+	toRow := func(values []string) []any {
+		row := make([]any, len(values))
+		for i, v := range values {
+			row[i] = v
+		}
+		return row
+	}
+	if err = sw.SetRow("A1", toRow(logExportHeader)); err != nil {
+		return err
+	}
+	line := 2
+	err = query.Each(logExportLimit, func(row sys.SysLogView) error {
+		cell, _ := excelize.CoordinatesToCellName(1, line)
+		line++
+		return sw.SetRow(cell, toRow(logExportRow(row)))
+	})
+	if err != nil {
+		return err
+	}
+	if err = sw.Flush(); err != nil {
+		return err
+	}
+	return f.Write(w)
+}
@@ -2,26 +2,26 @@ package sys
 
 import (
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
+	"fiber-web-api/internal/app/common/lockout"
 	"fiber-web-api/internal/app/common/utils"
 	"fiber-web-api/internal/app/model/sys"
-	"fmt"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
-	"github.com/pkg/errors"
-	"time"
+	"math"
 )
 
 type LoginController struct{}
 
 // 获取公钥
 func (LoginController) GetKey(c *fiber.Ctx) error {
-	ip := c.IP()
-	currentTime := time.Now().Unix()
-	err, _ := lockedUser(currentTime, ip, "IP") //判断ip是否锁定
+	if err := checkLocked(lockout.KindIP, config.ClientIP(c), i18n.M("field.ip")); err != nil { //判断ip是否锁定
+		return err
+	}
+	key, err := utils.GetPublicKey()
 	if err != nil {
-		return c.Status(200).JSON(config.ErrorCode(1004, err.Error()))
+		return config.ErrUnknown.Wrap(err)
 	}
-	return c.Status(200).JSON(config.Success(utils.GetPublicKey()))
+	return c.Status(200).JSON(config.Success(key))
 }
 
 // 获取验证码
@@ -35,208 +35,230 @@ func (LoginController) GetCode(c *fiber.Ctx) error {
 
 // 登录
 func (LoginController) Login(c *fiber.Ctx) error {
-	ip := c.IP()
-	//currentTime := time.Now().Unix()
-	//err, _ := lockedUser(currentTime, ip, "IP") //判断ip是否锁定
-	//if err != nil {
-	//	return c.Status(200).JSON(config.ErrorCode(1004, err.Error()))
-	//}
-	//code := c.FormValue("code")
-	//codeId := c.FormValue("codeId")
+	ip := config.ClientIP(c)
 	userName := c.FormValue("userName")
 	password := c.FormValue("password")
-	// 解密
-	//userName = util.RSADecrypt(userName)
-	//password = util.RSADecrypt(password)
-	log.Debug(fmt.Sprintf("用户名：%s", userName))
-	log.Debug(fmt.Sprintf("password：%s", password))
-	// 校验验证码是否正确
-	//b := util.CaptVerify(codeId, code)
-	//if !b {
-	//	return c.Status(200).JSON(config.Error("验证码错误或已过期"))
-	//}
-	var syslog = sys.SysLog{IP: ip, Title: "用户登录", Type: "登录", Method: "login", Url: "/sys/login", State: "登录成功"}
-	syslog.CreatorId = &userName
-	// 校验用户名和密码
+	// 前端用公钥加密了用户名和密码的（encrypted=1），用对应的私钥解密
+	if isEncrypted(c.FormValue("encrypted")) {
+		if err := utils.RSADecryptFields(c.UserContext(), c.FormValue("keyId"), &userName, &password); err != nil {
+			return decryptError(err)
+		}
+	}
+	log.DebugContext(c.UserContext(), "用户登录", "userName", userName, "ip", ip)
+	c.Locals(sys.LogOperator, userName) // 操作日志的操作人
 	safe := sys.SysSafe{}
 	safe.GetById()
-	user, result := passwordErrorNum(ip, userName, password, safe)
-	if result.Code != 0 {
-		syslog.State = "登录失败"
-		syslog.Info = result.Message
-		syslog.Insert()
+	// 校验验证码是否正确，验证码只能校验一次，错误时需要重新获取
+	if captchaRequired(ip, userName, safe) {
+		code := c.FormValue("code")
+		if code == "" {
+			return config.ErrCaptcha.WithMessage("error.captchaRequired", "请输入验证码")
+		}
+		if !utils.CaptVerify(c.FormValue("codeId"), code) {
+			return config.ErrCaptcha
+		}
+	}
+	// 校验用户名和密码
+	user, err := passwordErrorNum(ip, userName, password, safe)
+	if err != nil {
+		return err
+	}
+	c.Locals(config.LocaleLocal, user.Locale) // 密码验证通过后按用户的语言偏好返回
+	// 开启了双因素认证的，密码验证通过后还需要校验动态验证码
+	if user.TotpEnable == 1 {
+		challenge, err := sys.NewMfaChallenge(user.Id)
+		if err != nil {
+			return config.ErrUnknown.Wrap(err)
+		}
+		c.Locals(sys.LogState, "等待动态验证码")
+		result := config.ErrMfaRequired.Result().Localize(config.Locale(c))
+		result.Data = map[string]string{"mfaToken": challenge}
 		return c.Status(200).JSON(result)
 	}
-	i := safe.IdleTimeSetting //如果系统闲置时间为0，设置token和session永不过期
+	return loginSuccess(c, user, safe)
+}
+
+// 登录第二步：校验动态验证码或恢复码
+func (LoginController) LoginMfa(c *fiber.Ctx) error {
+	ip := config.ClientIP(c)
+	challenge := c.FormValue("mfaToken")
+	user := sys.GetMfaChallenge(challenge)
+	if user == nil {
+		return config.ErrNotLogin.WithMessage("error.loginExpired", "登录已过期，请重新登录")
+	}
+	c.Locals(sys.LogOperator, user.UserName)
+	c.Locals(config.LocaleLocal, user.Locale)
+	safe := sys.SysSafe{}
+	safe.GetById()
+	if err := mfaErrorNum(ip, user, c.FormValue("code"), safe, config.ErrPassword); err != nil {
+		return err
+	}
+	sys.DelMfaChallenge(challenge)
+	return loginSuccess(c, user, safe)
+}
+
+// 验证通过，创建会话并返回令牌
+func loginSuccess(c *fiber.Ctx, user *sys.SysUser, safe sys.SysSafe) error {
+	// 默认保持登录为30分钟，如果系统闲置时间为0，设置token和session永不过期
+	opt := sys.LoginOption{IP: config.ClientIP(c), UserAgent: c.Get(fiber.HeaderUserAgent), Expire: config.TokenExpire}
+	if safe.IdleTimeSetting == 0 {
+		opt.Expire = -1
+	}
+	// 必须修改密码、密码已过期或者必须绑定身份验证器的，登录后只能访问对应的接口
+	if user.PwdMustChange == 1 {
+		opt.Restrict = sys.RestrictPwdChange
+	} else if user.PasswordExpired(safe.PwdCycle) {
+		opt.Restrict = sys.RestrictPwdExpired
+	} else if user.TotpEnable != 1 && user.MfaMandatory(safe) {
+		opt.Restrict = sys.RestrictMfaEnroll
+	}
 	// 登录
-	token := ""
-	if i == 0 {
-		token = user.Login("", -1) // 永不过期
+	var token any
+	if config.TokenMode == config.TokenModeJwt {
+		pair, err := user.IssueToken(opt)
+		if err != nil {
+			return config.ErrUnknown.Wrap(err)
+		}
+		token = pair
 	} else {
-		token = user.Login("", config.TokenExpire) // 默认保持登录为30分钟
+		token = user.Login(opt)
+	}
+	// 受限会话返回的不是成功的返回码，这里指定操作日志的状态
+	c.Locals(sys.LogState, "登录成功")
+	c.Locals(sys.LogInfo, user.UserName+"登录成功")
+	if opt.Restrict != "" {
+		result := sys.RestrictError(opt.Restrict).Result().Localize(config.Locale(c))
+		result.Data = token
+		return c.Status(200).JSON(result)
 	}
-	syslog.Info = userName + "登录成功"
-	syslog.Insert()
 	return c.Status(200).JSON(config.Success(token))
 }
 
+// 刷新令牌（jwt模式），刷新令牌只能使用一次，每次都会返回新的访问令牌和刷新令牌
+func (LoginController) Refresh(c *fiber.Ctx) error {
+	if config.TokenMode != config.TokenModeJwt {
+		return config.ErrFailed.WithMessage("error.refreshUnsupported", "当前令牌模式不支持刷新")
+	}
+	pair, err := sys.RefreshToken(c.UserContext(), c.FormValue("refreshToken"))
+	if err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(pair))
+}
+
 // 退出
 func (LoginController) Logout(c *fiber.Ctx) error {
-	err := sys.Logout(c) // 退出登录
-	if err != nil {
-		return c.Status(200).JSON(err)
+	if err := sys.Logout(c); err != nil { // 退出登录
+		return err
 	}
 	return c.Status(200).JSON(config.Success(nil))
 }
 
-// 判断账号或IP是否锁定
-func lockedUser(currentTime int64, userName, msg string) (error, bool) {
-	flag := false
-	// 如果没有错误次数，直接返回
-	if exists, _ := config.RedisConn.Exists(config.ERROR_COUNT + userName).Result(); exists == 0 {
-		return nil, flag
-	}
-	loginTime, _ := config.RedisConn.HGet(config.ERROR_COUNT+userName, "loginTime").Int64()
-	isLocaked, _ := config.RedisConn.HGet(config.ERROR_COUNT+userName, "isLocaked").Result()
-	if "true" == isLocaked && currentTime < loginTime {
-		diff := loginTime - currentTime // 计算时间差
-		minutes := int(diff / 60)       // 将差值转换为分钟
-		err := fmt.Sprintf("%s锁定中，还没到允许登录的时间，请%d分钟后再尝试", msg, minutes)
-		return errors.New(err), flag
-	} else {
-		flag = true
-		config.RedisConn.HSet(config.ERROR_COUNT+userName, "isLocaked", "false") //重置为false
+// 判断账号或IP是否锁定，锁定中时返回错误信息
+func checkLocked(kind, subject string, msg i18n.Msg) error {
+	state, _ := config.Lockouts.Get(kind, subject)
+	if state.Locked() {
+		return lockedError(state, msg)
 	}
-	return nil, flag
+	return nil
+}
+
+func lockedError(state lockout.State, msg i18n.Msg) error {
+	minutes := int(math.Ceil(state.Remaining().Minutes())) // 剩余时间转换为分钟，不足一分钟的按一分钟
+	return config.ErrLocked.With(msg, minutes)
+}
+
+// 一次需要计数的尝试（密码、动态验证码）：校验之前先为账号和IP各记录一次失败，占用尝试次数，
+// 校验通过后再归还。这样并发的请求在锁定之前最多也只能尝试允许的次数
+type attempt struct {
+	ip, userName         string
+	userPolicy, ipPolicy lockout.Policy
+	userState, ipState   lockout.State
+}
+
+// 开始一次尝试，账号或IP锁定中时返回错误信息
+func beginAttempt(ip, userName string, safe sys.SysSafe) (*attempt, error) {
+	a := &attempt{ip: ip, userName: userName}
+	a.userPolicy, a.ipPolicy = safe.LockoutPolicy()
+	var counted bool
+	var err error
+	if a.ipState, counted, err = config.Lockouts.Fail(lockout.KindIP, ip, a.ipPolicy); err != nil {
+		return nil, config.ErrUnknown.Wrap(err)
+	}
+	if !counted {
+		return nil, lockedError(a.ipState, i18n.M("field.ip"))
+	}
+	if a.userState, counted, err = config.Lockouts.Fail(lockout.KindUser, userName, a.userPolicy); err != nil || !counted {
+		config.Lockouts.Release(lockout.KindIP, ip, a.ipPolicy, a.ipState.LastFailure)
+		if err != nil {
+			return nil, config.ErrUnknown.Wrap(err)
+		}
+		return nil, lockedError(a.userState, i18n.M("field.account"))
+	}
+	return a, nil
+}
+
+// 校验通过：账号的错误次数清零，IP的只归还这次占用的（不清零，避免用自己的账号登录来重置IP的错误次数）
+func (a *attempt) succeed() {
+	config.Lockouts.Clear(lockout.KindUser, a.userName)
+	config.Lockouts.Release(lockout.KindIP, a.ip, a.ipPolicy, a.ipState.LastFailure)
+}
+
+// 校验失败：失败已经在开始时记录了，账号和IP任意一个达到次数时锁定，返回锁定或剩余次数的错误信息，
+// wrong 为剩余次数的错误信息模板（参数为 what 和剩余次数）
+func (a *attempt) failed(what i18n.Msg, wrong *config.AppError) error {
+	if a.userState.Locked() || a.ipState.Locked() {
+		minutes := int(math.Ceil(max(a.userState.Remaining(), a.ipState.Remaining()).Minutes()))
+		return config.ErrLockedNow.With(what, minutes)
+	}
+	remaining := min(a.userPolicy.MaxAttempts-a.userState.Failures, a.ipPolicy.MaxAttempts-a.ipState.Failures)
+	return wrong.With(what, remaining)
 }
 
 // 校验账号、密码、ip
-func passwordErrorNum(ip, userName, password string, safe sys.SysSafe) (*sys.SysUser, *config.Result) {
-	currentTime := time.Now().Unix() // 获取当前时间的时间戳（单位：秒）
-	//错误3次，锁定15分钟后才可登陆 允许时间加上定义的登陆时间（毫秒）
-	timeStamp := currentTime + 900
-	errorCount := 3
-	lockDuration := 15
-	//密码登录限制（0：连续错3次，锁定账号15分钟。1：连续错5次，锁定账号30分钟）
-	if safe.PwdLoginLimit == 1 {
-		timeStamp = currentTime + 1800
-		errorCount = 5
-		lockDuration = 30
+func passwordErrorNum(ip, userName, password string, safe sys.SysSafe) (*sys.SysUser, error) {
+	a, err := beginAttempt(ip, userName, safe)
+	if err != nil {
+		return nil, err
 	}
+	//查询用户，根据前端输入的密码（明文），和加密的密码进行比较，判断输入的密码是否正确
 	user := sys.SysUser{}
 	user.UserName = userName
+	err = user.GetUser()
+	if err != nil || user.Id == "" || !utils.AuthenticatePassword(password, user.Password) {
+		// 用户不存在时也按账号计数，返回的信息和密码错误一样，避免通过返回信息判断账号是否存在
+		return nil, a.failed(i18n.M("field.credentials"), config.ErrPassword)
+	}
+	a.succeed()
+	return &user, nil
+}
 
-	//查询用户
-	err := user.GetUser()
-	if err != nil || user.Id == "" {
-		return nil, checkIPLocked(ip, currentTime, timeStamp, errorCount, lockDuration)
+// 校验动态验证码或恢复码，错误次数和密码错误次数一起计算，wrong 为错误时返回的信息模板
+func mfaErrorNum(ip string, user *sys.SysUser, code string, safe sys.SysSafe, wrong *config.AppError) error {
+	// 没有配置密钥时无法校验，不计入错误次数
+	if err := sys.CheckMfaKey(); err != nil {
+		return err
 	}
-	//判断账号是否锁定
-	err, flag := lockedUser(currentTime, userName, "账号")
+	a, err := beginAttempt(ip, user.UserName, safe)
 	if err != nil {
-		return nil, config.ErrorCode(1004, err.Error())
-	}
-	//根据前端输入的密码（明文），和加密的密码、盐值进行比较，判断输入的密码是否正确
-	authenticate := utils.AuthenticatePassword(password, user.Password)
-	if authenticate {
-		//密码正确错误次数清零
-		config.RedisConn.Del(config.ERROR_COUNT + userName)
-		config.RedisConn.Del(config.ERROR_COUNT + ip)
-	} else {
-		return nil, checkNameLocked(ip, userName, timeStamp, errorCount, lockDuration, flag)
+		return err
+	}
+	if !user.VerifyMfa(code) {
+		return a.failed(i18n.M("field.mfaCode"), wrong)
 	}
-	return &user, config.Success(nil)
+	a.succeed()
+	return nil
 }
 
-// 校验ip是否锁定
-func checkIPLocked(ip string, currentTime, timeStamp int64, errorCount, lockDuration int) *config.Result {
-	redis := config.RedisConn
-	//判断ip是否锁定
-	err, flag := lockedUser(currentTime, ip, "IP")
-	if err != nil {
-		return config.ErrorCode(1004, err.Error())
-	}
-	exists, _ := redis.Exists(config.ERROR_COUNT + ip).Result()
-	if exists == 0 { // 键不存在，第一次登录
-		loginMap := map[string]any{
-			"errorNum":  1,
-			"loginTime": timeStamp,
-			"isLocaked": "false", // 是否锁定，默认为false
-		}
-		redis.HMSet(config.ERROR_COUNT+ip, loginMap)
-	} else {
-		i, _ := redis.HGet(config.ERROR_COUNT+ip, "errorNum").Int()
-		if flag && i == errorCount { // 当错误次数达到限定次数时，走到这一步说明已经过了锁定时间再次登录，这时重新将错误次数设置为1
-			redis.HSet(config.ERROR_COUNT+ip, "errorNum", 1)
-		} else {
-			redis.HIncrBy(config.ERROR_COUNT+ip, "errorNum", 1)
-		}
-		redis.HSet(config.ERROR_COUNT+ip, "loginTime", timeStamp)
-	}
-	i, _ := redis.HGet(config.ERROR_COUNT+ip, "errorNum").Int()
-	if i == errorCount {
-		// 将锁定状态改为true表示已锁定
-		redis.HSet(config.ERROR_COUNT+ip, "isLocaked", "true")
-		return config.ErrorCode(1004, fmt.Sprintf("用户名或密码错误%d次，现已被锁定，请%d分钟后再尝试", errorCount, lockDuration))
-	}
-	return config.ErrorCode(1000, fmt.Sprintf("用户名或密码错误，总登录次数%d次，剩余次数: %d", errorCount, (errorCount-i)))
-}
-
-// 校验用户名是否锁定
-func checkNameLocked(ip, userName string, timeStamp int64, errorCount, lockDuration int, flag bool) *config.Result {
-	redis := config.RedisConn
-	exists, _ := redis.Exists(config.ERROR_COUNT + userName).Result()
-	if exists == 0 { // 键不存在，第一次登录
-		loginMap := map[string]any{
-			"errorNum":  1,
-			"loginTime": timeStamp,
-			"isLocaked": "false", // 是否锁定，默认为false
-		}
-		redis.HMSet(config.ERROR_COUNT+userName, loginMap)
-		if exists, _ = redis.Exists(config.ERROR_COUNT + ip).Result(); exists == 0 {
-			redis.HMSet(config.ERROR_COUNT+ip, loginMap)
-		}
-	} else {
-		i1, i2 := 0, 0
-		if exists, _ = redis.Exists(config.ERROR_COUNT + userName).Result(); exists > 0 {
-			i1, _ = redis.HGet(config.ERROR_COUNT+userName, "errorNum").Int()
-		}
-		if exists, _ = redis.Exists(config.ERROR_COUNT + ip).Result(); exists > 0 {
-			i2, _ = redis.HGet(config.ERROR_COUNT+ip, "errorNum").Int()
-		} else {
-			redis.HSet(config.ERROR_COUNT+ip, "isLocaked", "false")
-		}
-		// 每一次错误，同时记录当前IP和用户名的错误次数
-		if flag && (i1 == errorCount || i2 == errorCount) { // 走到这一步说明已经过了锁定时间再次登录，这时重新将错误次数设置为1
-			if i1 > i2 { // i1 > i2 是用户名错误次数到达限定次数，将用户名的错误次数重置为1
-				redis.HSet(config.ERROR_COUNT+userName, "errorNum", 1)
-			} else if i2 > i1 { // i2 > i1 是IP错误次数到达限定次数，将IP的错误次数重置为1
-				redis.HSet(config.ERROR_COUNT+ip, "errorNum", 1)
-			} else { // 否则就是用户名和IP错误次数相等，将两个的错误次数同时重置为1
-				redis.HSet(config.ERROR_COUNT+userName, "errorNum", 1)
-				redis.HSet(config.ERROR_COUNT+ip, "errorNum", 1)
-			}
-		} else {
-			redis.HIncrBy(config.ERROR_COUNT+userName, "errorNum", 1)
-			redis.HIncrBy(config.ERROR_COUNT+ip, "errorNum", 1)
-		}
-		redis.HSet(config.ERROR_COUNT+userName, "loginTime", timeStamp)
-		redis.HSet(config.ERROR_COUNT+ip, "loginTime", timeStamp)
-	}
-	i1, _ := redis.HGet(config.ERROR_COUNT+userName, "errorNum").Int()
-	i2, _ := redis.HGet(config.ERROR_COUNT+ip, "errorNum").Int()
-	i := i1                                   // i默认为i1，需要取i1、i2两个中，较大的那一个
-	if i1 == errorCount || i2 == errorCount { // 任意一个满足，将值大的那个设置为锁定
-		if i1 > i2 { // i1 > i2 是用户名错误次数到达限定次数，将用户名的锁定状态设置为锁定
-			redis.HSet(config.ERROR_COUNT+userName, "isLocaked", "true")
-		} else if i2 > i1 { // i2 > i1 是IP错误次数到达限定次数，将IP的锁定状态设置为锁定
-			i = i2
-			redis.HSet(config.ERROR_COUNT+ip, "isLocaked", "true")
-		} else { // 否则就是用户名和IP错误次数相等，将两个的锁定状态同时设置为锁定
-			redis.HSet(config.ERROR_COUNT+userName, "isLocaked", "true")
-			redis.HSet(config.ERROR_COUNT+ip, "isLocaked", "true")
-		}
-		return config.ErrorCode(1004, fmt.Sprintf("用户名或密码错误%d次，现已被锁定，请%d分钟后再尝试", errorCount, lockDuration))
+// 是否需要验证码：按照安全设置的验证码策略，IP或账号失败次数达到指定次数、或者被锁定过的都需要
+func captchaRequired(ip, userName string, safe sys.SysSafe) bool {
+	switch safe.CaptchaPolicy {
+	case 1:
+		return true
+	case 2:
+		userState, _ := config.Lockouts.Get(lockout.KindUser, userName)
+		ipState, _ := config.Lockouts.Get(lockout.KindIP, ip)
+		return userState.Locks > 0 || ipState.Locks > 0 || max(userState.Failures, ipState.Failures) >= safe.CaptchaErrorNum
 	}
-	return config.ErrorCode(1000, fmt.Sprintf("用户名或密码错误，总登录次数%d次，剩余次数: %d", errorCount, (errorCount-i)))
+	return false
 }
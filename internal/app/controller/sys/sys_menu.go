@@ -0,0 +1,84 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+)
+
+type MenuController struct{}
+
+// 菜单列表
+func (MenuController) GetList(c *fiber.Ctx) error {
+	menu := sys.SysMenu{}
+	menu.Name = c.Query("name")
+	menu.State = c.QueryInt("state", 0)
+	return c.Status(200).JSON(config.Success(menu.GetList()))
+}
+
+// 路由列表（当前登录用户的角色所拥有的菜单）
+func (MenuController) GetRouters(c *fiber.Ctx) error {
+	user := sys.GetLoginUser(c.Get(config.TokenHeader))
+	menu := sys.SysMenu{}
+	menu.Id = user.RoleId
+	return c.Status(200).JSON(config.Success(menu.GetRouters()))
+}
+
+// 根据id获取菜单
+func (MenuController) GetById(c *fiber.Ctx) error {
+	menu := sys.SysMenu{}
+	menu.Id = c.Params("id")
+	menu.GetById()
+	return c.Status(200).JSON(config.Success(menu))
+}
+
+// 获取对应角色菜单列表树
+func (MenuController) RoleMenuTree(c *fiber.Ctx) error {
+	menu := sys.SysMenu{}
+	roleMenu := sys.SysRoleMenu{RoleId: c.Params("roleId")}
+	result := map[string]any{
+		"menus":       menu.GetList(),               // 全部菜单树
+		"checkedKeys": roleMenu.GetMenuIdByRoleId(), // 角色已选中的菜单id
+	}
+	return c.Status(200).JSON(config.Success(result))
+}
+
+// 新增菜单
+func (MenuController) Insert(c *fiber.Ctx) error {
+	menu := sys.SysMenu{}
+	if err := c.BodyParser(&menu); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	menu.Token = c.Get(config.TokenHeader)
+	menu.Ctx = c.UserContext()
+	if err := menu.Insert(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 修改菜单
+func (MenuController) Update(c *fiber.Ctx) error {
+	menu := sys.SysMenu{}
+	if err := c.BodyParser(&menu); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	menu.Token = c.Get(config.TokenHeader)
+	menu.Ctx = c.UserContext()
+	if err := menu.Update(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 删除菜单
+func (MenuController) Delete(c *fiber.Ctx) error {
+	menu := sys.SysMenu{}
+	menu.Id = c.Params("id")
+	menu.Token = c.Get(config.TokenHeader)
+	menu.Ctx = c.UserContext()
+	if err := menu.Delete(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
@@ -0,0 +1,82 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+)
+
+type MfaController struct{}
+
+// 当前用户的双因素认证状态
+func (MfaController) GetStatus(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	return c.Status(200).JSON(config.Success(sys.GetMfaStatus(token)))
+}
+
+// 绑定身份验证器：生成密钥和二维码
+func (MfaController) Setup(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	setup, err := sys.SetupMfa(token)
+	if err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(setup))
+}
+
+// 绑定身份验证器：校验动态验证码后开启，返回恢复码
+func (MfaController) Enable(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	codes, err := sys.EnableMfa(token, c.FormValue("code"))
+	if err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(codes))
+}
+
+// 关闭双因素认证，需要校验动态验证码或恢复码
+func (MfaController) Disable(c *fiber.Ctx) error {
+	user, err := sys.GetMfaUser(c.Get(config.TokenHeader))
+	if err != nil {
+		return err
+	}
+	safe := sys.SysSafe{}
+	safe.GetById()
+	if err = user.CheckDisableMfa(safe); err != nil {
+		return err
+	}
+	if err = mfaErrorNum(config.ClientIP(c), user, c.FormValue("code"), safe, config.ErrMfaAttempt); err != nil {
+		return err
+	}
+	if err = user.DisableMfa(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 重新生成恢复码，需要校验动态验证码或恢复码
+func (MfaController) RecoveryCodes(c *fiber.Ctx) error {
+	user, err := sys.GetMfaUser(c.Get(config.TokenHeader))
+	if err != nil {
+		return err
+	}
+	safe := sys.SysSafe{}
+	safe.GetById()
+	if err = mfaErrorNum(config.ClientIP(c), user, c.FormValue("code"), safe, config.ErrMfaAttempt); err != nil {
+		return err
+	}
+	codes, err := user.RegenerateRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(codes))
+}
+
+// 重置用户的双因素认证
+func (MfaController) Reset(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	if err := sys.ResetMfa(token, c.Params("userId")); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
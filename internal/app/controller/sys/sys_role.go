@@ -0,0 +1,103 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/utils"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mozillazg/go-pinyin"
+)
+
+type RoleController struct{}
+
+// 角色列表
+func (RoleController) GetPage(c *fiber.Ctx) error {
+	role := sys.SysRole{}
+	role.Token = c.Get(config.TokenHeader)
+	role.Ctx = c.UserContext()
+	role.RoleName = c.Query("roleName")
+	role.RoleKey = c.Query("roleKey")
+	pageSize := c.QueryInt("pageSize", 10)
+	pageNum := c.QueryInt("pageNum", 1)
+	return c.Status(200).JSON(config.Success(role.GetPage(pageSize, pageNum)))
+}
+
+// 根据id获取角色
+func (RoleController) GetById(c *fiber.Ctx) error {
+	role := sys.SysRole{}
+	role.Id = c.Params("id")
+	role.GetById()
+	// 角色关联的菜单id
+	roleMenu := sys.SysRoleMenu{RoleId: role.Id}
+	role.MenuIds = roleMenu.GetMenuIdByRoleId()
+	return c.Status(200).JSON(config.Success(role))
+}
+
+// 根据角色名称生成角色编码（名称的拼音首字母大写）
+func (RoleController) CreateCode(c *fiber.Ctx) error {
+	roleName := c.Query("roleName")
+	return c.Status(200).JSON(config.Success(utils.ConvertToPinyin(roleName, pinyin.NewArgs())))
+}
+
+// 新增角色
+func (RoleController) Insert(c *fiber.Ctx) error {
+	role := sys.SysRole{}
+	if err := c.BodyParser(&role); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	role.Token = c.Get(config.TokenHeader)
+	role.Ctx = c.UserContext()
+	if err := role.Insert(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 修改角色
+func (RoleController) Update(c *fiber.Ctx) error {
+	role := sys.SysRole{}
+	if err := c.BodyParser(&role); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	role.Token = c.Get(config.TokenHeader)
+	role.Ctx = c.UserContext()
+	if err := role.Update(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 修改角色状态
+func (RoleController) UpdateState(c *fiber.Ctx) error {
+	role := sys.SysRole{}
+	if err := c.BodyParser(&role); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	role.Token = c.Get(config.TokenHeader)
+	role.Ctx = c.UserContext()
+	if err := role.UpdateState(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 删除角色
+func (RoleController) Delete(c *fiber.Ctx) error {
+	ids := getIds(c)
+	if len(ids) == 0 {
+		return config.ErrParam.WithMessage("error.noDeleteSelection", "请选择要删除的数据")
+	}
+	role := sys.SysRole{}
+	role.Token = c.Get(config.TokenHeader)
+	role.Ctx = c.UserContext()
+	if err := role.Delete(ids); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 角色下拉框
+func (RoleController) GetSelectList(c *fiber.Ctx) error {
+	role := sys.SysRole{}
+	return c.Status(200).JSON(config.Success(role.GetSelectList()))
+}
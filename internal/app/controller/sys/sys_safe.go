@@ -0,0 +1,30 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+)
+
+type SafeController struct{}
+
+// 获取安全设置
+func (SafeController) GetSafeSet(c *fiber.Ctx) error {
+	safe := sys.SysSafe{}
+	safe.GetById() // 还没有设置过时，返回默认值
+	return c.Status(200).JSON(config.Success(safe))
+}
+
+// 修改安全设置
+func (SafeController) Update(c *fiber.Ctx) error {
+	safe := sys.SysSafe{}
+	if err := c.BodyParser(&safe); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	safe.Token = c.Get(config.TokenHeader)
+	safe.Ctx = c.UserContext()
+	if err := safe.Update(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
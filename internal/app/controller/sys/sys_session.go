@@ -0,0 +1,42 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionController struct{}
+
+// 当前用户的登录会话列表
+func (SessionController) GetList(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	return c.Status(200).JSON(config.Success(sys.GetSessions(token)))
+}
+
+// 注销当前用户的某个会话
+func (SessionController) Revoke(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	if err := sys.RevokeSession(token, c.Params("id")); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 注销当前用户的所有会话
+func (SessionController) RevokeAll(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	if err := sys.RevokeAllSessions(token); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 强制用户下线
+func (SessionController) ForceLogout(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	if err := sys.ForceLogout(token, c.Params("userId")); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
@@ -0,0 +1,161 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/utils"
+	"fiber-web-api/internal/app/model/sys"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type UserController struct{}
+
+// 获取当前登录的用户
+func (UserController) GetLoginUser(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	user := sys.GetLoginUser(token)
+	user.Password = "" // 密码不返回给前端
+	return c.Status(200).JSON(config.Success(user))
+}
+
+// 修改当前用户的语言偏好
+func (UserController) UpdateLocale(c *fiber.Ctx) error {
+	user := sys.SysUser{}
+	user.Token = c.Get(config.TokenHeader)
+	user.Ctx = c.UserContext()
+	user.Locale = c.FormValue("locale")
+	if err := user.UpdateLocale(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 用户列表
+func (UserController) GetPage(c *fiber.Ctx) error {
+	user := sys.SysUserView{}
+	user.Token = c.Get(config.TokenHeader)
+	user.Ctx = c.UserContext()
+	user.UserName = c.Query("userName")
+	user.RealName = c.Query("realName")
+	user.AncestorId = c.Query("deptId") // 查询选中部门及其子部门的用户
+	pageSize := c.QueryInt("pageSize", 10)
+	pageNum := c.QueryInt("pageNum", 1)
+	return c.Status(200).JSON(config.Success(user.GetPage(pageSize, pageNum)))
+}
+
+// 根据id获取用户
+func (UserController) GetById(c *fiber.Ctx) error {
+	user := sys.SysUser{}
+	user.Id = c.Params("id")
+	user.Token = c.Get(config.TokenHeader)
+	user.Ctx = c.UserContext()
+	if err := user.GetUser(); err != nil {
+		return err
+	}
+	user.Password = ""
+	return c.Status(200).JSON(config.Success(user))
+}
+
+// 新增用户
+func (UserController) Insert(c *fiber.Ctx) error {
+	user := sys.SysUser{}
+	if err := c.BodyParser(&user); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	user.Token = c.Get(config.TokenHeader)
+	user.Ctx = c.UserContext()
+	oneTime, err := user.Insert()
+	if err != nil {
+		return err
+	}
+	// 生成的一次性密码只在这里返回一次
+	return c.Status(200).JSON(config.Success(map[string]any{"password": oneTime}))
+}
+
+// 修改用户
+func (UserController) Update(c *fiber.Ctx) error {
+	user := sys.SysUser{}
+	if err := c.BodyParser(&user); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	user.Token = c.Get(config.TokenHeader)
+	user.Ctx = c.UserContext()
+	if err := user.Update(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 删除用户
+func (UserController) Delete(c *fiber.Ctx) error {
+	ids := getIds(c)
+	if len(ids) == 0 {
+		return config.ErrParam.WithMessage("error.noDeleteSelection", "请选择要删除的数据")
+	}
+	user := sys.SysUser{}
+	user.Token = c.Get(config.TokenHeader)
+	user.Ctx = c.UserContext()
+	if err := user.Delete(ids); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 设置密码
+func (UserController) UpdatePassword(c *fiber.Ctx) error {
+	password := sys.Password{}
+	if err := c.BodyParser(&password); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	password.Token = c.Get(config.TokenHeader)
+	password.Ctx = c.UserContext()
+	// 没有传用户id，或者是受限会话（如密码已过期，没有经过鉴权）时，只能修改当前登录用户的密码
+	if restrict, _ := c.Locals(config.RestrictLocal).(string); password.Id == "" || restrict != "" {
+		password.Id = *sys.GetLoginId(password.Token)
+	}
+	if err := password.UpdatePassword(); err != nil {
+		return err
+	}
+	return c.Status(200).JSON(config.Success(nil))
+}
+
+// 重置密码
+func (UserController) ResetPassword(c *fiber.Ctx) error {
+	user := sys.SysUser{}
+	if err := c.BodyParser(&user); err != nil {
+		return config.ErrParam.Wrap(err)
+	}
+	user.Token = c.Get(config.TokenHeader)
+	user.Ctx = c.UserContext()
+	oneTime, err := user.ResetPassword()
+	if err != nil {
+		return err
+	}
+	// 生成的一次性密码只在这里返回一次
+	return c.Status(200).JSON(config.Success(map[string]any{"password": oneTime}))
+}
+
+// 上传头像
+func (UserController) Upload(c *fiber.Ctx) error {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["file"]) == 0 {
+		return config.ErrParam.WithMessage("error.noFile", "请选择要上传的文件")
+	}
+	// 文件保存到 filePath/upload/20231208/ 目录下，文件名用uuid重新命名
+	relative := filepath.Join(config.FilePath, "upload", time.Now().Format("20060102"))
+	fileName := strings.ReplaceAll(uuid.NewString(), "-", "") + filepath.Ext(form.File["file"][0].Filename)
+	if err = utils.SaveFile(form, relative, fileName); err != nil {
+		return err
+	}
+	picture := path.Join("/", filepath.ToSlash(relative), fileName)
+	user := sys.SysUser{}
+	user.Token = c.Get(config.TokenHeader)
+	user.Ctx = c.UserContext()
+	user.Picture = &picture
+	user.Upload()
+	return c.Status(200).JSON(config.Success(picture))
+}
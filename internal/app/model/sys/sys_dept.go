@@ -2,8 +2,8 @@ package sys
 
 import (
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
 	"github.com/google/uuid"
-	"github.com/pkg/errors"
 	"strings"
 	"time"
 )
@@ -36,7 +36,7 @@ func (e *SysDept) ChildList() []SysDept {
         SELECT * FROM temp_dept
 	`
 	var childList []SysDept
-	config.DB.Raw(sql, e.ParentId).Find(&childList)
+	e.DB().Raw(sql, e.ParentId).Find(&childList)
 	return childList
 }
 
@@ -75,7 +75,7 @@ func (e *SysDept) GetAncestor() (string, string) {
 		ORDER BY level,parent_id
 	`
 	var ancestorList []SysDept
-	config.DB.Raw(sql, e.Id, e.Id).Find(&ancestorList)
+	e.DB().Raw(sql, e.Id, e.Id).Find(&ancestorList)
 	idList := []string{}
 	nameList := []string{}
 	for _, t := range ancestorList {
@@ -115,17 +115,17 @@ func (e *SysDept) GetListTree() []SysDept {
 	if scope != "" {
 		sql = sql + " WHERE " + scope
 	}
-	config.DB.Table(e.TableName()).Debug().Order("`level`,parent_id,sort asc").Raw(sql, args...).Find(&list)
+	e.DB().Table(e.TableName()).Debug().Order("`level`,parent_id,sort asc").Raw(sql, args...).Find(&list)
 	return e.BuildTree(list, "ROOT")
 }
 
 // 获取详情
 func (e *SysDept) GetById() (err error) {
 	if !CheckDataScope(e.Token, e.Id, false, true) {
-		err = errors.New("没有操作权限！")
+		err = config.ErrForbidden
 		return
 	}
-	config.DB.Table(e.TableName()).Where("id = ?", e.Id).Find(e)
+	e.DB().Table(e.TableName()).Where("id = ?", e.Id).Find(e)
 	return
 }
 
@@ -133,15 +133,15 @@ func (e *SysDept) GetById() (err error) {
 func (e *SysDept) Insert() (err error) {
 	// 新增部门时，只允许新增子部门（也就是只允许给当前用户所在部门新增子部门）
 	if !CheckDataScope(e.Token, e.ParentId, false, true) {
-		err = errors.New("没有操作权限！")
+		err = config.ErrForbidden
 		return
 	}
 	// 校验用户名和手机号码
 	var count int64
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	query.Where("name = ? and parent_id = ?", e.Name, e.ParentId).Count(&count)
 	if count > 0 {
-		err = errors.New("名称已存在！")
+		err = config.ErrExists.With(i18n.M("field.name"))
 		return
 	}
 	err = e.getLevel()
@@ -151,14 +151,13 @@ func (e *SysDept) Insert() (err error) {
 	e.Id = strings.ReplaceAll(uuid.NewString(), "-", "")
 	e.CreatorId = GetLoginId(e.Token)
 	e.CreateTime = time.Now()
-	config.DB.Table(e.TableName()).Create(e)
+	e.DB().Table(e.TableName()).Create(e)
 	// 新增成功，更新数据权限缓存
-	exists, _ := config.RedisConn.Exists(config.DATA_SCOPE + e.ParentId).Result()
-	if exists > 0 {
-		childId := config.RedisConn.HGet(config.DATA_SCOPE+e.ParentId, "childId").Val()
-		childName := config.RedisConn.HGet(config.DATA_SCOPE+e.ParentId, "childName").Val()
-		config.RedisConn.HSet(config.DATA_SCOPE+e.ParentId, "childId", childId+","+e.Id)
-		config.RedisConn.HSet(config.DATA_SCOPE+e.ParentId, "childName", childName+","+e.Name)
+	if dataScope, err := config.Cache.HGetAll(config.DATA_SCOPE + e.ParentId); err == nil {
+		config.Cache.HSet(config.DATA_SCOPE+e.ParentId, map[string]string{
+			"childId":   dataScope["childId"] + "," + e.Id,
+			"childName": dataScope["childName"] + "," + e.Name,
+		})
 	}
 	return
 }
@@ -167,22 +166,22 @@ func (e *SysDept) Insert() (err error) {
 func (e *SysDept) Update() (err error) {
 	// 修改部门时，只允许修改当前部门和子部门数据
 	if !CheckDataScope(e.Token, e.Id, false, true) {
-		err = errors.New("没有操作权限！")
+		err = config.ErrForbidden
 		return
 	}
 	// 校验用户名和手机号码
 	var count int64
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	query.Where("name = ? and parent_id = ? and id <> ?", e.Name, e.ParentId, e.Id).Count(&count)
 	if count > 0 {
-		err = errors.New("名称已存在！")
+		err = config.ErrExists.With(i18n.M("field.name"))
 		return
 	}
 	err = e.getLevel()
 	if err != nil {
 		return err
 	}
-	config.DB.Table(e.TableName()).Model(&SysDept{}).Where("id = ?", e.Id).Updates(e)
+	e.DB().Table(e.TableName()).Model(&SysDept{}).Where("id = ?", e.Id).Updates(e)
 	return
 }
 
@@ -190,23 +189,23 @@ func (e *SysDept) Update() (err error) {
 func (e *SysDept) Delete() (err error) {
 	// 修改部门时，只允许修改当前部门和子部门数据
 	if !CheckDataScope(e.Token, e.Id, false, true) {
-		err = errors.New("没有操作权限！")
+		err = config.ErrForbidden
 		return
 	}
 	// 1、校验是否存在下级
 	var count int64
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	query.Where("parent_id = ?", e.Id).Count(&count)
 	if count > 0 {
-		err = errors.New("存在下级,不允许删除")
+		err = config.ErrInUse.With(i18n.M("inUse.deptChildren"))
 		return
 	}
 	// 2、校验是否存在用户
 	if CheckDeptExistUser(e.Id) {
-		err = errors.New("该组织存在用户,不允许删除")
+		err = config.ErrInUse.With(i18n.M("inUse.deptUser"))
 		return
 	}
-	if err = config.DB.Table(e.TableName()).Delete(e).Error; err != nil {
+	if err = e.DB().Table(e.TableName()).Delete(e).Error; err != nil {
 		return
 	}
 	return
@@ -221,7 +220,7 @@ func (e *SysDept) getLevel() (err error) {
 		parent.Id = e.ParentId
 		parent.GetById()
 		if parent.Name == "" {
-			err = errors.New("上级不存在！")
+			err = config.ErrNotFound.With(i18n.M("field.parent"))
 			return
 		}
 		e.Level = parent.Level + 1
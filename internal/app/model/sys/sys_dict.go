@@ -2,9 +2,9 @@ package sys
 
 import (
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/pkg/errors"
 	"strconv"
 	"strings"
 	"time"
@@ -31,7 +31,7 @@ func (SysDict) TableName() string {
 // 字典类型列表
 func (e *SysDict) GetTypeList() []SysDict {
 	var list []SysDict
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	query.Where("is_type = 1")
 	if e.DictName != "" {
 		query.Where("dict_name like ?", fmt.Sprintf("%%%s%%", e.DictName))
@@ -44,7 +44,7 @@ func (e *SysDict) GetTypeList() []SysDict {
 func (e *SysDict) GetPage(pageSize int, pageNum int) config.PageInfo {
 	var list []SysDict // 查询结果
 	var total int64    // 总数
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	query.Where("is_type = 2")
 	if e.DictName != "" {
 		query.Where("dict_name like ?", fmt.Sprintf("%%%s%%", e.DictName))
@@ -58,18 +58,18 @@ func (e *SysDict) GetPage(pageSize int, pageNum int) config.PageInfo {
 	offset := (pageNum - 1) * pageSize                                                   // 计算跳过的记录数
 	query.Debug().Order("parent_id,sort asc").Offset(offset).Limit(pageSize).Find(&list) // 分页查询，根据offset和limit来查询
 	query.Count(&total)
-	return config.PageInfo{list, total}
+	return config.PageInfo{List: list, Total: total}
 }
 
 // 获取详情
 func (e *SysDict) GetById() {
-	config.DB.Table(e.TableName()).Where("id = ?", e.Id).Find(e)
+	e.DB().Table(e.TableName()).Where("id = ?", e.Id).Find(e)
 }
 
 // 详情
 func (e *SysDict) HasDictByNameAndCode() bool {
 	var count int64
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	if e.Id != "" {
 		query.Where("id <> ?", e.Id)
 	}
@@ -103,7 +103,7 @@ func (e *SysDict) CreateNameOrCode() string {
 // 字典名称或代码右模糊匹配
 func (e *SysDict) rightLikeNameOrCode(str string) string {
 	var list []SysDict
-	query := config.DB.Table(SysDict{}.TableName())
+	query := e.DB().Table(SysDict{}.TableName())
 	if e.DictName != "" {
 		query.Where("dict_name LIKE ?", fmt.Sprintf("%s%%", str)) // 右模糊查询
 	}
@@ -137,7 +137,7 @@ func (e *SysDict) rightLikeNameOrCode(str string) string {
 
 // 新增
 func (e *SysDict) Insert() (err error) {
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	// 如果字典名称已存在，不提示重复，直接生成新的字典名称
 	if checkDictNameAndCode(e.DictName, "", "") {
 		dict := SysDict{}
@@ -177,26 +177,26 @@ func (e *SysDict) Update() (err error) {
 		code := dict.CreateNameOrCode()
 		e.DictCode = code
 	}
-	config.DB.Model(&SysDict{}).Omit("id", "create_time").Where("id = ?", e.Id).Save(e)
+	e.DB().Model(&SysDict{}).Omit("id", "create_time").Where("id = ?", e.Id).Save(e)
 	return
 }
 
 // 删除字典类型
 func (e *SysDict) DeleteType() (err error) {
 	var count int64
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	query.Where("parent_id = ?", e.Id).Count(&count)
 	if count > 0 {
-		err = errors.New("存在子级,不允许删除")
+		err = config.ErrInUse.With(i18n.M("inUse.dictChildren"))
 		return
 	}
-	config.DB.Table(e.TableName()).Where("id = ?", e.Id).Delete(SysDict{})
+	e.DB().Table(e.TableName()).Where("id = ?", e.Id).Delete(SysDict{})
 	return
 }
 
 // 删除字典项
 func (e *SysDict) Delete(ids []string) (err error) {
-	config.DB.Table(e.TableName()).Delete(&SysRole{}, ids)
+	e.DB().Table(e.TableName()).Delete(&SysRole{}, ids)
 	return
 }
 
@@ -205,10 +205,10 @@ func (e *SysDict) GetSelectList() []SysDict {
 	var dict SysDict
 	var list []SysDict // 查询结果
 	// 先根据字典代码查询字典类型
-	config.DB.Table(e.TableName()).Where("dict_code = ?", e.DictCode).Find(&dict)
+	e.DB().Table(e.TableName()).Where("dict_code = ?", e.DictCode).Find(&dict)
 	// 再根据字典类型的id查询它下面的字典项列表
-	//config.DB.Table(e.TableName()).Where("parent_id = ? and is_type = 2", dict.Id).Debug().Order("sort asc").Find(&list)
-	config.DB.Table(e.TableName()).Where("parent_id = ?", dict.Id).Debug().Order("sort asc").Find(&list)
+	//e.DB().Table(e.TableName()).Where("parent_id = ? and is_type = 2", dict.Id).Debug().Order("sort asc").Find(&list)
+	e.DB().Table(e.TableName()).Where("parent_id = ?", dict.Id).Debug().Order("sort asc").Find(&list)
 	return list
 }
 
@@ -0,0 +1,26 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/lockout"
+	"strings"
+)
+
+// 登录失败记录和锁定状态列表
+func GetLockouts() ([]lockout.State, error) {
+	return config.Lockouts.List()
+}
+
+// 解除锁定，ids 格式为 类型:账号或IP（如 user:admin、ip:127.0.0.1）
+func ClearLockouts(ids []string) error {
+	for _, id := range ids {
+		kind, subject, ok := strings.Cut(id, ":")
+		if !ok || (kind != lockout.KindUser && kind != lockout.KindIP) || subject == "" {
+			return config.ErrParam
+		}
+		if err := config.Lockouts.Clear(kind, subject); err != nil {
+			return config.ErrUnknown.WithMessage("error.unlock", "解除锁定失败")
+		}
+	}
+	return nil
+}
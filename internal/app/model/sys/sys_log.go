@@ -2,8 +2,10 @@ package sys
 
 import (
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/logger"
 	"fmt"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"strings"
 	"time"
 )
@@ -11,48 +13,172 @@ import (
 // 操作日志管理
 type SysLog struct {
 	config.BaseModel
-	IP     string `gorm:"ip" json:"ip"`         // 用户请求IP
-	Title  string `gorm:"title" json:"title"`   // 用户请求的标题
-	Type   string `gorm:"type" json:"title"`    // 操作类型（其他 登录 退出 新增 修改 删除 上传 导入 设置密码 重置密码）
-	Method string `gorm:"method" json:"method"` // 用户请求的方法
-	Url    string `gorm:"url" json:"url"`       // 请求url
-	Info   string `gorm:"info" json:"info"`     // 详细信息
-	State  string `gorm:"state" json:"state"`   // 状态（操作成功 操作失败）
+	IP       string `gorm:"ip" json:"ip"`                  // 用户请求IP
+	Title    string `gorm:"title" json:"title"`            // 用户请求的标题
+	Type     string `gorm:"type" json:"type"`              // 操作类型（其他 登录 退出 新增 修改 删除 上传 导入 设置密码 重置密码）
+	Method   string `gorm:"method" json:"method"`          // 用户请求的方法
+	Url      string `gorm:"url" json:"url"`                // 请求url
+	Info     string `gorm:"info" json:"info"`              // 详细信息
+	State    string `gorm:"state" json:"state"`            // 状态（操作成功 操作失败）
+	Group    string `gorm:"column:api_group" json:"group"` // 接口所属组
+	Params   string `gorm:"params" json:"params"`          // 请求参数（密码等敏感字段已脱敏）
+	Code     int    `gorm:"code" json:"code"`              // 返回码
+	Latency  int64  `gorm:"latency" json:"latency"`        // 耗时（毫秒）
+	Seq      int64  `gorm:"seq" json:"seq"`                // 哈希链序号，没有开启哈希链时为0
+	PrevHash string `gorm:"prev_hash" json:"prevHash"`     // 上一条日志的哈希
+	Hash     string `gorm:"hash" json:"hash"`              // 本条日志内容和上一条日志哈希的哈希
 }
 
+// 接口处理函数可以通过 c.Locals 补充操作日志的信息
+const (
+	LogOperator = "logOperator" // 操作人，没有登录的接口（如登录）需要设置
+	LogInfo     = "logInfo"     // 详细信息，不设置时失败的记录返回信息
+	LogState    = "logState"    // 状态，不设置时根据返回码判断
+)
+
+// 异步写入操作日志的队列，为空时同步写入
+var logQueue chan *SysLog
+
+var log = logger.Named("model")
+
 // 获取表名
 func (SysLog) TableName() string {
 	return "sys_log"
 }
 
-// 列表
-func (e *SysLog) GetPage(pageSize int, pageNum int) config.PageInfo {
-	var list []SysLog // 查询结果
-	var total int64   // 总数
-	query := config.DB.Table(e.TableName())
-	var creatorId string
-	if e.CreatorId != nil {
-		creatorId = *e.CreatorId
+// 操作日志查询条件，时间范围按 create_time 查询（create_time 需要建索引）
+type SysLogQuery struct {
+	Operator  string    // 操作人（用户名或真实姓名，模糊查询）
+	IP        string    // 请求IP（模糊查询）
+	Type      string    // 操作类型
+	State     string    // 状态
+	Url       string    // 请求地址（模糊查询）
+	StartTime time.Time // 开始时间（包含），零值不限制
+	EndTime   time.Time // 结束时间（不包含），零值不限制
+}
+
+// 操作日志列表展示，操作人的真实姓名从用户表关联查询
+type SysLogView struct {
+	SysLog
+	RealName string `json:"realName"` // 操作人真实姓名
+}
+
+// 根据查询条件拼接sql
+func (q *SysLogQuery) query() *gorm.DB {
+	query := config.DB.Table(SysLog{}.TableName() + " a").Joins("LEFT JOIN sys_user b ON a.creator_id = b.user_name")
+	if q.Operator != "" {
+		like := fmt.Sprintf("%%%s%%", q.Operator)
+		query.Where("(a.creator_id like ? or b.real_name like ?)", like, like)
+	}
+	if q.IP != "" {
+		query.Where("a.ip like ?", fmt.Sprintf("%%%s%%", q.IP))
+	}
+	if q.Type != "" {
+		query.Where("a.type = ?", q.Type)
+	}
+	if q.State != "" {
+		query.Where("a.state = ?", q.State)
 	}
-	if creatorId != "" {
-		query.Where("creator_id like ?", fmt.Sprintf("%%%s%%", creatorId))
+	if q.Url != "" {
+		query.Where("a.url like ?", fmt.Sprintf("%%%s%%", q.Url))
 	}
-	if e.IP != "" {
-		query.Where("ip like ?", fmt.Sprintf("%%%s%%", e.IP))
+	if !q.StartTime.IsZero() {
+		query.Where("a.create_time >= ?", q.StartTime)
 	}
-	if !e.CreateTime.IsZero() {
-		query.Where("DATE_FORMAT(create_time,'%Y-%m-%d') = ?", e.CreateTime.Format("2006-01-02"))
+	if !q.EndTime.IsZero() {
+		query.Where("a.create_time < ?", q.EndTime)
 	}
-	offset := (pageNum - 1) * pageSize                                                 // 计算跳过的记录数
-	query.Debug().Order("create_time desc").Offset(offset).Limit(pageSize).Find(&list) // 分页查询，根据offset和limit来查询
-	query.Count(&total)
-	return config.PageInfo{list, total}
+	return query
+}
+
+// 列表
+func (q *SysLogQuery) GetPage(pageSize int, pageNum int) config.PageInfo {
+	var list []SysLogView // 查询结果
+	var total int64       // 总数
+	q.query().Count(&total)
+	offset := (pageNum - 1) * pageSize // 计算跳过的记录数
+	q.query().Select("a.*, b.real_name").Order("a.create_time desc").Offset(offset).Limit(pageSize).Find(&list)
+	return config.PageInfo{List: list, Total: total}
+}
+
+// 按查询条件逐行读取，不会一次性加载到内存中，fn 返回错误时停止读取。limit 为最多读取的行数
+func (q *SysLogQuery) Each(limit int, fn func(row SysLogView) error) error {
+	rows, err := q.query().Select("a.*, b.real_name").Order("a.create_time desc").Limit(limit).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row SysLogView
+		if err = config.DB.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err = fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
 // 新增
 func (e *SysLog) Insert() (err error) {
 	e.Id = strings.ReplaceAll(uuid.NewString(), "-", "")
-	e.CreateTime = time.Now()
-	config.DB.Create(e)
-	return
+	e.CreateTime = time.Now().Truncate(time.Second)
+	return saveLogs([]*SysLog{e})
+}
+
+// 启动操作日志的异步写入，size 为队列大小，队列满了的日志会丢弃（输出到日志文件），不会阻塞请求
+func StartLogWriter(size int) {
+	logQueue = make(chan *SysLog, size)
+	go func() {
+		batch := make([]*SysLog, 0, 100)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if err := saveLogs(batch); err != nil {
+				log.Error("操作日志写入失败", "count", len(batch), "err", err)
+			}
+			batch = make([]*SysLog, 0, 100)
+		}
+		// 每100条或者每秒批量写入一次
+		for {
+			select {
+			case e := <-logQueue:
+				batch = append(batch, e)
+				if len(batch) == cap(batch) {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
+
+// 异步新增，没有启动异步写入时同步写入
+func (e *SysLog) InsertAsync() {
+	if logQueue == nil {
+		e.Insert()
+		return
+	}
+	e.Id = strings.ReplaceAll(uuid.NewString(), "-", "")
+	e.CreateTime = time.Now().Truncate(time.Second) // 数据库只保存到秒，哈希要和数据库中的一致
+	select {
+	case logQueue <- e:
+	default:
+		log.ErrorContext(e.Ctx, "操作日志队列已满，丢弃日志", "ip", e.IP, "method", e.Method, "url", e.Url, "state", e.State)
+	}
+}
+
+// 批量保存，开启了哈希链的在事务中计算哈希
+func saveLogs(list []*SysLog) error {
+	if !config.AuditChain {
+		return config.DB.Table(SysLog{}.TableName()).CreateInBatches(list, len(list)).Error
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return appendChain(tx, list)
+	})
 }
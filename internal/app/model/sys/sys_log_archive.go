@@ -0,0 +1,120 @@
+package sys
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fiber-web-api/internal/app/common/config"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 每批归档的日志数量
+const logArchiveBatch = 1000
+
+// 启动操作日志的定时归档：超过保留天数的日志按月追加到 sys_log_YYYYMM.jsonl.gz 后从表中删除
+// 启动时执行一次，之后每小时执行一次。保留天数为0时不归档
+func StartLogArchive() {
+	if config.AuditRetention <= 0 {
+		return
+	}
+	go func() {
+		for {
+			if err := ArchiveLogs(); err != nil {
+				log.Error("操作日志归档失败", "err", err)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// 归档超过保留天数的日志，多实例部署时只有拿到锁的实例执行
+func ArchiveLogs() error {
+	ok, err := config.Cache.SetNX(config.AuditArchiveLock, "1", time.Hour)
+	if err != nil || !ok {
+		return err
+	}
+	defer config.Cache.Del(config.AuditArchiveLock)
+	if err = os.MkdirAll(config.AuditArchive, 0750); err != nil {
+		return err
+	}
+	cutoff := time.Now().AddDate(0, 0, -config.AuditRetention)
+	for {
+		n, err := archiveBatch(cutoff)
+		if err != nil || n < logArchiveBatch {
+			return err
+		}
+	}
+}
+
+// 归档一批日志，返回归档的数量
+// 按哈希链的序号顺序归档（没有开启哈希链的序号都是0，按时间顺序），遇到没有过期的日志就停止，保证剩下的日志序号是连续的
+func archiveBatch(cutoff time.Time) (int, error) {
+	var list []SysLog
+	if err := config.DB.Table(SysLog{}.TableName()).Order("seq, create_time").Limit(logArchiveBatch).Find(&list).Error; err != nil {
+		return 0, err
+	}
+	n := 0
+	for n < len(list) && list[n].CreateTime.Before(cutoff) {
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	list = list[:n]
+	// 先写归档文件再删除，删除失败时下次会重复归档（不会丢失）
+	months := map[string][]SysLog{}
+	for _, row := range list {
+		month := row.CreateTime.Format("200601")
+		months[month] = append(months[month], row)
+	}
+	for month, rows := range months {
+		if err := appendArchive(filepath.Join(config.AuditArchive, "sys_log_"+month+".jsonl.gz"), rows); err != nil {
+			return 0, err
+		}
+	}
+	ids := make([]string, 0, n)
+	for _, row := range list {
+		ids = append(ids, row.Id)
+	}
+	last := list[n-1]
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(SysLog{}.TableName()).Where("id in ?", ids).Delete(&SysLog{}).Error; err != nil {
+			return err
+		}
+		// 记录最后一条已归档日志的哈希，校验哈希链时从这里开始
+		if last.Seq > 0 {
+			updates := map[string]any{"archive_seq": last.Seq, "archive_hash": last.Hash}
+			return tx.Table(SysLogChain{}.TableName()).Where("id = 1").Updates(updates).Error
+		}
+		return nil
+	})
+	// 归档位置同时记录到链外锚点，校验时归档位置不能被改到锚点之前
+	if err == nil && last.Seq > 0 && config.AuditChain {
+		if err := appendAnchor(LogAnchor{Seq: last.Seq, Hash: last.Hash, Archived: true}); err != nil {
+			log.Error("记录操作日志归档锚点失败", "err", err)
+		}
+	}
+	return n, err
+}
+
+// 追加到归档文件，每次追加一个新的 gzip 成员（多个成员拼接仍然是合法的 gzip 文件），每行一条 json
+func appendArchive(path string, rows []SysLog) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	zw := gzip.NewWriter(file)
+	encoder := json.NewEncoder(zw)
+	for _, row := range rows {
+		if err = encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
@@ -0,0 +1,222 @@
+package sys
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fiber-web-api/internal/app/common/config"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 链外锚点的记录间隔
+const logAnchorInterval = 5 * time.Minute
+
+// 操作日志哈希链的链头，对应数据库的 sys_log_chain 表，只有 id=1 的一行
+// 每条日志的哈希 = HMAC-SHA256(日志内容 + 上一条日志的哈希)，密钥只保存在配置中，修改、删除任意一条日志都会导致后面的校验失败，
+// 没有密钥也无法重新计算后面的哈希。链头另外定时记录到数据库以外的锚点文件中，用于发现末尾的日志被删除、链头被回退
+type SysLogChain struct {
+	Id          int    `json:"id"`
+	Seq         int64  `json:"seq"`         // 最后一条日志的序号
+	Hash        string `json:"hash"`        // 最后一条日志的哈希
+	ArchiveSeq  int64  `json:"archiveSeq"`  // 最后一条已归档日志的序号，校验时从它的下一条开始
+	ArchiveHash string `json:"archiveHash"` // 最后一条已归档日志的哈希
+}
+
+// 获取表名
+func (SysLogChain) TableName() string {
+	return "sys_log_chain"
+}
+
+// 哈希链校验结果
+type LogChainResult struct {
+	Ok        bool   `json:"ok"`        // 是否完整
+	Checked   int64  `json:"checked"`   // 已校验的日志数量
+	BrokenSeq int64  `json:"brokenSeq"` // 第一个断开的位置（序号）
+	BrokenId  string `json:"brokenId"`  // 第一个断开位置的日志id，日志被删除时为空
+	Reason    string `json:"reason"`    // 断开的原因
+}
+
+// 在事务中锁定链头，依次计算日志的哈希后保存，多实例部署时也能保证序号连续
+func appendChain(tx *gorm.DB, list []*SysLog) error {
+	// 第一次使用时初始化链头
+	if err := tx.Exec("INSERT IGNORE INTO sys_log_chain (id, seq, hash, archive_seq, archive_hash) VALUES (1, 0, '', 0, '')").Error; err != nil {
+		return err
+	}
+	head := SysLogChain{}
+	if err := tx.Table(head.TableName()).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = 1").Take(&head).Error; err != nil {
+		return err
+	}
+	for _, e := range list {
+		head.Seq++
+		e.Seq = head.Seq
+		e.PrevHash = head.Hash
+		e.Hash = e.chainHash()
+		head.Hash = e.Hash
+	}
+	if err := tx.Table(SysLog{}.TableName()).CreateInBatches(list, len(list)).Error; err != nil {
+		return err
+	}
+	return tx.Table(head.TableName()).Where("id = 1").Updates(map[string]any{"seq": head.Seq, "hash": head.Hash}).Error
+}
+
+// 计算日志的哈希，字段之间用 \x1f 分隔，避免拼接后产生歧义
+func (e *SysLog) chainHash() string {
+	creator := ""
+	if e.CreatorId != nil {
+		creator = *e.CreatorId
+	}
+	fields := []string{
+		e.Id, strconv.FormatInt(e.Seq, 10), creator, strconv.FormatInt(e.CreateTime.Unix(), 10),
+		e.IP, e.Title, e.Type, e.Method, e.Url, e.Info, e.State, e.Group, e.Params,
+		strconv.Itoa(e.Code), strconv.FormatInt(e.Latency, 10), e.PrevHash,
+	}
+	mac := hmac.New(sha256.New, config.AuditChainKey)
+	mac.Write([]byte(strings.Join(fields, "\x1f")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 链外锚点，锚点文件每行一条 json
+type LogAnchor struct {
+	Seq      int64     `json:"seq"`
+	Hash     string    `json:"hash"`
+	Archived bool      `json:"archived,omitempty"` // 是否是归档位置
+	Time     time.Time `json:"time"`
+}
+
+// 启动链外锚点的定时记录：链头有变化时追加到锚点文件
+func StartLogAnchor() {
+	if !config.AuditChain {
+		return
+	}
+	go func() {
+		var last int64
+		for {
+			head := SysLogChain{}
+			config.DB.Table(head.TableName()).Where("id = 1").Find(&head)
+			if head.Seq != last {
+				if err := appendAnchor(LogAnchor{Seq: head.Seq, Hash: head.Hash}); err != nil {
+					log.Error("记录操作日志锚点失败", "err", err)
+				} else {
+					last = head.Seq
+				}
+			}
+			time.Sleep(logAnchorInterval)
+		}
+	}()
+}
+
+func appendAnchor(anchor LogAnchor) error {
+	if err := os.MkdirAll(filepath.Dir(config.AuditAnchor), 0750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(config.AuditAnchor, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	anchor.Time = time.Now()
+	line, _ := json.Marshal(anchor)
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// 读取锚点文件，返回 序号 -> 哈希 和最后一个归档位置，文件不存在时为空
+func readAnchors() (map[int64]string, *LogAnchor, error) {
+	anchors := map[int64]string{}
+	file, err := os.Open(config.AuditAnchor)
+	if os.IsNotExist(err) {
+		return anchors, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	var archived *LogAnchor
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var anchor LogAnchor
+		if json.Unmarshal(scanner.Bytes(), &anchor) != nil || anchor.Seq <= 0 {
+			continue
+		}
+		anchors[anchor.Seq] = anchor.Hash
+		if anchor.Archived {
+			archived = &anchor
+		}
+	}
+	return anchors, archived, scanner.Err()
+}
+
+// 按序号逐条校验哈希链，返回第一个断开的位置。已归档的日志从归档记录的位置开始校验，
+// 并且和链外锚点比对：锚点记录过的位置哈希必须一致，链头不能在锚点之前（末尾的日志被删除、链头被回退）
+func VerifyLogChain() (*LogChainResult, error) {
+	head := SysLogChain{}
+	config.DB.Table(head.TableName()).Where("id = 1").Find(&head)
+	anchors, archived, err := readAnchors()
+	if err != nil {
+		return nil, err
+	}
+	var maxAnchor int64
+	for seq := range anchors {
+		maxAnchor = max(maxAnchor, seq)
+	}
+	rows, err := config.DB.Table(SysLog{}.TableName()).Where("seq > 0").Order("seq").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := &LogChainResult{}
+	seq, hash := head.ArchiveSeq, head.ArchiveHash
+	if archived != nil && (seq < archived.Seq || seq == archived.Seq && hash != archived.Hash) {
+		result.BrokenSeq = archived.Seq
+		result.Reason = "归档位置和链外锚点不一致"
+		return result, nil
+	}
+	broken := func(row *SysLog, reason string) (*LogChainResult, error) {
+		result.BrokenSeq = seq + 1
+		if row != nil {
+			result.BrokenId = row.Id
+		}
+		result.Reason = reason
+		return result, nil
+	}
+	for rows.Next() {
+		var row SysLog
+		if err = config.DB.ScanRows(rows, &row); err != nil {
+			return nil, err
+		}
+		switch {
+		case row.Seq <= seq:
+			return broken(&row, fmt.Sprintf("序号%d重复或已归档", row.Seq))
+		case row.Seq != seq+1:
+			return broken(nil, fmt.Sprintf("序号%d到%d的日志缺失", seq+1, row.Seq-1))
+		case row.PrevHash != hash:
+			return broken(&row, "和上一条日志的哈希不一致")
+		case row.chainHash() != row.Hash:
+			return broken(&row, "日志内容被修改")
+		case anchors[row.Seq] != "" && anchors[row.Seq] != row.Hash:
+			return broken(&row, "和链外锚点不一致")
+		}
+		seq, hash = row.Seq, row.Hash
+		result.Checked++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// 最后一条要和链头一致，并且不能在锚点之前，否则是末尾的日志被删除了
+	if seq != head.Seq || hash != head.Hash || seq < maxAnchor {
+		return broken(nil, fmt.Sprintf("序号%d之后的日志缺失", seq))
+	}
+	result.Ok = true
+	return result, nil
+}
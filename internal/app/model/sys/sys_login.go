@@ -1,11 +1,14 @@
 package sys
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/store"
 	"fiber-web-api/internal/app/common/utils"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"strconv"
 	"strings"
 	"time"
@@ -13,113 +16,214 @@ import (
 
 // ======================================= 登录相关 =======================================
 
-// 用户登录：user 用户信息 loginType 登录类型 expire 有效期
-func (user *SysUser) Login(loginType string, expire time.Duration) string {
+// 登录参数
+type LoginOption struct {
+	LoginType string        // 登录类型
+	Expire    time.Duration // 有效期，小于0表示永不过期
+	IP        string        // 登录IP
+	UserAgent string        // 登录设备（User-Agent）
+	Restrict  string        // 会话限制，不为空时只能访问限制范围内的接口（如密码已过期时只能修改密码）
+}
+
+// 用户登录：user 用户信息 opt 登录参数
+func (user *SysUser) Login(opt LoginOption) string {
+	user.applySessionPolicy()
+	return user.createSession(opt, "")
+}
+
+// 新建会话并返回会话id（opaque模式下就是token），refresh 为jwt模式下刷新令牌的摘要
+func (user *SysUser) createSession(opt LoginOption, refresh string) string {
 	str := utils.MD5(user.UserName) // 用户名md5加密
 	// 设置登录类型前缀
-	if len(loginType) > 0 {
-		str = loginType + "_" + str
-	}
-	// 删除所有以当前用户名开头的key
-	keys, _, _ := config.RedisConn.Scan(uint64(0), config.CachePrefix+str+"*", 1000).Result()
-	for i := range keys {
-		config.RedisConn.Del(keys[i])
+	if len(opt.LoginType) > 0 {
+		str = opt.LoginType + "_" + str
 	}
 	token := str + utils.GenerateRandomToken(32) // 生成token
 	user.Token = token
 	userJson, _ := json.Marshal(user)
-	var expireTime float64 = -1 // token的有效时长
-	if expire > 0 {
-		expireTime = expire.Seconds()
-	}
-	loginMap := map[string]any{
-		"createTime": time.Now().Unix(),
-		"user":       string(userJson),
-		"expire":     expireTime,
-	}
-	// 将用户信息map设置到redis中
-	config.RedisConn.HMSet(config.CachePrefix+token, loginMap)
-	// 设置有效期
-	if expire > 0 {
-		config.RedisConn.Expire(config.CachePrefix+token, expire)
-	}
+	// 保存会话，expire 小于0时永不过期
+	config.Sessions.Create(&store.Session{
+		Id:         strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Token:      token,
+		UserId:     user.Id,
+		User:       string(userJson),
+		LoginType:  opt.LoginType,
+		IP:         opt.IP,
+		UserAgent:  opt.UserAgent,
+		CreateTime: time.Now().Unix(),
+		Expire:     opt.Expire,
+		Refresh:    refresh,
+		Restrict:   opt.Restrict,
+	})
 	// 判断当前用户部门是否存在数据权限设置
-	exists, _ := config.RedisConn.Exists(config.DATA_SCOPE + user.DeptId).Result()
-	if exists == 0 {
+	if _, err := config.Cache.HGetAll(config.DATA_SCOPE + user.DeptId); err != nil {
 		SetDataScope(user.DeptId) // 如果没有，则需要设置
 	}
 	return token
 }
 
-// 获取请求头中携带的token，并解密、校验
-func GetToken(c *fiber.Ctx) (string, *config.Result) {
-	token := c.Get(config.TokenHeader)
-	// TODO 项目中需要放开下面的代码，配合前端请求头传过来的token和sign进行解析校验
-	/*sign := c.Get(config.Sign) // 这个是长度为16位的时间戳：前13位是毫秒级的时间戳，后面补3个0
-	if token == "" || sign == "" {
-		return "", config.ErrorCode(1003, "用户未登录")
-	}
-	fmt.Println("token=====>>>", token)
-	fmt.Println("sign=====>>>", sign)
-	// 校验前端传过来的sign和当前时间戳的差值，是否大于120秒
-	currentTime := time.Now().UnixMilli() // 获取当前毫秒级时间戳
-	signTime, err := strconv.ParseInt(sign[:13], 10, 64)
+// 重新生成token：用旧会话的用户和设备信息新建会话，再注销旧会话，返回新的token
+func RenewToken(token string) string {
+	session, err := config.Sessions.Get(token)
 	if err != nil {
-		mylog.Error(err.Error())
-		return "", config.ErrorCode(-1, config.UNKNOWN_EXCEPTION)
+		return token
 	}
-	diffSeconds := math.Abs(float64(currentTime-signTime)) / 1000 // 计算两个时间戳之间相差的秒数
-	fmt.Println("diffSeconds=====>>>", diffSeconds)
-	if diffSeconds > 120 {
-		return "", config.ErrorCode(-1, "令牌超时！")
+	user := SysUser{}
+	json.Unmarshal([]byte(session.User), &user)
+	newToken := user.createSession(LoginOption{
+		LoginType: session.LoginType,
+		Expire:    session.Expire,
+		IP:        session.IP,
+		UserAgent: session.UserAgent,
+		Restrict:  session.Restrict,
+	}, "")
+	revokeSessions(token)
+	return newToken
+}
+
+// 会话限制：只能修改密码（双因素认证的限制见 RestrictMfaEnroll）
+const (
+	RestrictPwdExpired = "pwdExpired" // 密码已过期
+	RestrictPwdChange  = "pwdChange"  // 首次登录或密码已重置
+)
+
+// 受限会话的返回信息
+func RestrictError(restrict string) *config.AppError {
+	if restrict == RestrictPwdChange {
+		return config.ErrPwdChange
+	}
+	if restrict == RestrictMfaEnroll {
+		return config.ErrMfaEnroll
+	}
+	return config.ErrPwdExpired
+}
+
+// 解除当前会话的限制（jwt模式下刷新令牌后生效）
+func ClearRestrict(token string) {
+	config.Sessions.SetRestrict(sessionId(token), "")
+}
+
+// 获取当前会话的限制，没有限制时返回空字符串
+func GetRestrict(token string) string {
+	if config.TokenMode == config.TokenModeJwt {
+		if claims, err := config.Tokens.Parse(token); err == nil {
+			return claims.Restrict
+		}
+		return ""
+	}
+	if session, err := config.Sessions.Get(token); err == nil {
+		return session.Restrict
+	}
+	return ""
+}
+
+// 获取请求头中携带的token，并解密、校验
+func GetToken(c *fiber.Ctx) (string, error) {
+	token := c.Get(config.TokenHeader)
+	if token == "" {
+		return "", config.ErrNotLogin
 	}
-	// token解密
-	decrypt, err := util.AESDecrypt(token, sign, sign)
-	if err != nil {
-		mylog.Error("解密算法异常 AESDecrypt() 解密方法，异常信息：" + err.Error())
-		return "", config.ErrorCode(-1, "解密算法异常！")
-	}*/
-	// TODO 这里因为没有前端，所以直接用token（正式使用时，把上面那段代码放开，下面这句删掉）
 	decrypt := token
-	// 校验携带的token在redis中是否存在
-	exists, _ := config.RedisConn.Exists(config.CachePrefix + decrypt).Result()
-	if exists == 0 {
-		return "", config.ErrorCode(1003, "用户未登录")
+	// 开启请求签名时，请求头中的token是加密后的密文，需要先解密
+	if config.SignEnable {
+		var err error
+		if decrypt, err = openToken(c, token); err != nil {
+			return "", err
+		}
+	}
+	// jwt模式下校验签名和有效期，并且令牌所属的会话不在注销列表中（只检查本地内存，不访问会话存储），
+	// 这样退出登录、注销会话、强制下线后访问令牌立即失效
+	if config.TokenMode == config.TokenModeJwt {
+		claims, err := config.Tokens.Parse(decrypt)
+		if err != nil || config.Revocations.Revoked(claims.Sid) {
+			return "", config.ErrNotLogin
+		}
+		return decrypt, nil
+	}
+	// 校验携带的token对应的会话是否存在
+	if _, err := config.Sessions.Get(decrypt); err != nil {
+		return "", config.ErrNotLogin
 	}
 	return decrypt, nil
 }
 
-// 用户退出
-func Logout(c *fiber.Ctx) *config.Result {
-	token, err := GetToken(c)
+// 解密请求头中的token：sign 请求头为13位毫秒级时间戳，token 为 base64(nonce+AES-GCM密文)，
+// 附加数据为 "sign\n请求方法\n请求路径"，这样密文只能用于这一个请求。时间戳与服务器时间的误差不能超过
+// 允许的范围，每个nonce只能使用一次
+func openToken(c *fiber.Ctx, token string) (string, error) {
+	sign := c.Get(config.Sign)
+	if sign == "" {
+		return "", config.ErrSignMissing
+	}
+	signTime, err := strconv.ParseInt(sign, 10, 64)
+	if err != nil || len(sign) != 13 {
+		return "", config.ErrSignInvalid
+	}
+	// 校验前端传过来的sign和当前时间戳的差值
+	diff := time.Now().UnixMilli() - signTime
+	if diff < 0 {
+		diff = -diff
+	}
+	if time.Duration(diff)*time.Millisecond > config.SignSkewTime {
+		return "", config.ErrSignExpired
+	}
+	aad := sign + "\n" + c.Method() + "\n" + c.Path()
+	decrypt, nonce, err := utils.AESGCMDecrypt(token, config.SignKey, aad)
 	if err != nil {
-		return err
+		log.WarnContext(c.UserContext(), "令牌解密失败", "ip", config.ClientIP(c), "err", err)
+		return "", config.ErrSignInvalid.WithMessage("error.tokenDecrypt", "令牌解密失败")
+	}
+	// 超过时间误差的请求已经会被拒绝，所以nonce只需要缓存两倍的误差时间
+	ok, err := config.Cache.SetNX(config.SignNonce+hex.EncodeToString(nonce), "1", 2*config.SignSkewTime)
+	if err != nil {
+		log.ErrorContext(c.UserContext(), "保存nonce失败", "err", err)
+		return "", config.ErrUnknown
+	}
+	if !ok {
+		return "", config.ErrSignReplayed
+	}
+	return decrypt, nil
+}
+
+// 用户退出（token已经在中间件中解密、校验过，这里直接取请求头中的token）
+func Logout(c *fiber.Ctx) error {
+	token := c.Get(config.TokenHeader)
+	sid := sessionId(token)
+	if sid == "" {
+		return config.ErrNotLogin
 	}
-	config.RedisConn.Del(config.CachePrefix + token)
+	revokeSessions(sid)
 	return nil
 }
 
-// 获取当前用户的剩余有效时长，返回秒数，返回 -2 时，key已过期
+// 获取当前用户的剩余有效时长，返回秒数，返回 -1 时永不过期，返回 -2 时已过期
 func GetTimeOut(token string) int {
-	// 使用 TTL 命令获取 key 的剩余有效时长，如果 key 不存在或已过期，TTL 将返回 -2
-	ttl, err := config.RedisConn.TTL(config.CachePrefix + token).Result()
+	ttl, err := config.Sessions.TTL(sessionId(token))
 	if err != nil {
 		return -2
 	}
+	if ttl == store.NoExpire {
+		return -1
+	}
 	return int(ttl.Seconds())
 }
 
 // 获取当前用户
 func GetLoginUser(token string) *SysUser {
-	val, _ := config.RedisConn.HGet(config.CachePrefix+token, "user").Result()
 	user := SysUser{}
-	json.Unmarshal([]byte(val), &user)
-	// 判断当前用户部门是否存在数据权限设置
-	exists, _ := config.RedisConn.Exists(config.DATA_SCOPE + user.DeptId).Result()
-	if exists == 0 {
-		SetDataScope(user.DeptId) // 如果没有，则需要设置
+	if config.TokenMode == config.TokenModeJwt {
+		if claims, err := config.Tokens.Parse(token); err == nil {
+			user = claimsUser(claims)
+			user.Token = token
+		}
+	} else if session, err := config.Sessions.Get(token); err == nil {
+		json.Unmarshal([]byte(session.User), &user)
+	}
+	// 判断当前用户部门是否存在数据权限设置，如果没有，则需要设置
+	dataScope, err := config.Cache.HGetAll(config.DATA_SCOPE + user.DeptId)
+	if err != nil && user.DeptId != "" {
+		dataScope = SetDataScope(user.DeptId)
 	}
-	dataScope := config.RedisConn.HGetAll(config.DATA_SCOPE + user.DeptId).Val()
 	user.AncestorId = dataScope["ancestorId"]
 	user.AncestorName = dataScope["ancestorName"]
 	user.ChildId = dataScope["childId"]
@@ -133,85 +237,102 @@ func GetLoginId(token string) *string {
 	return &user.Id
 }
 
+// 获取令牌对应的用户id、用户名和语言偏好，只读取会话（jwt模式下只解析令牌），不查询用户信息
+func GetSessionUser(token string) (userId, userName, locale string) {
+	if config.TokenMode == config.TokenModeJwt {
+		if claims, err := config.Tokens.Parse(token); err == nil {
+			return claims.Subject, claims.UserName, claims.Locale
+		}
+		return
+	}
+	if session, err := config.Sessions.Get(token); err == nil {
+		user := struct {
+			UserName string `json:"userName"`
+			Locale   string `json:"locale"`
+		}{}
+		json.Unmarshal([]byte(session.User), &user)
+		return session.UserId, user.UserName, user.Locale
+	}
+	return
+}
+
 // 获取当前用户token的创建时间
 func GetCreateTime(token string) int64 {
-	val, _ := config.RedisConn.HGet(config.CachePrefix+token, "createTime").Result()
-	r, _ := strconv.ParseInt(val, 10, 64)
-	return r
+	session, err := config.Sessions.Get(sessionId(token))
+	if err != nil {
+		return 0
+	}
+	return session.CreateTime
 }
 
 // 获取当前用户token设置的有效期
 func GetExpire(token string) time.Duration {
-	val, _ := config.RedisConn.HGet(config.CachePrefix+token, "expire").Result()
-	r, _ := strconv.ParseFloat(val, 64)
-	if r == -1 {
+	session, err := config.Sessions.Get(sessionId(token))
+	if err != nil || session.Expire < 0 {
 		return -1
 	}
-	expire := time.Second * time.Duration(r)
-	return expire
+	return session.Expire
 }
 
 // 获取当前用户的所有权限集合
 func GetPermList(roleId string) []string {
-	redis := config.RedisConn
-	val := redis.Exists(config.RolePermList).Val()
-	if val == 0 {
-		// redis中不存在，则添加
+	data, err := config.Cache.HGetAll(config.RolePermList)
+	if err != nil {
+		// 缓存中不存在，则添加
 		permList := GetPermsAll()
-		result := make(map[string]interface{})
+		result := make(map[string]string)
 		for key, v := range permList {
 			result[key] = strings.Join(v, ";")
 		}
-		redis.HMSet(config.RolePermList, result)
-		redis.Expire(config.RolePermList, time.Second*604800)
+		config.Cache.HSet(config.RolePermList, result)
+		config.Cache.Expire(config.RolePermList, time.Second*604800)
 		return permList[roleId]
-	} else {
-		// redis中存在，直接从redis中拿
-		data := redis.HGet(config.RolePermList, roleId).Val()
-		permList := []string{}
-		split := strings.Split(data, ";")
-		for i := range split {
-			permList = append(permList, split[i])
-		}
-		return permList
 	}
+	// 缓存中存在，直接从缓存中拿
+	if data[roleId] == "" {
+		return []string{}
+	}
+	return strings.Split(data[roleId], ";")
 }
 
-// 刷新过期时间
+// 刷新过期时间，expire 为 -1 时永不过期
 func UpdateTimeOut(token string, expire time.Duration) {
-	if expire.Seconds() < 0 {
-		// -1 永不过期，Persist 将删除key的过期时间，使其永不过期
-		config.RedisConn.Persist(config.CachePrefix + token)
-	} else {
-		config.RedisConn.Expire(config.CachePrefix+token, expire)
-	}
+	config.Sessions.Touch(sessionId(token), expire)
 }
 
 // 更新用户信息
 func (user *SysUser) UpdateUser(token string) {
-	config.RedisConn.HSet(config.CachePrefix+token, "user", user)
+	userJson, _ := json.Marshal(user)
+	config.Sessions.SetUser(sessionId(token), string(userJson))
 }
 
 // ======================================= 数据权限相关 =======================================
 
-// 设置当前部门的数据范围
-func SetDataScope(deptId string) {
-	if deptId != "" {
-		dept := SysDept{}
-		dept.Id = deptId
-		// 这里的数据权限条件存了部门id和名称，如果没有特殊要求的话，只用部门id也可以的。
-		// 但是因为我的项目的业务原因，需要用到部门名称来过滤数据（因为有的表的数据判断是哪个部门的数据，用的不是部门id而是部门名称）
-		childId, childName := GetDeptChild(deptId)     // 当前部门及子部门id和名称
-		ancestorId, ancestorName := dept.GetAncestor() // 当前部门祖级id和名称
-		dataScope := map[string]any{
-			"ancestorId":   ancestorId,
-			"ancestorName": ancestorName,
-			"childId":      childId,
-			"childName":    childName,
-		}
-		// 将数据范围信息map设置到redis中，并设置有效期为2小时
-		config.RedisConn.HMSet(config.DATA_SCOPE+dept.Id, dataScope)
-		config.RedisConn.Expire(config.DATA_SCOPE+dept.Id, time.Second*7200)
+// 设置当前部门的数据范围，返回查询到的数据范围
+func SetDataScope(deptId string) map[string]string {
+	if deptId == "" {
+		return map[string]string{}
+	}
+	dataScope := getDataScope(deptId)
+	// 将数据范围信息map设置到缓存中，并设置有效期为2小时
+	config.Cache.HSet(config.DATA_SCOPE+deptId, dataScope)
+	config.Cache.Expire(config.DATA_SCOPE+deptId, time.Second*7200)
+	return dataScope
+}
+
+// 从数据库查询当前部门的数据范围
+func getDataScope(deptId string) map[string]string {
+	dept := SysDept{}
+	dept.Id = deptId
+	// 这里的数据权限条件存了部门id和名称，如果没有特殊要求的话，只用部门id也可以的。
+	// 但是因为我的项目的业务原因，需要用到部门名称来过滤数据（因为有的表的数据判断是哪个部门的数据，用的不是部门id而是部门名称）
+	childId, childName := GetDeptChild(deptId)     // 当前部门及子部门id和名称
+	ancestorId, ancestorName := dept.GetAncestor() // 当前部门祖级id和名称
+	return map[string]string{
+		"ancestorId":   ancestorId,
+		"ancestorName": ancestorName,
+		"childId":      childId,
+		"childName":    childName,
 	}
 }
 
@@ -2,9 +2,9 @@ package sys
 
 import (
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/pkg/errors"
 	"strings"
 	"time"
 )
@@ -63,7 +63,7 @@ var sql = `
 // 树形菜单列表
 func (e *SysMenu) GetList() interface{} {
 	var list []SysMenu // 查询结果
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	if e.Id != "" { // 角色id不为空，根据角色获取菜单
 		where := sql + " where b.role_id = ?"
 		args := []interface{}{e.Id}
@@ -93,13 +93,13 @@ func (e *SysMenu) GetRouters() interface{} {
 	var list []SysMenu // 查询结果
 	where := ` where b.role_id = ? and type in ('M', 'C') and a.state = 1`
 	where = sql + where
-	config.DB.Table(e.TableName()).Debug().Order("parent_id,sort asc").Raw(where, e.Id).Find(&list)
+	e.DB().Table(e.TableName()).Debug().Order("parent_id,sort asc").Raw(where, e.Id).Find(&list)
 	return buildMenus(e.BuildTree(list, "ROOT"))
 }
 
 // 详情
 func (e *SysMenu) GetById() {
-	config.DB.Table(e.TableName()).Where("id = ?", e.Id).Find(e)
+	e.DB().Table(e.TableName()).Where("id = ?", e.Id).Find(e)
 }
 
 // 根据角色id获取菜单权限标识
@@ -124,19 +124,19 @@ func GetPermsMenuByRoleId(roleId string) []string {
 func (e *SysMenu) Insert() (err error) {
 	var count int64
 	// 校验角色名称和角色代码
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	if e.ParentId == "0" {
 		e.ParentId = "ROOT"
 	}
 	query.Where("name = ? and parent_id = ?", e.Name, e.ParentId).Count(&count)
 	if count > 0 {
-		err = errors.New("菜单名称已存在！")
+		err = config.ErrExists.With(i18n.M("field.menuName"))
 		return
 	}
 	e.Id = strings.ReplaceAll(uuid.NewString(), "-", "")
 	e.CreatorId = GetLoginId(e.Token)
 	e.CreateTime = time.Now()
-	config.DB.Table(e.TableName()).Create(e)
+	e.DB().Table(e.TableName()).Create(e)
 	return
 }
 
@@ -144,23 +144,23 @@ func (e *SysMenu) Insert() (err error) {
 func (e *SysMenu) Update() (err error) {
 	var count int64
 	// 校验角色名称和角色代码
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	if e.ParentId == "0" {
 		e.ParentId = "ROOT"
 	}
 	if e.Id == e.ParentId {
-		err = errors.New("上级菜单不能是自己！")
+		err = config.ErrParam.WithMessage("error.menuParentSelf", "上级菜单不能是自己")
 		return
 	}
 	query.Where("name = ? and parent_id = ? and id <> ?", e.Name, e.ParentId, e.Id).Count(&count)
 	if count > 0 {
-		err = errors.New("菜单名称已存在！")
+		err = config.ErrExists.With(i18n.M("field.menuName"))
 		return
 	}
 	var m = SysMenu{}
-	config.DB.Model(&SysMenu{}).Where("id = ?", e.Id).Find(&m)
-	//config.DB.Model(&SysMenu{}).Select("parent_id", "name", "sort", "url", "path", "type", "state", "perms", "visible", "icon", "active_menu", "is_frame", "remark").Where("id = ?", e.Id).Save(e)
-	config.DB.Model(&SysMenu{}).Omit("id", "create_time").Where("id = ?", e.Id).Save(e)
+	e.DB().Model(&SysMenu{}).Where("id = ?", e.Id).Find(&m)
+	//e.DB().Model(&SysMenu{}).Select("parent_id", "name", "sort", "url", "path", "type", "state", "perms", "visible", "icon", "active_menu", "is_frame", "remark").Where("id = ?", e.Id).Save(e)
+	e.DB().Model(&SysMenu{}).Omit("id", "create_time").Where("id = ?", e.Id).Save(e)
 	if m.Perms != e.Perms { // 更改了权限标识，在redis缓存中也需要更改
 		UpdatePerm(m.Perms, e.Perms)
 	}
@@ -171,18 +171,18 @@ func (e *SysMenu) Update() (err error) {
 func (e *SysMenu) Delete() (err error) {
 	// 1、校验是否存在下级
 	var count int64
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	query.Where("parent_id = ?", e.Id).Count(&count)
 	if count > 0 {
-		err = errors.New("存在子级菜单,不允许删除")
+		err = config.ErrInUse.With(i18n.M("inUse.menuChildren"))
 		return
 	}
 	// 2、校验是否存在用户
 	if CheckMenuExistRole(e.Id) {
-		err = errors.New("菜单已分配,不允许删除")
+		err = config.ErrInUse.With(i18n.M("inUse.menuAssigned"))
 		return
 	}
-	if err = config.DB.Table(e.TableName()).Where("id = ?", e.Id).Delete(SysMenu{}).Error; err != nil {
+	if err = e.DB().Table(e.TableName()).Where("id = ?", e.Id).Delete(SysMenu{}).Error; err != nil {
 		return
 	}
 	return
@@ -241,17 +241,18 @@ func getRouterPath(menu SysMenu) string {
 	return routerPath
 }
 
-// 改了角色与权限关联时，更新redis中的角色与权限关联
+// 改了角色与权限关联时，更新缓存中的角色与权限关联
 func UpdatePermByRoleId(roleId string) {
 	perms := GetPermsMenuByRoleId(roleId)
-	config.RedisConn.HSet(config.RolePermList, roleId, strings.Join(perms, ";"))
+	config.Cache.HSet(config.RolePermList, map[string]string{roleId: strings.Join(perms, ";")})
 }
 
-// 修改菜单，改了菜单的权限标识时，更新redis中的权限标识
+// 修改菜单，改了菜单的权限标识时，更新缓存中的权限标识
 func UpdatePerm(oldPerm, newPerm string) {
-	redis := config.RedisConn
-	result := make(map[string]interface{})
-	data := redis.HGetAll(config.RolePermList).Val()
+	data, err := config.Cache.HGetAll(config.RolePermList)
+	if err != nil {
+		return
+	}
 	for key, val := range data {
 		split := strings.Split(val, ";")
 		for i, s := range split {
@@ -259,15 +260,13 @@ func UpdatePerm(oldPerm, newPerm string) {
 				split[i] = newPerm
 			}
 		}
-		result[key] = strings.Join(split, ";")
+		data[key] = strings.Join(split, ";")
 	}
-	redis.HMSet(config.RolePermList, result)
-	redis.Expire(config.RolePermList, time.Second*604800)
+	config.Cache.HSet(config.RolePermList, data)
+	config.Cache.Expire(config.RolePermList, time.Second*604800)
 }
 
-// 删除角色时，删除redis中的角色与权限关联
+// 删除角色时，删除缓存中的角色与权限关联
 func DeletePermByRoleId(roleIds []string) {
-	for i := range roleIds {
-		config.RedisConn.HDel(config.RolePermList, roleIds[i])
-	}
+	config.Cache.HDel(config.RolePermList, roleIds...)
 }
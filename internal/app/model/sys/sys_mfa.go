@@ -0,0 +1,366 @@
+package sys
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
+	"fiber-web-api/internal/app/common/utils"
+	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"image/png"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 会话限制：当前角色必须开启双因素认证，只能绑定身份验证器
+const RestrictMfaEnroll = "mfaEnroll"
+
+// 加密保存的TOTP密钥前缀
+const totpSealed = "gcm:"
+
+const (
+	recoveryCodeLength = 10 // 恢复码长度（不含分隔符）
+	recoveryPrefixLen  = 2  // 明文保存的恢复码前缀长度，用于查找
+)
+
+// 双因素认证的恢复码，对应数据库的 sys_recovery_code 表，每个恢复码只能使用一次
+type SysRecoveryCode struct {
+	Id         string    `json:"id"`
+	UserId     string    `json:"userId"`
+	Prefix     string    `json:"-"` // 恢复码的前两位（明文），使用时按它查找，不需要逐个比较
+	Code       string    `json:"-"` // bcrypt加密后的恢复码
+	CreateTime time.Time `json:"createTime"`
+}
+
+// 获取表名
+func (SysRecoveryCode) TableName() string {
+	return "sys_recovery_code"
+}
+
+// 绑定身份验证器时返回给前端的信息
+type MfaSetup struct {
+	Secret string `json:"secret"` // 密钥，无法扫码时手动输入
+	Uri    string `json:"uri"`    // otpauth://totp/... 地址
+	QrCode string `json:"qrCode"` // 二维码图片（base64）
+}
+
+// 双因素认证状态
+type MfaStatus struct {
+	Enable        bool  `json:"enable"`        // 是否已开启
+	Mandatory     bool  `json:"mandatory"`     // 当前角色是否必须开启
+	RecoveryCount int64 `json:"recoveryCount"` // 剩余可用的恢复码数量
+}
+
+// 当前用户的角色是否必须开启双因素认证
+func (e *SysUser) MfaMandatory(safe SysSafe) bool {
+	if safe.MfaMandatory != 1 {
+		return false
+	}
+	// 没有指定角色时，所有用户都必须开启
+	return safe.MfaRoleIds == "" || utils.IsContain(strings.Split(safe.MfaRoleIds, ","), e.RoleId)
+}
+
+// 校验动态验证码或恢复码，恢复码使用后失效
+func (e *SysUser) VerifyMfa(code string) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if e.TotpEnable != 1 || code == "" {
+		return false
+	}
+	if len(code) == 6 {
+		secret, err := openTotpSecret(e.Id, e.TotpSecret)
+		if err != nil {
+			log.Error("双因素认证密钥解密失败", "userId", e.Id, "err", err)
+			return false
+		}
+		return validateTotp(e.Id, secret, code)
+	}
+	return useRecoveryCode(e.Id, code)
+}
+
+// 是否配置了加密TOTP密钥的 mfa.key，没有配置时不能使用双因素认证
+func CheckMfaKey() error {
+	if len(config.MfaKey) == 0 {
+		return config.ErrUnknown.WithMessage("error.mfaKey", "未配置双因素认证密钥（mfa.key），不能使用双因素认证")
+	}
+	return nil
+}
+
+// 密码验证通过后，生成等待动态验证码的临时令牌
+func NewMfaChallenge(userId string) (string, error) {
+	challenge := strings.ReplaceAll(uuid.NewString(), "-", "")
+	if err := config.Cache.Set(config.MfaChallenge+challenge, userId, config.MfaChallengeTime); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// 根据临时令牌获取用户，令牌不存在或已过期时返回空
+func GetMfaChallenge(challenge string) *SysUser {
+	if challenge == "" {
+		return nil
+	}
+	userId, err := config.Cache.Get(config.MfaChallenge + challenge)
+	if err != nil {
+		return nil
+	}
+	// 登录时要用到部门、角色等信息
+	user := SysUser{}
+	user.UserName = getUserById(userId).UserName
+	if user.UserName == "" || user.GetUser() != nil || user.TotpEnable != 1 {
+		return nil
+	}
+	return &user
+}
+
+// 动态验证码校验通过后，删除临时令牌
+func DelMfaChallenge(challenge string) {
+	config.Cache.Del(config.MfaChallenge + challenge)
+}
+
+// 获取当前用户的双因素认证状态
+func GetMfaStatus(token string) MfaStatus {
+	user := getUserById(*GetLoginId(token))
+	safe := SysSafe{}
+	safe.GetById()
+	status := MfaStatus{Enable: user.TotpEnable == 1, Mandatory: user.MfaMandatory(safe)}
+	config.DB.Table(SysRecoveryCode{}.TableName()).Where("user_id = ?", user.Id).Count(&status.RecoveryCount)
+	return status
+}
+
+// 生成新的密钥，返回二维码，需要调用 EnableMfa 校验动态验证码后才会生效
+func SetupMfa(token string) (*MfaSetup, error) {
+	if err := CheckMfaKey(); err != nil {
+		return nil, err
+	}
+	user := getUserById(*GetLoginId(token))
+	if user.Id == "" {
+		return nil, config.ErrNotFound.With(i18n.M("field.user"))
+	}
+	if user.TotpEnable == 1 {
+		return nil, config.ErrFailed.WithMessage("error.mfaEnabled", "已开启双因素认证，请先关闭")
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: config.MfaIssuer, AccountName: user.UserName})
+	if err != nil {
+		return nil, config.ErrUnknown.WithMessage("error.mfaSecret", "密钥生成失败")
+	}
+	// 还没有确认的密钥也加密后再缓存
+	sealed, err := sealTotpSecret(user.Id, key.Secret())
+	if err != nil {
+		return nil, config.ErrUnknown.WithMessage("error.mfaSecret", "密钥生成失败")
+	}
+	if err = config.Cache.Set(config.MfaSetup+user.Id, sealed, 10*time.Minute); err != nil {
+		return nil, config.ErrUnknown.WithMessage("error.mfaSecret", "密钥生成失败")
+	}
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return nil, config.ErrUnknown.WithMessage("error.mfaQrCode", "二维码生成失败")
+	}
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, img); err != nil {
+		return nil, config.ErrUnknown.WithMessage("error.mfaQrCode", "二维码生成失败")
+	}
+	return &MfaSetup{
+		Secret: key.Secret(),
+		Uri:    key.URL(),
+		QrCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// 校验动态验证码，开启双因素认证，返回恢复码（只返回这一次）
+func EnableMfa(token, code string) ([]string, error) {
+	if err := CheckMfaKey(); err != nil {
+		return nil, err
+	}
+	user := getUserById(*GetLoginId(token))
+	sealed, err := config.Cache.Get(config.MfaSetup + user.Id)
+	if err != nil {
+		return nil, config.ErrFailed.WithMessage("error.mfaSetupExpired", "密钥已过期，请重新绑定")
+	}
+	secret, err := openTotpSecret(user.Id, sealed)
+	if err != nil {
+		return nil, config.ErrFailed.WithMessage("error.mfaSetupExpired", "密钥已过期，请重新绑定")
+	}
+	if !validateTotp(user.Id, secret, strings.TrimSpace(code)) {
+		return nil, config.ErrMfaCode
+	}
+	updates := map[string]any{"totp_secret": sealed, "totp_enable": 1}
+	if err = config.DB.Table(user.TableName()).Where("id = ?", user.Id).Updates(updates).Error; err != nil {
+		return nil, config.ErrUnknown.WithMessage("error.mfaEnable", "开启失败")
+	}
+	config.Cache.Del(config.MfaSetup + user.Id)
+	// 必须开启双因素认证的会话，绑定后解除限制
+	if GetRestrict(token) == RestrictMfaEnroll {
+		ClearRestrict(token)
+	}
+	return newRecoveryCodes(user.Id)
+}
+
+// 获取当前登录用户（包含双因素认证密钥），用于关闭双因素认证等需要校验动态验证码的操作
+func GetMfaUser(token string) (*SysUser, error) {
+	user := getUserById(*GetLoginId(token))
+	if user.Id == "" {
+		return nil, config.ErrNotFound.With(i18n.M("field.user"))
+	}
+	return user, nil
+}
+
+// 是否可以关闭双因素认证，当前角色必须开启的不能关闭
+func (e *SysUser) CheckDisableMfa(safe SysSafe) error {
+	if e.MfaMandatory(safe) {
+		return config.ErrFailed.WithMessage("error.mfaMandatory", "当前角色必须开启双因素认证，不能关闭")
+	}
+	return nil
+}
+
+// 关闭双因素认证，调用前需要校验动态验证码或恢复码
+func (e *SysUser) DisableMfa() error {
+	return clearMfa(e.Id)
+}
+
+// 重新生成恢复码，旧的恢复码全部失效，调用前需要校验动态验证码或恢复码
+func (e *SysUser) RegenerateRecoveryCodes() ([]string, error) {
+	return newRecoveryCodes(e.Id)
+}
+
+// 管理员重置用户的双因素认证（如丢失了手机），用户的登录会话全部失效
+func ResetMfa(token, userId string) error {
+	user := getUserById(userId)
+	if user.Id == "" || !CheckDataScope(token, user.DeptId, false, true) {
+		return config.ErrForbidden
+	}
+	if err := clearMfa(user.Id); err != nil {
+		return err
+	}
+	return revokeUserSessions(user.Id)
+}
+
+func clearMfa(userId string) error {
+	updates := map[string]any{"totp_secret": "", "totp_enable": 0}
+	if err := config.DB.Table(SysUserView{}.TableName()).Where("id = ?", userId).Updates(updates).Error; err != nil {
+		return config.ErrUnknown.WithMessage("error.mfaDisable", "关闭失败")
+	}
+	config.DB.Table(SysRecoveryCode{}.TableName()).Where("user_id = ?", userId).Delete(&SysRecoveryCode{})
+	return nil
+}
+
+// 加密TOTP密钥，附加数据为用户id，密文复制给其他用户也不能使用
+func sealTotpSecret(userId, secret string) (string, error) {
+	sealed, err := utils.AESGCMEncrypt(secret, config.MfaKey, userId)
+	if err != nil {
+		return "", err
+	}
+	return totpSealed + sealed, nil
+}
+
+// 解密TOTP密钥，不是加密格式的一律视为错误（不接受明文密钥）
+func openTotpSecret(userId, stored string) (string, error) {
+	if !strings.HasPrefix(stored, totpSealed) {
+		return "", errors.New("totp secret is not sealed")
+	}
+	secret, _, err := utils.AESGCMDecrypt(strings.TrimPrefix(stored, totpSealed), config.MfaKey, userId)
+	return secret, err
+}
+
+// 校验动态验证码，允许前后各一个时间窗口的误差，同一个验证码只能使用一次
+func validateTotp(userId, secret, code string) bool {
+	if secret == "" {
+		return false
+	}
+	ok, err := totp.ValidateCustom(code, secret, time.Now(), totp.ValidateOpts{
+		Period:    30,
+		Skew:      1,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil || !ok {
+		return false
+	}
+	set, err := config.Cache.SetNX(config.MfaUsed+userId+":"+code, "1", 90*time.Second)
+	return err == nil && set
+}
+
+// 生成新的恢复码，删除旧的恢复码，返回明文
+func newRecoveryCodes(userId string) ([]string, error) {
+	codes := make([]string, 0, config.MfaRecoveryNum)
+	list := make([]SysRecoveryCode, 0, config.MfaRecoveryNum)
+	for i := 0; i < config.MfaRecoveryNum; i++ {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, config.ErrUnknown.WithMessage("error.mfaRecovery", "恢复码生成失败")
+		}
+		encrypted, err := utils.GetEncryptedPassword(code)
+		if err != nil {
+			return nil, config.ErrUnknown.WithMessage("error.mfaRecovery", "恢复码生成失败")
+		}
+		// 展示为 XXXXX-XXXXX 格式，保存时不带分隔符
+		codes = append(codes, code[:5]+"-"+code[5:])
+		list = append(list, SysRecoveryCode{
+			Id:         strings.ReplaceAll(uuid.NewString(), "-", ""),
+			UserId:     userId,
+			Prefix:     code[:recoveryPrefixLen],
+			Code:       encrypted,
+			CreateTime: time.Now(),
+		})
+	}
+	config.DB.Table(SysRecoveryCode{}.TableName()).Where("user_id = ?", userId).Delete(&SysRecoveryCode{})
+	if err := config.DB.Table(SysRecoveryCode{}.TableName()).Create(&list).Error; err != nil {
+		return nil, config.ErrUnknown.WithMessage("error.mfaRecovery", "恢复码生成失败")
+	}
+	return codes, nil
+}
+
+// 使用恢复码，匹配成功后删除
+func useRecoveryCode(userId, code string) bool {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLength {
+		return false
+	}
+	var list []SysRecoveryCode
+	config.DB.Table(SysRecoveryCode{}.TableName()).Where("user_id = ? AND prefix = ?", userId, code[:recoveryPrefixLen]).Find(&list)
+	for _, item := range list {
+		if utils.AuthenticatePassword(code, item.Code) {
+			// 删除成功的才算使用成功，防止并发重复使用
+			result := config.DB.Table(SysRecoveryCode{}.TableName()).Where("id = ?", item.Id).Delete(&SysRecoveryCode{})
+			return result.RowsAffected > 0
+		}
+	}
+	return false
+}
+
+// 去掉恢复码中的分隔符和空白并转为大写，输入时不区分大小写，可以不带横线
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, code)
+}
+
+// 生成恢复码（不含分隔符）
+func randomRecoveryCode() (string, error) {
+	buf := make([]byte, recoveryCodeLength)
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(config.RandomCaptcha))))
+		if err != nil {
+			return "", err
+		}
+		buf[i] = config.RandomCaptcha[n.Int64()]
+	}
+	return string(buf), nil
+}
+
+// 根据id查询用户（包含密码、密钥等字段，不要直接返回给前端）
+func getUserById(id string) *SysUser {
+	user := SysUser{}
+	if id != "" {
+		config.DB.Table(user.TableName()).Where("id = ?", id).Find(&user)
+	}
+	return &user
+}
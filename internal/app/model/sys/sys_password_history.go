@@ -0,0 +1,61 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/utils"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// 用户历史密码，对应数据库的 sys_password_history 表，用于限制重复使用最近的密码
+type SysPasswordHistory struct {
+	Id         string    `json:"id"`
+	UserId     string    `json:"userId"`
+	Password   string    `json:"-"` // bcrypt加密后的密码
+	CreateTime time.Time `json:"createTime"`
+}
+
+// 获取表名
+func (SysPasswordHistory) TableName() string {
+	return "sys_password_history"
+}
+
+// 明文密码是否是用户当前或最近 n 次使用过的密码，n 为0时不限制
+func usedPassword(user SysUser, plaintext string, n int) bool {
+	if n <= 0 {
+		return false
+	}
+	if user.Password != "" && utils.AuthenticatePassword(plaintext, user.Password) {
+		return true
+	}
+	var list []SysPasswordHistory
+	config.DB.Table(SysPasswordHistory{}.TableName()).Where("user_id = ?", user.Id).
+		Order("create_time desc").Limit(n).Find(&list)
+	for _, history := range list {
+		if utils.AuthenticatePassword(plaintext, history.Password) {
+			return true
+		}
+	}
+	return false
+}
+
+// 记录用户的新密码（加密后的），只保留最近 n 次，n 为0时不记录
+func savePasswordHistory(userId, encrypted string, n int) {
+	if n <= 0 {
+		return
+	}
+	config.DB.Table(SysPasswordHistory{}.TableName()).Create(&SysPasswordHistory{
+		Id:         strings.ReplaceAll(uuid.NewString(), "-", ""),
+		UserId:     userId,
+		Password:   encrypted,
+		CreateTime: time.Now(),
+	})
+	// 删除超出保留次数的历史密码
+	var ids []string
+	config.DB.Table(SysPasswordHistory{}.TableName()).Where("user_id = ?", userId).
+		Order("create_time desc").Pluck("id", &ids)
+	if len(ids) > n {
+		config.DB.Table(SysPasswordHistory{}.TableName()).Where("id in (?)", ids[n:]).Delete(&SysPasswordHistory{})
+	}
+}
@@ -2,9 +2,9 @@ package sys
 
 import (
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/pkg/errors"
 	"strings"
 	"time"
 )
@@ -29,7 +29,7 @@ func (SysRole) TableName() string {
 func (e *SysRole) GetPage(pageSize int, pageNum int) config.PageInfo {
 	var list []SysRole // 查询结果
 	var total int64    // 总数
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	if e.RoleName != "" {
 		query.Where("role_name like ?", fmt.Sprintf("%%%s%%", e.RoleName))
 	}
@@ -39,29 +39,29 @@ func (e *SysRole) GetPage(pageSize int, pageNum int) config.PageInfo {
 	offset := (pageNum - 1) * pageSize                                                 // 计算跳过的记录数
 	query.Debug().Order("create_time desc").Offset(offset).Limit(pageSize).Find(&list) // 分页查询，根据offset和limit来查询
 	query.Count(&total)
-	return config.PageInfo{list, total}
+	return config.PageInfo{List: list, Total: total}
 }
 
 // 详情
 func (e *SysRole) GetById() {
-	config.DB.Table(e.TableName()).Where("id = ?", e.Id).Find(e)
+	e.DB().Table(e.TableName()).Where("id = ?", e.Id).Find(e)
 }
 
 // 新增
 func (e *SysRole) Insert() (err error) {
 	// 校验角色名称和角色代码
 	if checkRoleNameAndKey(e.RoleName, "", "") {
-		err = errors.New("角色名称已存在！")
+		err = config.ErrExists.With(i18n.M("field.roleName"))
 		return
 	}
 	if checkRoleNameAndKey("", e.RoleKey, "") {
-		err = errors.New("角色代码已存在！")
+		err = config.ErrExists.With(i18n.M("field.roleKey"))
 		return
 	}
 	e.Id = strings.ReplaceAll(uuid.NewString(), "-", "")
 	e.CreatorId = GetLoginId(e.Token)
 	e.CreateTime = time.Now()
-	config.DB.Table(e.TableName()).Create(e)
+	e.DB().Table(e.TableName()).Create(e)
 	// 保存菜单树
 	roleMenu := SysRoleMenu{RoleId: e.Id}
 	roleMenu.Insert(e.MenuIds)
@@ -72,14 +72,14 @@ func (e *SysRole) Insert() (err error) {
 func (e *SysRole) Update() (err error) {
 	// 校验角色名称和角色代码
 	if checkRoleNameAndKey(e.RoleName, "", e.Id) {
-		err = errors.New("角色名称已存在！")
+		err = config.ErrExists.With(i18n.M("field.roleName"))
 		return
 	}
 	if checkRoleNameAndKey("", e.RoleKey, e.Id) {
-		err = errors.New("角色代码已存在！")
+		err = config.ErrExists.With(i18n.M("field.roleKey"))
 		return
 	}
-	config.DB.Model(&SysRole{}).Select("role_key", "role_name", "is_open", "state", "remark").Where("id = ?", e.Id).Save(e)
+	e.DB().Model(&SysRole{}).Select("role_key", "role_name", "is_open", "state", "remark").Where("id = ?", e.Id).Save(e)
 	// 保存菜单树
 	roleMenu := SysRoleMenu{RoleId: e.Id}
 	roleMenu.Insert(e.MenuIds)
@@ -88,7 +88,7 @@ func (e *SysRole) Update() (err error) {
 
 // 修改状态
 func (e *SysRole) UpdateState() (err error) {
-	config.DB.Model(&SysRole{}).Select("state").Where("id = ?", e.Id).Save(e)
+	e.DB().Model(&SysRole{}).Select("state").Where("id = ?", e.Id).Save(e)
 	return
 }
 
@@ -99,11 +99,11 @@ func (e *SysRole) Delete(ids []string) (err error) {
 		e.GetById()
 		// 首先查询角色是否已分配用户
 		if CheckRoleExistUser(id) {
-			err = errors.New(fmt.Sprintf("%s角色已分配，不允许删除", e.RoleName))
+			err = config.ErrInUse.With(i18n.M("inUse.roleAssigned", e.RoleName))
 			return
 		}
 	}
-	if err = config.DB.Table(e.TableName()).Delete(&SysRole{}, ids).Error; err != nil {
+	if err = e.DB().Table(e.TableName()).Delete(&SysRole{}, ids).Error; err != nil {
 		return
 	}
 	// 删除角色同时删除角色菜单关联
@@ -116,7 +116,7 @@ func (e *SysRole) Delete(ids []string) (err error) {
 // 角色下拉列表
 func (e *SysRole) GetSelectList() []SysRole {
 	var list []SysRole // 查询结果
-	config.DB.Table(e.TableName()).Find(&list)
+	e.DB().Table(e.TableName()).Find(&list)
 	return list
 }
 
@@ -2,16 +2,29 @@ package sys
 
 import (
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
+	"fiber-web-api/internal/app/common/lockout"
+	"fiber-web-api/internal/app/common/password"
 	"github.com/google/uuid"
 	"strings"
+	"time"
 )
 
 // 安全中心
 type SysSafe struct {
 	config.BaseModel
-	PwdCycle        int `json:"pwdCycle" form:"pwdCycle"`               // 密码更改周期（90天，60天，30天，0无）
-	PwdLoginLimit   int `json:"pwdLoginLimit" form:"pwdLoginLimit"`     // 密码登录限制（0：连续错3次，锁定账号15分钟。1：连续错5次，锁定账号30分钟）
-	IdleTimeSetting int `json:"idleTimeSetting" form:"idleTimeSetting"` // 闲置时间设置（0：无。1：空闲30分钟，系统默认用户退出）
+	PwdCycle        int    `json:"pwdCycle" form:"pwdCycle"`               // 密码更改周期（90天，60天，30天，0无）
+	PwdLoginLimit   int    `json:"pwdLoginLimit" form:"pwdLoginLimit"`     // 密码登录限制（0：连续错3次，锁定账号15分钟。1：连续错5次，锁定账号30分钟）
+	IdleTimeSetting int    `json:"idleTimeSetting" form:"idleTimeSetting"` // 闲置时间设置（0：无。1：空闲30分钟，系统默认用户退出）
+	PwdMinLength    int    `json:"pwdMinLength" form:"pwdMinLength"`       // 密码最小长度（0：不限制）
+	PwdCharClass    string `json:"pwdCharClass" form:"pwdCharClass"`       // 密码必须包含的字符类型，逗号分隔（upper,lower,digit,special）
+	PwdNoUserInfo   int    `json:"pwdNoUserInfo" form:"pwdNoUserInfo"`     // 密码不能包含用户名、真实姓名（0：否。1：是）
+	PwdNoCommon     int    `json:"pwdNoCommon" form:"pwdNoCommon"`         // 密码不能是常见弱密码（0：否。1：是）
+	PwdHistory      int    `json:"pwdHistory" form:"pwdHistory"`           // 最近几次使用过的密码不能再次使用（0：不限制）
+	MfaMandatory    int    `json:"mfaMandatory" form:"mfaMandatory"`       // 是否强制开启双因素认证（0：否。1：是）
+	MfaRoleIds      string `json:"mfaRoleIds" form:"mfaRoleIds"`           // 强制开启双因素认证的角色id，逗号分隔，为空时所有用户都必须开启
+	CaptchaPolicy   int    `json:"captchaPolicy" form:"captchaPolicy"`     // 登录验证码（0：不需要。1：每次都需要。2：IP或账号登录失败达到指定次数后需要）
+	CaptchaErrorNum int    `json:"captchaErrorNum" form:"captchaErrorNum"` // 登录失败多少次后需要验证码（验证码策略为2时生效）
 }
 
 // 获取表名
@@ -21,7 +34,7 @@ func (SysSafe) TableName() string {
 
 // 详情
 func (e *SysSafe) GetById() (err error) {
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	if err = query.First(e).Error; err != nil {
 		return
 	}
@@ -30,13 +43,18 @@ func (e *SysSafe) GetById() (err error) {
 
 // 修改
 func (e *SysSafe) Update() (err error) {
+	if e.PwdMinLength < 0 || e.PwdHistory < 0 || e.CaptchaPolicy < 0 || e.CaptchaPolicy > 2 || e.CaptchaErrorNum < 0 {
+		err = config.ErrParam
+		return
+	}
+	e.PwdCharClass = strings.Join(password.ParseClasses(e.PwdCharClass), ",")
 	if e.Id == "" {
 		e.Id = strings.ReplaceAll(uuid.NewString(), "-", "")
 		e.CreatorId = GetLoginId(e.Token)
-		config.DB.Create(e)
+		e.DB().Create(e)
 	} else {
 		// 使用Save方法进行更新，标识零值也需要进行更新。Select是指定需要更新哪些字段
-		config.DB.Model(&SysSafe{}).Select("pwd_cycle", "pwd_login_limit", "idle_time_setting").Where("id = ?", e.Id).Save(e)
+		e.DB().Model(&SysSafe{}).Select("pwd_cycle", "pwd_login_limit", "idle_time_setting", "pwd_min_length", "pwd_char_class", "pwd_no_user_info", "pwd_no_common", "pwd_history", "mfa_mandatory", "mfa_role_ids", "captcha_policy", "captcha_error_num").Where("id = ?", e.Id).Save(e)
 		expire := GetTimeOut(e.Token)
 		i := e.IdleTimeSetting
 		//修改token的过期时间
@@ -48,3 +66,43 @@ func (e *SysSafe) Update() (err error) {
 	}
 	return
 }
+
+// 按照安全中心的密码策略校验用户的新密码，没有通过时返回所有没有通过的规则
+func (e *SysSafe) CheckPassword(user SysUser, plaintext string) (err error) {
+	fails := e.policy(user).Check(plaintext)
+	if user.Id != "" && usedPassword(user, plaintext, e.PwdHistory) {
+		fails = append(fails, i18n.M("password.history", e.PwdHistory))
+	}
+	if len(fails) > 0 {
+		err = config.ErrPwdPolicy.With(fails)
+	}
+	return
+}
+
+// 按照安全中心的密码策略生成随机的一次性密码
+func (e *SysSafe) GeneratePassword(user SysUser) (string, error) {
+	return e.policy(user).Generate()
+}
+
+func (e *SysSafe) policy(user SysUser) password.Policy {
+	return password.Policy{
+		MinLength:  e.PwdMinLength,
+		Classes:    password.ParseClasses(e.PwdCharClass),
+		NoUserInfo: e.PwdNoUserInfo == 1,
+		NoCommon:   e.PwdNoCommon == 1,
+		UserName:   user.UserName,
+		RealName:   user.RealName,
+	}
+}
+
+// 登录失败锁定规则（0：连续错3次，锁定账号15分钟。1：连续错5次，锁定账号30分钟），再次锁定时锁定时长翻倍，最长24小时。
+// 同一个IP允许的失败次数是账号的4倍，避免同一出口IP下的多个用户互相影响
+func (e *SysSafe) LockoutPolicy() (user, ip lockout.Policy) {
+	user = lockout.Policy{MaxAttempts: 3, LockDuration: 15 * time.Minute, MaxDuration: 24 * time.Hour, Window: 24 * time.Hour}
+	if e.PwdLoginLimit == 1 {
+		user.MaxAttempts, user.LockDuration = 5, 30*time.Minute
+	}
+	ip = user
+	ip.MaxAttempts = user.MaxAttempts * 4
+	return
+}
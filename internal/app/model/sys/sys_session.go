@@ -0,0 +1,118 @@
+package sys
+
+import (
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
+	"sort"
+)
+
+// ======================================= 会话管理 =======================================
+
+// 会话信息，用于展示给前端（不包含token）
+type SessionView struct {
+	Id         string `json:"id"`         // 会话编号
+	LoginType  string `json:"loginType"`  // 登录类型
+	IP         string `json:"ip"`         // 登录IP
+	UserAgent  string `json:"userAgent"`  // 登录设备
+	CreateTime int64  `json:"createTime"` // 登录时间（秒级时间戳）
+	Current    bool   `json:"current"`    // 是否是当前会话
+}
+
+// 登录前按会话策略注销多余的会话：single 注销全部，max 注销最早登录的直到留出一个位置
+func (user *SysUser) applySessionPolicy() {
+	if config.SessionPolicy == config.SessionUnlimited {
+		return
+	}
+	sessions, err := config.Sessions.ListByUser(user.Id)
+	if err != nil {
+		return
+	}
+	keep := 0
+	if config.SessionPolicy == config.SessionMax {
+		keep = config.SessionLimit - 1
+	}
+	if len(sessions) <= keep {
+		return
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreateTime < sessions[j].CreateTime
+	})
+	for _, s := range sessions[:len(sessions)-keep] {
+		revokeSessions(s.Token)
+	}
+}
+
+// 当前用户的会话列表，按登录时间倒序
+func GetSessions(token string) []SessionView {
+	current := sessionId(token)
+	sessions, _ := config.Sessions.ListByUser(*GetLoginId(token))
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreateTime > sessions[j].CreateTime
+	})
+	list := []SessionView{}
+	for _, s := range sessions {
+		list = append(list, SessionView{
+			Id:         s.Id,
+			LoginType:  s.LoginType,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreateTime: s.CreateTime,
+			Current:    s.Token == current,
+		})
+	}
+	return list
+}
+
+// 注销当前用户的某个会话
+func RevokeSession(token, id string) (err error) {
+	sessions, _ := config.Sessions.ListByUser(*GetLoginId(token))
+	for _, s := range sessions {
+		if s.Id == id {
+			return revokeSessions(s.Token)
+		}
+	}
+	return config.ErrNotFound.With(i18n.M("field.session"))
+}
+
+// 注销当前用户的所有会话（包括当前会话）
+func RevokeAllSessions(token string) error {
+	return revokeUserSessions(*GetLoginId(token))
+}
+
+// 强制用户下线，只能操作当前用户数据范围内的用户
+func ForceLogout(token, userId string) (err error) {
+	var user SysUser
+	config.DB.Table(user.TableName()).Where("id = ?", userId).Find(&user)
+	if user.Id == "" {
+		err = config.ErrNotFound.With(i18n.M("field.user"))
+		return
+	}
+	if !CheckDataScope(token, user.DeptId, false, true) {
+		err = config.ErrForbidden
+		return
+	}
+	return revokeUserSessions(userId)
+}
+
+// 注销会话，jwt模式下同时加入注销列表，令牌所属的会话注销后访问令牌立即失效
+func revokeSessions(tokens ...string) error {
+	if config.TokenMode == config.TokenModeJwt {
+		for _, sid := range tokens {
+			config.Revocations.Revoke(sid, config.Tokens.Expire)
+		}
+	}
+	return config.Sessions.Revoke(tokens...)
+}
+
+// 注销用户的所有会话
+func revokeUserSessions(userId string) error {
+	sessions, err := config.Sessions.ListByUser(userId)
+	if err != nil {
+		return err
+	}
+	tokens := make([]string, 0, len(sessions))
+	for _, s := range sessions {
+		tokens = append(tokens, s.Token)
+	}
+	return revokeSessions(tokens...)
+}
@@ -0,0 +1,118 @@
+package sys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/store"
+	"fiber-web-api/internal/app/common/token"
+	"fiber-web-api/internal/app/common/utils"
+	"strings"
+)
+
+// ======================================= jwt令牌相关 =======================================
+
+// jwt模式下登录、刷新返回的令牌
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`  // 访问令牌，放在请求头中
+	RefreshToken string `json:"refreshToken"` // 刷新令牌，只能使用一次，使用后返回新的刷新令牌
+	ExpiresIn    int64  `json:"expiresIn"`    // 访问令牌有效期（秒）
+}
+
+// jwt模式登录：新建会话（会话的有效期就是刷新令牌的有效期），签发访问令牌和刷新令牌
+func (user *SysUser) IssueToken(opt LoginOption) (*TokenPair, error) {
+	user.applySessionPolicy()
+	secret := utils.GenerateRandomToken(32)
+	sid := user.createSession(opt, utils.SHA256(secret))
+	return signToken(user, sid, secret, opt.Restrict)
+}
+
+// 使用刷新令牌换取新的令牌，刷新令牌格式为 会话id.随机串
+// 已经使用过的刷新令牌再次使用时，说明令牌可能被盗用，直接注销整个会话
+func RefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	index := strings.LastIndex(refreshToken, ".")
+	if index <= 0 {
+		return nil, config.ErrNotLogin
+	}
+	sid, secret := refreshToken[:index], refreshToken[index+1:]
+	session, err := config.Sessions.Get(sid)
+	if err != nil {
+		return nil, config.ErrNotLogin
+	}
+	next := utils.GenerateRandomToken(32)
+	err = config.Sessions.Rotate(sid, utils.SHA256(secret), utils.SHA256(next))
+	if errors.Is(err, store.ErrRefreshReused) {
+		log.WarnContext(ctx, "刷新令牌被重复使用，注销会话", "sessionId", sid)
+		revokeSessions(sid)
+		return nil, config.ErrNotLogin.WithMessage("error.sessionAbnormal", "登录状态异常，请重新登录")
+	}
+	if err != nil {
+		return nil, config.ErrNotLogin
+	}
+	config.Sessions.Touch(sid, session.Expire) // 刷新会话有效期
+	user := SysUser{}
+	json.Unmarshal([]byte(session.User), &user)
+	user.Ctx = ctx
+	pair, err := signToken(&user, sid, next, session.Restrict)
+	if err != nil {
+		return nil, config.ErrUnknown
+	}
+	return pair, nil
+}
+
+// 签发访问令牌，组装返回的令牌
+func signToken(user *SysUser, sid, secret, restrict string) (*TokenPair, error) {
+	claims := token.Claims{
+		Sid:      sid,
+		Restrict: restrict,
+		UserName: user.UserName,
+		RealName: user.RealName,
+		DeptId:   user.DeptId,
+		DeptName: user.DeptName,
+		RoleId:   user.RoleId,
+		RoleKey:  user.RoleKey,
+		RoleName: user.RoleName,
+		Locale:   user.Locale,
+	}
+	claims.Subject = user.Id
+	if user.Picture != nil {
+		claims.Picture = *user.Picture
+	}
+	accessToken, err := config.Tokens.Sign(claims)
+	if err != nil {
+		log.ErrorContext(user.Ctx, "签发访问令牌失败", "err", err)
+		return nil, err
+	}
+	return &TokenPair{accessToken, sid + "." + secret, int64(config.Tokens.Expire.Seconds())}, nil
+}
+
+// 根据访问令牌中的信息还原登录用户
+func claimsUser(claims *token.Claims) SysUser {
+	user := SysUser{}
+	user.Id = claims.Subject
+	user.UserName = claims.UserName
+	user.RealName = claims.RealName
+	user.DeptId = claims.DeptId
+	user.DeptName = claims.DeptName
+	user.RoleId = claims.RoleId
+	user.RoleKey = claims.RoleKey
+	user.RoleName = claims.RoleName
+	user.Locale = claims.Locale
+	if claims.Picture != "" {
+		user.Picture = &claims.Picture
+	}
+	return user
+}
+
+// 获取token对应的会话id，jwt模式下从访问令牌中取
+func sessionId(tokenString string) string {
+	if config.TokenMode != config.TokenModeJwt {
+		return tokenString
+	}
+	claims, err := config.Tokens.Parse(tokenString)
+	if err != nil {
+		return ""
+	}
+	return claims.Sid
+}
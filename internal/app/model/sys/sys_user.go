@@ -1,8 +1,12 @@
 package sys
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/i18n"
+	"fiber-web-api/internal/app/common/rsakey"
 	"fiber-web-api/internal/app/common/utils"
 	"fmt"
 	"github.com/google/uuid"
@@ -14,7 +18,13 @@ import (
 type SysUser struct {
 	config.BaseModel // 嵌套公共的model，这样就可以使用 BaseModel 的字段了
 	SysUserView
-	Password string `gorm:"password" json:"password" form:"password"` // 加密密码
+	Password           string     `gorm:"password" json:"password" form:"password"` // 加密密码
+	PasswordUpdateTime *time.Time `json:"passwordUpdateTime" form:"-"`              // 密码最后修改时间
+	PwdMustChange      int        `json:"pwdMustChange" form:"-"`                   // 登录后必须修改密码（1 是 0 否），新增用户和重置密码后为1
+	TotpEnable         int        `json:"totpEnable" form:"-"`                      // 是否开启双因素认证（1 是 0 否）
+	TotpSecret         string     `json:"-" form:"-"`                               // 动态验证码（TOTP）密钥，用 mfa.key 加密保存
+	Locale             string     `json:"locale" form:"-"`                          // 语言偏好（zh-CN、en-US），为空时按请求头 Accept-Language 选择
+	Encryption
 }
 
 // 用户信息model，用于展示给前端
@@ -41,11 +51,35 @@ type Password struct {
 	config.BaseModel        // 嵌套公共的model，这样就可以使用 BaseModel 的字段了
 	OldPassword      string `json:"oldPassword" form:"oldPassword"` // 旧密码
 	NewPassword      string `json:"newPassword" form:"newPassword"` // 新密码
+	Encryption
+}
+
+// 前端用公钥加密了敏感字段（密码、手机号码）时的标记
+type Encryption struct {
+	Encrypted bool   `gorm:"-" json:"encrypted,omitempty" form:"encrypted"` // 是否加密
+	KeyId     string `gorm:"-" json:"keyId,omitempty" form:"keyId"`         // 加密使用的公钥id
+}
+
+// 标记了加密的，用私钥解密字段
+func (e Encryption) decrypt(ctx context.Context, fields ...*string) error {
+	if !e.Encrypted {
+		return nil
+	}
+	if err := utils.RSADecryptFields(ctx, e.KeyId, fields...); err != nil {
+		if errors.Is(err, rsakey.ErrKeyNotFound) {
+			return config.ErrKeyExpired.Wrap(err)
+		}
+		return config.ErrDecrypt.Wrap(err)
+	}
+	return nil
 }
 
 // 新增、更新用户信息时，要忽略的字段
 var omit = "dept_name,ancestor_id,ancestor_name,child_id,child_name,role_key,role_name"
 
+// 更新用户信息时，密码、双因素认证相关的字段只能通过对应的接口来修改
+var omitPassword = omit + ",password,password_update_time,pwd_must_change,totp_enable,totp_secret"
+
 // 获取用户管理的表名
 func (SysUserView) TableName() string {
 	return "sys_user"
@@ -55,7 +89,7 @@ func (SysUserView) TableName() string {
 func (e *SysUserView) GetPage(pageSize int, pageNum int) config.PageInfo {
 	var list []SysUserView // 查询结果
 	var total int64        // 总数
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	if e.UserName != "" {
 		query.Where("user_name like ?", fmt.Sprintf("%%%s%%", e.UserName))
 	}
@@ -79,12 +113,12 @@ func (e *SysUserView) GetPage(pageSize int, pageNum int) config.PageInfo {
 		Joins("left join sys_role c on c.id = sys_user.role_id").
 		Offset(offset).Limit(pageSize).Find(&list) // 分页查询，根据offset和limit来查询
 	query.Count(&total) // 查询总数用Count，注意查总数不能直接连在Find()后面，需要分开来单独一句才能正确查询到总数。
-	return config.PageInfo{list, total}
+	return config.PageInfo{List: list, Total: total}
 }
 
 // 详情
 func (e *SysUser) GetUser() (err error) {
-	query := config.DB.Table(e.TableName())
+	query := e.DB().Table(e.TableName())
 	sql := `
 		SELECT a.*,b.name dept_name,role_key,role_name
 		FROM sys_user a
@@ -109,40 +143,64 @@ func (e *SysUser) GetUser() (err error) {
 		return
 	}
 	if e.Id == "" || e.UserName == "" {
-		err = errors.New("没有查看权限！")
+		err = config.ErrForbidden
 		return
 	}
 	return
 }
 
-// 新增
-func (e *SysUser) Insert() (err error) {
+// 新增，没有设置密码时生成随机的一次性密码并返回（只返回这一次），用户登录后必须修改密码
+func (e *SysUser) Insert() (oneTime string, err error) {
 	// 校验新增的用户和当前用户是否是同一部门或子部门
 	if !CheckDataScope(e.Token, e.DeptId, false, true) {
-		err = errors.New("没有操作权限！")
+		err = config.ErrForbidden
 		return
 	}
 	// 校验用户名和手机号码
 	var count int64
-	db := config.DB.Table(e.TableName())
+	db := e.DB().Table(e.TableName())
 	db.Where("user_name = ?", e.UserName).Count(&count)
 	if count > 0 {
-		err = errors.New("用户名称已存在！")
+		err = config.ErrExists.With(i18n.M("field.userName"))
+		return
+	}
+	// 手机号码、密码私钥解密
+	if err = e.decrypt(e.Ctx, e.Phone, &e.Password); err != nil {
 		return
 	}
 	if e.Phone != nil {
-		//phone := utils.RSADecrypt(*e.Phone);   // 手机号码私钥解密
-		//e.Phone = &phone
 		db.Where("phone = ?", e.Phone).Count(&count)
 		if count > 0 {
-			err = errors.New("手机号码已存在！")
+			err = config.ErrExists.With(i18n.M("field.phone"))
+			return
+		}
+	}
+	// 没有设置密码时生成一次性密码，设置了的密码需要符合安全策略
+	safe := SysSafe{}
+	safe.GetById()
+	if e.Password == "" {
+		if oneTime, err = safe.GeneratePassword(*e); err != nil {
+			err = config.ErrUnknown.WithMessage("error.pwdGenerate", "密码生成失败")
 			return
 		}
+		e.Password = oneTime
+	} else if err = safe.CheckPassword(*e, e.Password); err != nil {
+		return
+	}
+	if e.Password, err = utils.GetEncryptedPassword(e.Password); err != nil {
+		oneTime, err = "", config.ErrUnknown.WithMessage("error.pwdEncrypt", "密码加密失败")
+		return
 	}
+	e.PasswordUpdateTime = nil
+	e.PwdMustChange = 1
 	e.Id = strings.ReplaceAll(uuid.NewString(), "-", "")
 	e.CreatorId = GetLoginId(e.Token)
 	e.CreateTime = time.Now()
-	config.DB.Table(e.TableName()).Omit(omit).Create(e)
+	if err = e.DB().Table(e.TableName()).Omit(omit).Create(e).Error; err != nil {
+		oneTime, err = "", config.ErrUnknown.WithMessage("error.userInsert", "新增用户失败").Wrap(err)
+		return
+	}
+	savePasswordHistory(e.Id, e.Password, safe.PwdHistory)
 	return
 }
 
@@ -150,33 +208,35 @@ func (e *SysUser) Insert() (err error) {
 func (e *SysUser) Update() (err error) {
 	// 校验修改的用户和当前用户是否是同一部门或子部门
 	if !CheckDataScope(e.Token, e.DeptId, false, true) {
-		err = errors.New("没有操作权限！")
+		err = config.ErrForbidden
 		return
 	}
 	var byId SysUser
-	config.DB.Table(e.TableName()).Where("id = ?", e.Id).Find(&byId)
+	e.DB().Table(e.TableName()).Where("id = ?", e.Id).Find(&byId)
 	if byId.DeptId != e.DeptId && !CheckDataScope(e.Token, byId.DeptId, false, true) {
-		err = errors.New("没有操作权限！")
+		err = config.ErrForbidden
 		return
 	}
 	// 校验用户名和手机号码
 	var count int64
-	db := config.DB.Table(e.TableName())
+	db := e.DB().Table(e.TableName())
 	db.Where("user_name = ? and id <> ?", e.UserName, e.Id).Count(&count)
 	if count > 0 {
-		err = errors.New("用户名称已存在！")
+		err = config.ErrExists.With(i18n.M("field.userName"))
+		return
+	}
+	// 手机号码私钥解密
+	if err = e.decrypt(e.Ctx, e.Phone); err != nil {
 		return
 	}
 	if e.Phone != nil {
-		//phone := utils.RSADecrypt(*e.Phone);   // 手机号码私钥解密
-		//e.Phone = &phone
 		db.Where("phone = ? and id <> ?", e.Phone, e.Id).Count(&count)
 		if count > 0 {
-			err = errors.New("手机号码已存在！")
+			err = config.ErrExists.With(i18n.M("field.phone"))
 			return
 		}
 	}
-	config.DB.Table(e.TableName()).Omit(omit).Model(&SysUser{}).Where("id = ?", e.Id).Updates(e)
+	e.DB().Table(e.TableName()).Omit(omitPassword).Model(&SysUser{}).Where("id = ?", e.Id).Updates(e)
 	return
 }
 
@@ -186,80 +246,157 @@ func (e *SysUser) Delete(ids []string) (err error) {
 	scope := GetDataScope(e.Token, false, true)
 	if scope != "" {
 		var list []SysUser
-		config.DB.Table(e.TableName()).Where("id in (?)", ids).Find(&list)
+		e.DB().Table(e.TableName()).Where("id in (?)", ids).Find(&list)
 		split := strings.Split(scope, ",")
 		for _, user := range list {
 			if !utils.IsContain(split, user.DeptId) {
-				err = errors.New("没有操作权限！")
+				err = config.ErrForbidden
 				return
 			}
 		}
 	}
-	config.DB.Table(e.TableName()).Delete(&SysUser{}, ids)
+	e.DB().Table(e.TableName()).Delete(&SysUser{}, ids)
 	return
 }
 
 // 修改密码
 func (e *Password) UpdatePassword() (err error) {
 	if e.NewPassword == "" || e.OldPassword == "" || e.Id == "" {
-		err = errors.New("数据解密失败")
+		err = config.ErrParam
+		return
+	}
+	if err = e.decrypt(e.Ctx, &e.OldPassword, &e.NewPassword); err != nil {
+		return
+	}
+	// 受限会话不能修改其他用户的密码
+	if e.Id != *GetLoginId(e.Token) && GetRestrict(e.Token) != "" {
+		err = config.ErrForbidden
 		return
 	}
 	var user SysUser
-	config.DB.Table(user.TableName()).Where("id = ?", e.Id).Find(&user)
+	e.DB().Table(user.TableName()).Where("id = ?", e.Id).Find(&user)
 	if !CheckDataScope(e.Token, user.DeptId, false, true) {
-		err = errors.New("没有操作权限！")
+		err = config.ErrForbidden
 		return
 	}
 	if e.NewPassword == e.OldPassword {
-		err = errors.New("新密码不可于旧密码相同")
+		err = config.ErrFailed.WithMessage("error.pwdSame", "新密码不可于旧密码相同")
 		return
 	}
 	if e.NewPassword == config.InitPassword {
-		err = errors.New("新密码不可于初始密码相同")
+		err = config.ErrFailed.WithMessage("error.pwdInit", "新密码不可于初始密码相同")
 		return
 	}
-	// 正则表达式我去你大爷！！！不校验了，我校验你大爷！！！从别的项目复制过来的正则，为什么你就死活校验不上！！
-	// 同样的正则，我一模一样复制到校验工具去验证都可以匹配上，就你不行，我去你大爷，不校验了，校验你爹！！！
-	/*reg := "^(?=.*?[A-Z])(?=.*?[a-z])(?=.*?[0-9])(?=.*?[_#?!@$%^&*-]).{8,}$"
-	m, _ := regexp.MatchString(reg, e.NewPassword)
-	if !m {
-		err = errors.New("密码长度大于7,且必须由数字、大小写字母、特殊字符组成")
-		return
-	}*/
 	b := utils.AuthenticatePassword(e.OldPassword, user.Password)
 	if !b {
-		err = errors.New("旧密码错误")
+		err = config.ErrFailed.WithMessage("error.oldPassword", "旧密码错误")
+		return
+	}
+	// 按照安全中心的密码策略校验新密码（Go的正则不支持零宽断言，所以不用正则校验）
+	safe := SysSafe{}
+	safe.GetById()
+	if err = safe.CheckPassword(user, e.NewPassword); err != nil {
 		return
 	}
 	newPassword, err := utils.GetEncryptedPassword(e.NewPassword)
-	if err = config.DB.Table(user.TableName()).Where("id = ?", e.Id).Update("password", newPassword).Error; err != nil {
-		err = errors.New("密码修改失败")
+	if err != nil {
+		err = config.ErrUnknown.WithMessage("error.pwdUpdate", "密码修改失败")
+		return
+	}
+	updates := map[string]any{"password": newPassword, "password_update_time": time.Now(), "pwd_must_change": 0}
+	if err = e.DB().Table(user.TableName()).Where("id = ?", e.Id).Updates(updates).Error; err != nil {
+		err = config.ErrUnknown.WithMessage("error.pwdUpdate", "密码修改失败")
 		return
 	}
+	savePasswordHistory(e.Id, newPassword, safe.PwdHistory)
+	// 修改的是自己的密码时，解除当前会话的限制（如密码过期、必须修改密码），还必须绑定身份验证器的改为对应的限制
+	if e.Id == *GetLoginId(e.Token) {
+		if user.TotpEnable != 1 && user.MfaMandatory(safe) {
+			config.Sessions.SetRestrict(sessionId(e.Token), RestrictMfaEnroll)
+		} else {
+			ClearRestrict(e.Token)
+		}
+	}
 	return
 }
 
-// 重置密码为初始密码
-func (e *SysUser) ResetPassword() (err error) {
+// 重置密码，没有指定新密码时生成随机的一次性密码并返回（只返回这一次），用户登录后必须修改密码
+func (e *SysUser) ResetPassword() (oneTime string, err error) {
 	var user SysUser
-	config.DB.Table(e.TableName()).Where("id = ?", e.Id).Find(&user)
-	if !CheckDataScope(e.Token, user.DeptId, false, true) {
-		err = errors.New("没有操作权限！")
+	e.DB().Table(e.TableName()).Where("id = ?", e.Id).Find(&user)
+	if user.Id == "" || !CheckDataScope(e.Token, user.DeptId, false, true) {
+		err = config.ErrForbidden
+		return
+	}
+	// 指定的新密码需要符合安全策略
+	safe := SysSafe{}
+	safe.GetById()
+	if err = e.decrypt(e.Ctx, &e.Password); err != nil {
+		return
+	}
+	plaintext := e.Password
+	if plaintext == "" {
+		if oneTime, err = safe.GeneratePassword(user); err != nil {
+			err = config.ErrUnknown.WithMessage("error.pwdReset", "密码重置失败")
+			return
+		}
+		plaintext = oneTime
+	} else if err = safe.CheckPassword(user, plaintext); err != nil {
+		return
+	}
+	password, err := utils.GetEncryptedPassword(plaintext)
+	if err != nil {
+		oneTime, err = "", config.ErrUnknown.WithMessage("error.pwdReset", "密码重置失败")
 		return
 	}
-	password, err := utils.GetEncryptedPassword(config.InitPassword)
-	if err = config.DB.Table(e.TableName()).Where("id = ?", e.Id).Update("password", password).Error; err != nil {
-		err = errors.New("密码重置失败")
+	updates := map[string]any{"password": password, "password_update_time": time.Now(), "pwd_must_change": 1}
+	if err = e.DB().Table(e.TableName()).Where("id = ?", e.Id).Updates(updates).Error; err != nil {
+		oneTime, err = "", config.ErrUnknown.WithMessage("error.pwdReset", "密码重置失败")
 		return
 	}
+	savePasswordHistory(e.Id, password, safe.PwdHistory)
+	// 重置后旧的登录会话全部失效
+	revokeUserSessions(e.Id)
 	return
 }
 
+// 密码是否已过期：cycle 密码更改周期（天），为0时永不过期。没有修改过密码的，从创建时间开始计算
+func (e *SysUser) PasswordExpired(cycle int) bool {
+	if cycle <= 0 {
+		return false
+	}
+	updateTime := e.CreateTime
+	if e.PasswordUpdateTime != nil {
+		updateTime = *e.PasswordUpdateTime
+	}
+	return time.Now().After(updateTime.AddDate(0, 0, cycle))
+}
+
 // 上传头像
 func (e *SysUser) Upload() {
 	id := GetLoginId(e.Token)
-	config.DB.Table(e.TableName()).Where("id = ?", id).Update("picture", e.Picture)
+	e.DB().Table(e.TableName()).Where("id = ?", id).Update("picture", e.Picture)
+}
+
+// 修改当前用户的语言偏好，为空时清除（按请求头 Accept-Language 选择）
+func (e *SysUser) UpdateLocale() (err error) {
+	if e.Locale != "" {
+		if e.Locale = i18n.Normalize(e.Locale); e.Locale == "" {
+			return config.ErrParam.WithMessage("error.locale", "不支持的语言")
+		}
+	}
+	id, _, _ := GetSessionUser(e.Token)
+	if err = e.DB().Table(e.TableName()).Where("id = ?", id).Update("locale", e.Locale).Error; err != nil {
+		return
+	}
+	// 同步到当前会话（jwt模式下刷新令牌后生效），其他设备的会话重新登录后生效
+	user := SysUser{}
+	if session, err := config.Sessions.Get(sessionId(e.Token)); err == nil {
+		json.Unmarshal([]byte(session.User), &user)
+		user.Locale = e.Locale
+		user.UpdateUser(e.Token)
+	}
+	return
 }
 
 // 根据部门id校验是否存在用户
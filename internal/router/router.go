@@ -3,42 +3,49 @@ package router
 import (
 	"fiber-web-api/internal/app/common/config"
 	"fiber-web-api/internal/app/common/middleware"
+	"fiber-web-api/internal/app/common/ratelimit"
+	"fiber-web-api/internal/app/common/rbac"
 	api "fiber-web-api/internal/app/controller/sys"
+	model "fiber-web-api/internal/app/model/sys"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
-	 log2  "log"
-)
-func init(){
-	log2.Default()
 )
 
-}
 func InitRouter() *fiber.App {
 	// 配置路由
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
 	// init yaml conf
-	vp, err := config.InitConfig()
-	log2.Println("vp",vp)
+	_, err := config.InitConfig()
 	if err != nil {
 		panic(fmt.Errorf("init config error: %v", err))
 	}
 
+	// 操作日志异步写入
+	model.StartLogWriter(config.AuditQueueSize)
+	// 操作日志定时归档
+	model.StartLogArchive()
+	// 操作日志哈希链定时记录链外锚点
+	model.StartLogAnchor()
 	// 中间件
+	app.Use(middleware.SecureHeaders())
 	app.Use(middleware.LoggerPrint())
-	app.Use(middleware.CheckToken)
-	app.Use(middleware.SysLogInit)
-	// 注册路由
+	app.Use(middleware.Recover())
+	// 先过滤IP，被拒绝的来源（包括预检请求）拿不到跨域响应头
+	app.Use(middleware.IPFilter())
+	app.Use(middleware.Cors())
+	// 注册路由，操作日志、限流和鉴权在路由匹配之后执行，这样才能按路由路径（带路径参数的）获取接口信息。
+	// 操作日志在最前面，被限流、鉴权拒绝的请求也会记录
+	ipLimit := middleware.RateLimit(ratelimit.KindIP)
+	userLimit := middleware.RateLimit(ratelimit.KindUser)
 	apis := InitApi()
 	for _, api := range apis {
-		if api.Method == "POST" {
-			app.Post(api.Path, api.HandlerFunc)
-		}
-		if api.Method == "GET" {
-			app.Get(api.Path, api.HandlerFunc)
+		if err = config.RouteRules.Add(api.Method, api.Path, api.Auth, api.Permission); err != nil {
+			panic(fmt.Errorf("init router error: %v", err))
 		}
-		if api.Method == "DELETE" {
-			app.Delete(api.Path, api.HandlerFunc)
+		if _, ok := config.RateLimits[api.RateClass()]; !ok {
+			panic(fmt.Errorf("init router error: %s %s: unknown rate limit %q", api.Method, api.Path, api.RateLimit))
 		}
+		app.Add(api.Method, api.Path, middleware.SysLogInit, ipLimit, middleware.CheckToken, userLimit, api.HandlerFunc)
 		config.RouteApi[api.Path] = api
 	}
 
@@ -50,74 +57,99 @@ func InitRouter() *fiber.App {
 }
 
 var (
-	login = api.LoginController{}
-	log   = api.LogController{}
-	safe  = api.SafeController{}
-	user  = api.UserController{}
-	dept  = api.DeptController{}
-	role  = api.RoleController{}
-	menu  = api.MenuController{}
-	dict  = api.DictController{}
+	login   = api.LoginController{}
+	log     = api.LogController{}
+	safe    = api.SafeController{}
+	user    = api.UserController{}
+	dept    = api.DeptController{}
+	role    = api.RoleController{}
+	menu    = api.MenuController{}
+	dict    = api.DictController{}
+	session = api.SessionController{}
+	mfa     = api.MfaController{}
+	lockout = api.LockoutController{}
+	csp     = api.CspController{}
 )
 
 // 初始化接口路由api
 func InitApi() []config.CustomApi {
 	return []config.CustomApi{
 		// 登录路由
-		{"登录", "GET", "/sys/getKey", "获取RSA公钥", "", login.GetKey},
-		{"登录", "GET", "/sys/getCode", "获取验证码", "", login.GetCode},
-		{"登录", "POST", "/sys/login", "用户登录", "", login.Login},
-		{"登录", "DELETE", "/sys/logout", "用户退出", "", login.Logout},
+		{Group: "登录", Method: "GET", Path: "/sys/getKey", Description: "获取RSA公钥", Auth: rbac.Public, RateLimit: config.RateLimitStrict, HandlerFunc: login.GetKey},
+		{Group: "登录", Method: "GET", Path: "/sys/getCode", Description: "获取验证码", Auth: rbac.Public, RateLimit: config.RateLimitStrict, HandlerFunc: login.GetCode},
+		{Group: "登录", Method: "POST", Path: "/sys/login", Description: "用户登录", Auth: rbac.Public, RateLimit: config.RateLimitStrict, HandlerFunc: login.Login},
+		{Group: "登录", Method: "DELETE", Path: "/sys/logout", Description: "用户退出", Auth: rbac.Authenticated, HandlerFunc: login.Logout},
+		{Group: "登录", Method: "POST", Path: "/sys/login/mfa", Description: "校验动态验证码", Auth: rbac.Public, RateLimit: config.RateLimitStrict, HandlerFunc: login.LoginMfa},
+		{Group: "登录", Method: "POST", Path: "/sys/refresh", Description: "刷新令牌", Auth: rbac.Public, HandlerFunc: login.Refresh},
+		// 双因素认证
+		{Group: "双因素认证", Method: "GET", Path: "/sys/mfa/status", Description: "双因素认证状态", Auth: rbac.Authenticated, HandlerFunc: mfa.GetStatus},
+		{Group: "双因素认证", Method: "POST", Path: "/sys/mfa/setup", Description: "生成身份验证器密钥", Auth: rbac.Authenticated, HandlerFunc: mfa.Setup},
+		{Group: "双因素认证", Method: "POST", Path: "/sys/mfa/enable", Description: "开启双因素认证", Auth: rbac.Authenticated, HandlerFunc: mfa.Enable},
+		{Group: "双因素认证", Method: "POST", Path: "/sys/mfa/disable", Description: "关闭双因素认证", Auth: rbac.Authenticated, HandlerFunc: mfa.Disable},
+		{Group: "双因素认证", Method: "POST", Path: "/sys/mfa/recoveryCodes", Description: "重新生成恢复码", Auth: rbac.Authenticated, HandlerFunc: mfa.RecoveryCodes},
+		{Group: "双因素认证", Method: "DELETE", Path: "/sys/mfa/reset/:userId", Description: "重置用户的双因素认证", Permission: "system:user:update", HandlerFunc: mfa.Reset},
+		// 会话管理
+		{Group: "会话管理", Method: "GET", Path: "/sys/session/list", Description: "我的登录会话", Auth: rbac.Authenticated, HandlerFunc: session.GetList},
+		{Group: "会话管理", Method: "DELETE", Path: "/sys/session/revoke/:id", Description: "注销会话", Auth: rbac.Authenticated, HandlerFunc: session.Revoke},
+		{Group: "会话管理", Method: "DELETE", Path: "/sys/session/revokeAll", Description: "注销所有会话", Auth: rbac.Authenticated, HandlerFunc: session.RevokeAll},
+		{Group: "会话管理", Method: "DELETE", Path: "/sys/session/forceLogout/:userId", Description: "强制用户下线", Permission: "system:user:update", HandlerFunc: session.ForceLogout},
 		// 日志管理
-		{"日志管理", "GET", "/sys/log/list", "日志列表", "system:userLog:view", log.GetPage},
+		{Group: "日志管理", Method: "GET", Path: "/sys/log/list", Description: "日志列表", Permission: "system:userLog:view", HandlerFunc: log.GetPage},
+		{Group: "日志管理", Method: "GET", Path: "/sys/log/export", Description: "导出日志", Permission: "system:userLog:view", HandlerFunc: log.Export},
+		{Group: "日志管理", Method: "GET", Path: "/sys/log/verify", Description: "校验日志完整性", Permission: "system:userLog:view", HandlerFunc: log.Verify},
 		// 安全设置
-		{"安全设置", "GET", "/sys/safe/getSafeSet", "获取安全设置", "system:userLog:view", safe.GetSafeSet},
-		{"安全设置", "POST", "/sys/safe/update", "修改安全设置", "system:safe:update", safe.Update},
+		{Group: "安全设置", Method: "GET", Path: "/sys/safe/getSafeSet", Description: "获取安全设置", Permission: "system:userLog:view", HandlerFunc: safe.GetSafeSet},
+		{Group: "安全设置", Method: "POST", Path: "/sys/safe/update", Description: "修改安全设置", Permission: "system:safe:update", HandlerFunc: safe.Update},
+		{Group: "安全设置", Method: "POST", Path: "/sys/csp/report", Description: "CSP违规报告", Auth: rbac.Public, RateLimit: config.RateLimitStrict, NoAudit: true, HandlerFunc: csp.Report},
+		// 登录锁定
+		{Group: "登录锁定", Method: "GET", Path: "/sys/lockout/list", Description: "登录锁定列表", Permission: "system:safe:update", HandlerFunc: lockout.GetList},
+		{Group: "登录锁定", Method: "DELETE", Path: "/sys/lockout/clear", Description: "解除锁定", Permission: "system:safe:update", HandlerFunc: lockout.Clear},
 		// 用户管理
-		{"用户管理", "GET", "/sys/user/getLoginUser", "获取当前登录的用户", "", user.GetLoginUser},
-		{"用户管理", "GET", "/sys/user/list", "用户列表", "system:user:view", user.GetPage},
-		{"用户管理", "GET", "/sys/user/getById/:id", "根据id获取用户", "system:user:view", user.GetById},
-		{"用户管理", "POST", "/sys/user/insert", "新增用户", "system:user:add", user.Insert},
-		{"用户管理", "POST", "/sys/user/update", "修改用户", "system:user:update", user.Update},
-		{"用户管理", "DELETE", "/sys/user/delete", "删除用户", "system:user:delete", user.Delete},
-		{"用户管理", "POST", "/sys/user/updatePassword", "设置密码", "system:user:updatePassword", user.UpdatePassword},
-		{"用户管理", "POST", "/sys/user/resetPassword", "重置密码", "system:user:updatePassword", user.ResetPassword},
-		{"用户管理", "POST", "/sys/user/upload", "上传头像", "", user.Upload},
+		{Group: "用户管理", Method: "GET", Path: "/sys/user/getLoginUser", Description: "获取当前登录的用户", Auth: rbac.Authenticated, HandlerFunc: user.GetLoginUser},
+		{Group: "用户管理", Method: "POST", Path: "/sys/user/updateLocale", Description: "修改语言偏好", Auth: rbac.Authenticated, HandlerFunc: user.UpdateLocale},
+		{Group: "用户管理", Method: "GET", Path: "/sys/user/list", Description: "用户列表", Permission: "system:user:view", HandlerFunc: user.GetPage},
+		{Group: "用户管理", Method: "GET", Path: "/sys/user/getById/:id", Description: "根据id获取用户", Permission: "system:user:view", HandlerFunc: user.GetById},
+		{Group: "用户管理", Method: "POST", Path: "/sys/user/insert", Description: "新增用户", Permission: "system:user:add", HandlerFunc: user.Insert},
+		{Group: "用户管理", Method: "POST", Path: "/sys/user/update", Description: "修改用户", Permission: "system:user:update", HandlerFunc: user.Update},
+		{Group: "用户管理", Method: "DELETE", Path: "/sys/user/delete", Description: "删除用户", Permission: "system:user:delete", HandlerFunc: user.Delete},
+		{Group: "用户管理", Method: "POST", Path: "/sys/user/updatePassword", Description: "设置密码", Permission: "system:user:updatePassword", HandlerFunc: user.UpdatePassword},
+		{Group: "用户管理", Method: "POST", Path: "/sys/user/resetPassword", Description: "重置密码", Permission: "system:user:updatePassword", HandlerFunc: user.ResetPassword},
+		{Group: "用户管理", Method: "POST", Path: "/sys/user/upload", Description: "上传头像", Auth: rbac.Authenticated, HandlerFunc: user.Upload},
 		// 部门管理
-		{"部门管理", "GET", "/sys/dept/list", "部门树列表", "system:user:view;system:dept:view", dept.GetList},
-		{"部门管理", "GET", "/sys/dept/getById/:id", "根据id获取部门", "system:user:view;system:dept:view", dept.GetById},
-		{"部门管理", "POST", "/sys/dept/insert", "新增部门", "system:user:add;system:dept:add", dept.Insert},
-		{"部门管理", "POST", "/sys/dept/update", "修改部门", "system:user:update;system:dept:update", dept.Update},
-		{"部门管理", "DELETE", "/sys/dept/delete/:id", "删除部门", "system:user:delete;system:dept:delete", dept.Delete},
-		{"部门管理", "GET", "/sys/dept/deptSelect", "部门下拉树列表", "", dept.GetSelectList},
+		{Group: "部门管理", Method: "GET", Path: "/sys/dept/list", Description: "部门树列表", Permission: "system:user:view;system:dept:view", HandlerFunc: dept.GetList},
+		{Group: "部门管理", Method: "GET", Path: "/sys/dept/getById/:id", Description: "根据id获取部门", Permission: "system:user:view;system:dept:view", HandlerFunc: dept.GetById},
+		{Group: "部门管理", Method: "POST", Path: "/sys/dept/insert", Description: "新增部门", Permission: "system:user:add;system:dept:add", HandlerFunc: dept.Insert},
+		{Group: "部门管理", Method: "POST", Path: "/sys/dept/update", Description: "修改部门", Permission: "system:user:update;system:dept:update", HandlerFunc: dept.Update},
+		{Group: "部门管理", Method: "DELETE", Path: "/sys/dept/delete/:id", Description: "删除部门", Permission: "system:user:delete;system:dept:delete", HandlerFunc: dept.Delete},
+		{Group: "部门管理", Method: "GET", Path: "/sys/dept/deptSelect", Description: "部门下拉树列表", Auth: rbac.Authenticated, HandlerFunc: dept.GetList},
 		// 角色管理
-		{"角色管理", "GET", "/sys/role/list", "角色列表", "system:role:view", role.GetPage},
-		{"角色管理", "GET", "/sys/role/getById/:id", "根据id获取角色", "system:role:view", role.GetById},
-		{"角色管理", "GET", "/sys/role/createRoleCode", "生成角色编码", "", role.CreateCode},
-		{"角色管理", "POST", "/sys/role/insert", "新增角色", "system:role:add", role.Insert},
-		{"角色管理", "POST", "/sys/role/update", "修改角色", "system:role:update", role.Update},
-		{"角色管理", "POST", "/sys/role/updateState", "修改角色状态", "system:role:update", role.UpdateState},
-		{"角色管理", "DELETE", "/sys/role/delete", "删除角色", "system:role:delete", role.Delete},
-		{"角色管理", "GET", "/sys/role/roleSelect", "角色下拉框", "", role.GetSelectList},
+		{Group: "角色管理", Method: "GET", Path: "/sys/role/list", Description: "角色列表", Permission: "system:role:view", HandlerFunc: role.GetPage},
+		{Group: "角色管理", Method: "GET", Path: "/sys/role/getById/:id", Description: "根据id获取角色", Permission: "system:role:view", HandlerFunc: role.GetById},
+		{Group: "角色管理", Method: "GET", Path: "/sys/role/createRoleCode", Description: "生成角色编码", Auth: rbac.Authenticated, HandlerFunc: role.CreateCode},
+		{Group: "角色管理", Method: "POST", Path: "/sys/role/insert", Description: "新增角色", Permission: "system:role:add", HandlerFunc: role.Insert},
+		{Group: "角色管理", Method: "POST", Path: "/sys/role/update", Description: "修改角色", Permission: "system:role:update", HandlerFunc: role.Update},
+		{Group: "角色管理", Method: "POST", Path: "/sys/role/updateState", Description: "修改角色状态", Permission: "system:role:update", HandlerFunc: role.UpdateState},
+		{Group: "角色管理", Method: "DELETE", Path: "/sys/role/delete", Description: "删除角色", Permission: "system:role:delete", HandlerFunc: role.Delete},
+		{Group: "角色管理", Method: "GET", Path: "/sys/role/roleSelect", Description: "角色下拉框", Auth: rbac.Authenticated, HandlerFunc: role.GetSelectList},
 		// 菜单管理
-		{"菜单管理", "GET", "/sys/menu/list", "菜单列表", "system:menu:view", menu.GetList},
-		{"菜单管理", "GET", "/sys/menu/getRouters", "路由列表", "", menu.GetRouters},
-		{"菜单管理", "GET", "/sys/menu/getById/:id", "根据id获取菜单", "system:menu:view", menu.GetById},
-		{"菜单管理", "GET", "/sys/menu/roleMenuTree/:roleId", "获取对应角色菜单列表树", "", menu.RoleMenuTree},
-		{"菜单管理", "POST", "/sys/menu/insert", "新增菜单", "system:menu:add", menu.Insert},
-		{"菜单管理", "POST", "/sys/menu/update", "修改菜单", "system:menu:update", menu.Update},
-		{"菜单管理", "DELETE", "/sys/menu/delete/:id", "删除菜单", "system:menu:delete", menu.Delete},
+		{Group: "菜单管理", Method: "GET", Path: "/sys/menu/list", Description: "菜单列表", Permission: "system:menu:view", HandlerFunc: menu.GetList},
+		{Group: "菜单管理", Method: "GET", Path: "/sys/menu/getRouters", Description: "路由列表", Auth: rbac.Authenticated, HandlerFunc: menu.GetRouters},
+		{Group: "菜单管理", Method: "GET", Path: "/sys/menu/getById/:id", Description: "根据id获取菜单", Permission: "system:menu:view", HandlerFunc: menu.GetById},
+		{Group: "菜单管理", Method: "GET", Path: "/sys/menu/roleMenuTree/:roleId", Description: "获取对应角色菜单列表树", Auth: rbac.Authenticated, HandlerFunc: menu.RoleMenuTree},
+		{Group: "菜单管理", Method: "POST", Path: "/sys/menu/insert", Description: "新增菜单", Permission: "system:menu:add", HandlerFunc: menu.Insert},
+		{Group: "菜单管理", Method: "POST", Path: "/sys/menu/update", Description: "修改菜单", Permission: "system:menu:update", HandlerFunc: menu.Update},
+		{Group: "菜单管理", Method: "DELETE", Path: "/sys/menu/delete/:id", Description: "删除菜单", Permission: "system:menu:delete", HandlerFunc: menu.Delete},
 		// 字典管理
-		{"字典管理", "GET", "/sys/dict/typeList", "获取字段类型列表", "system:dict:view", dict.GetTypeList},
-		{"字典管理", "GET", "/sys/dict/list", "字段项列表分页", "system:dict:view", dict.GetPage},
-		{"字典管理", "GET", "/sys/dict/getById/:id", "根据id获取字段", "system:dict:view", dict.GetById},
-		{"字典管理", "GET", "/sys/dict/createDictCode", "生成字典代码", "", dict.CreateCode},
-		{"字典管理", "GET", "/sys/dict/hasDictByName", "字典名称是否存在", "", dict.HasByName},
-		{"字典管理", "GET", "/sys/dict/hasDictByCode", "字典代码是否存在", "", dict.HasByCode},
-		{"字典管理", "POST", "/sys/dict/insert", "新增字典", "system:dict:add", dict.Insert},
-		{"字典管理", "POST", "/sys/dict/update", "修改字典", "system:dict:update", dict.Update},
-		{"字典管理", "DELETE", "/sys/dict/deleteType/:id", "删除字典类型", "system:dict:delete", dict.DeleteType},
-		{"字典管理", "DELETE", "/sys/dict/delete", "删除字典", "system:dict:delete", dict.Delete},
-		{"字典管理", "GET", "/sys/dict/getByTypeCode", "根据字典类型代码获取字典项列表", "", dict.GetByTypeCode},
+		{Group: "字典管理", Method: "GET", Path: "/sys/dict/typeList", Description: "获取字段类型列表", Permission: "system:dict:view", HandlerFunc: dict.GetTypeList},
+		{Group: "字典管理", Method: "GET", Path: "/sys/dict/list", Description: "字段项列表分页", Permission: "system:dict:view", HandlerFunc: dict.GetPage},
+		{Group: "字典管理", Method: "GET", Path: "/sys/dict/getById/:id", Description: "根据id获取字段", Permission: "system:dict:view", HandlerFunc: dict.GetById},
+		{Group: "字典管理", Method: "GET", Path: "/sys/dict/createDictCode", Description: "生成字典代码", Auth: rbac.Authenticated, HandlerFunc: dict.CreateCode},
+		{Group: "字典管理", Method: "GET", Path: "/sys/dict/hasDictByName", Description: "字典名称是否存在", Auth: rbac.Authenticated, HandlerFunc: dict.HasByName},
+		{Group: "字典管理", Method: "GET", Path: "/sys/dict/hasDictByCode", Description: "字典代码是否存在", Auth: rbac.Authenticated, HandlerFunc: dict.HasByCode},
+		{Group: "字典管理", Method: "POST", Path: "/sys/dict/insert", Description: "新增字典", Permission: "system:dict:add", HandlerFunc: dict.Insert},
+		{Group: "字典管理", Method: "POST", Path: "/sys/dict/update", Description: "修改字典", Permission: "system:dict:update", HandlerFunc: dict.Update},
+		{Group: "字典管理", Method: "DELETE", Path: "/sys/dict/deleteType/:id", Description: "删除字典类型", Permission: "system:dict:delete", HandlerFunc: dict.DeleteType},
+		{Group: "字典管理", Method: "DELETE", Path: "/sys/dict/delete", Description: "删除字典", Permission: "system:dict:delete", HandlerFunc: dict.Delete},
+		{Group: "字典管理", Method: "GET", Path: "/sys/dict/getByTypeCode", Description: "根据字典类型代码获取字典项列表", Auth: rbac.Authenticated, HandlerFunc: dict.GetByTypeCode},
 	}
 }
@@ -0,0 +1,138 @@
+package router
+
+import (
+	"encoding/json"
+	"fiber-web-api/internal/app/common/config"
+	"fiber-web-api/internal/app/common/middleware"
+	"fiber-web-api/internal/app/common/rbac"
+	"fiber-web-api/internal/app/common/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/spf13/viper"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 不需要登录的接口，新增公开接口时需要同步修改这里
+var publicApis = map[string]bool{
+	"GET /sys/getKey":      true,
+	"GET /sys/getCode":     true,
+	"POST /sys/login":      true,
+	"POST /sys/login/mfa":  true,
+	"POST /sys/refresh":    true,
+	"POST /sys/csp/report": true,
+}
+
+func TestInitApi(t *testing.T) {
+	config.Config = viper.New()
+	config.LoadRateLimit()
+	engine := rbac.New()
+	for _, api := range InitApi() {
+		name := api.Method + " " + api.Path
+		t.Run(name, func(t *testing.T) {
+			if api.HandlerFunc == nil {
+				t.Fatal("missing handler")
+			}
+			if api.Auth == "" && api.Permission == "" {
+				t.Fatal("missing auth level or permission")
+			}
+			if _, ok := config.RateLimits[api.RateClass()]; !ok {
+				t.Fatalf("unknown rate limit %q", api.RateLimit)
+			}
+			if err := engine.Add(api.Method, api.Path, api.Auth, api.Permission); err != nil {
+				t.Fatal(err)
+			}
+			// 只有列出的接口可以公开
+			if publicApis[name] != (api.Auth == rbac.Public) {
+				t.Fatalf("auth = %q, public = %v", api.Auth, publicApis[name])
+			}
+		})
+	}
+	for name := range publicApis {
+		method, path, _ := strings.Cut(name, " ")
+		if _, ok := engine.Match(method, path); !ok {
+			t.Errorf("public route %s is not registered", name)
+		}
+	}
+}
+
+// 登录一个用户，返回令牌
+func testLogin(t *testing.T, token, roleId string) string {
+	t.Helper()
+	user, _ := json.Marshal(map[string]string{"id": token, "userName": token, "roleId": roleId})
+	err := config.Sessions.Create(&store.Session{
+		Token:      token,
+		UserId:     token,
+		User:       string(user),
+		CreateTime: time.Now().Unix(),
+		Expire:     time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// 通过 HTTP 请求经过 CheckToken，按路由路径（带路径参数的）鉴权，而不是请求的实际路径
+func TestCheckToken(t *testing.T) {
+	config.Config = viper.New()
+	config.TokenMode = config.TokenModeOpaque
+	config.SignEnable = false
+	config.Sessions = store.NewMemorySessionStore(0)
+	config.Cache = store.NewMemoryCache(0)
+	config.RouteRules = rbac.New()
+	// 角色的权限列表从缓存中取，不查询数据库
+	config.Cache.HSet(config.RolePermList, map[string]string{
+		"viewer": "system:user:view",
+		"dept":   "system:dept:view",
+	})
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	ok := func(c *fiber.Ctx) error { return c.SendString(c.Route().Path) }
+	for _, api := range InitApi() {
+		if err := config.RouteRules.Add(api.Method, api.Path, api.Auth, api.Permission); err != nil {
+			t.Fatal(err)
+		}
+		app.Add(api.Method, api.Path, middleware.CheckToken, ok)
+	}
+	// 没有鉴权规则的接口
+	app.Get("/sys/test/:id", middleware.CheckToken, ok)
+
+	viewer := testLogin(t, "viewer-token", "viewer")
+	dept := testLogin(t, "dept-token", "dept")
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"permitted", "GET", "/sys/user/getById/123", viewer, 200},
+		{"missing permission", "GET", "/sys/user/getById/123", dept, 403},
+		{"not logged in", "GET", "/sys/user/getById/123", "", 401},
+		{"invalid token", "GET", "/sys/user/getById/123", "unknown", 401},
+		{"case and trailing slash", "GET", "/SYS/User/GETBYID/123/", dept, 403},
+		{"case and trailing slash permitted", "GET", "/SYS/User/GETBYID/123/", viewer, 200},
+		{"any of", "GET", "/sys/dept/getById/1", dept, 200},
+		{"any of other", "GET", "/sys/dept/getById/1", viewer, 200},
+		{"other route", "GET", "/sys/role/getById/1", viewer, 403},
+		{"authenticated", "GET", "/sys/user/getLoginUser", dept, 200},
+		{"public", "GET", "/sys/getCode", "", 200},
+		{"no rule", "GET", "/sys/test/1", viewer, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set(config.TokenHeader, tt.token)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+			}
+		})
+	}
+}